@@ -1,17 +1,33 @@
 package main
 
 import (
-	"auth-service/internal/config"
-	"auth-service/internal/controller"
-	"auth-service/internal/logger"
-	"auth-service/internal/middleware"
-	"auth-service/internal/repository"
-	"auth-service/internal/service"
+	"context"
+	"crypto"
 	"database/sql"
 	"fmt"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/finance-app/finance-app/auth-service/internal/config"
+	"github.com/finance-app/finance-app/auth-service/internal/controller"
+	"github.com/finance-app/finance-app/auth-service/internal/events"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/mailer"
+	"github.com/finance-app/finance-app/auth-service/internal/middleware"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/finance-app/finance-app/auth-service/internal/notifier"
+	"github.com/finance-app/finance-app/auth-service/internal/ratelimit"
+	"github.com/finance-app/finance-app/auth-service/internal/repository"
+	"github.com/finance-app/finance-app/auth-service/internal/service"
+	"github.com/finance-app/finance-app/auth-service/pkg/authn"
 	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/go-webauthn/webauthn/webauthn"
 	_ "github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 func main() {
@@ -19,30 +35,281 @@ func main() {
 
 	cfg := config.LoadConfig(logs)
 
+	// TOTP seeds and recovery codes must not depend on the token signing
+	// secret, so the key has to be set explicitly.
+	if cfg["MFA_ENCRYPTION_KEY"] == "" {
+		logs.Error.Fatalf("MFA_ENCRYPTION_KEY is not set")
+	}
+	// Audit events store keyed hashes of client details, which must not be
+	// reversible by whoever can read the table.
+	if cfg["AUDIT_HASH_KEY"] == "" {
+		logs.Error.Fatalf("AUDIT_HASH_KEY is not set")
+	}
+
 	db := connectToDB(cfg, logs)
 	defer db.Close()
 
-	jwtService := service.NewJWTService(cfg["JWT_SECRET"])
+	signer := newIDTokenSigner(cfg, logs)
+	accessTokenAudience := config.GetString(cfg, "ACCESS_TOKEN_AUDIENCE", "finance-api")
+	jwtService := service.NewJWTService(cfg["JWT_SECRET"], signer, accessTokenAudience)
 	userRepo := repository.NewUserRepository(db, logs)
-	userService := service.NewUserService(userRepo, logs, jwtService)
+	roleRepo := repository.NewRoleRepository(db, logs)
+	userTokenRepo := repository.NewUserTokenRepository(db, logs)
+	sessionRepo := repository.NewSessionRepository(db, logs)
+	exportRepo := repository.NewExportRepository(db, logs)
+	mfaRepo := repository.NewMFARepository(db, logs)
+	passkeyRepo := repository.NewPasskeyRepository(db, logs)
+	oauthRepo := repository.NewOAuthRepository(db, logs)
+	identityRepo := repository.NewIdentityRepository(db, logs)
+	apiKeyRepo := repository.NewAPIKeyRepository(db, logs)
+	auditRepo := repository.NewAuditRepository(db, logs)
+	outboxRepo := repository.NewOutboxRepository(db, logs)
+	redisClient := newRedisClient(cfg)
+	mail := newMailer(cfg, logs)
+	tokenState := service.NewTokenStateCache(userRepo, config.GetDuration(cfg, "TOKEN_STATE_CACHE_TTL", 30*time.Second))
+	webAuthn := newWebAuthn(cfg, logs)
+	auditLog := service.NewAuditLog(auditRepo, cfg["AUDIT_HASH_KEY"], logs)
+	userService := service.NewUserService(userRepo, roleRepo, userTokenRepo, sessionRepo, mfaRepo, passkeyRepo, identityRepo, mail,
+		notifier.NewEmailNotifier(mail), logs, jwtService, tokenState, auditLog, webAuthn, newSocialProviders(cfg), service.UserServiceConfig{
+			AppBaseURL:                 config.GetString(cfg, "APP_BASE_URL", "http://localhost:8081"),
+			MaxFailedLoginAttempts:     config.GetInt(cfg, "MAX_FAILED_LOGIN_ATTEMPTS", 5),
+			AccountLockDuration:        config.GetDuration(cfg, "ACCOUNT_LOCK_DURATION", 15*time.Minute),
+			MaxAccountLockDuration:     config.GetDuration(cfg, "MAX_ACCOUNT_LOCK_DURATION", 24*time.Hour),
+			LoginAlertLookback:         config.GetDuration(cfg, "LOGIN_ALERT_LOOKBACK", 90*24*time.Hour),
+			UnverifiedUserPolicy:       config.GetString(cfg, "UNVERIFIED_USER_POLICY", service.UnverifiedPolicyBlock),
+			EmailVerificationTTL:       config.GetDuration(cfg, "EMAIL_VERIFICATION_TTL", 24*time.Hour),
+			VerificationResendInterval: config.GetDuration(cfg, "VERIFICATION_RESEND_DELAY", time.Minute),
+			PasswordResetTTL:           config.GetDuration(cfg, "PASSWORD_RESET_TTL", 30*time.Minute),
+			EmailChangeTTL:             config.GetDuration(cfg, "EMAIL_CHANGE_TTL", 24*time.Hour),
+			EmailChangeUndoTTL:         config.GetDuration(cfg, "EMAIL_CHANGE_UNDO_TTL", 7*24*time.Hour),
+			DeletionGracePeriod:        config.GetDuration(cfg, "ACCOUNT_DELETION_GRACE_PERIOD", 30*24*time.Hour),
+			ConcealExistingAccounts:    cfg["REGISTRATION_CONCEAL_EXISTING"] == "true",
+			PasswordPolicy:             service.PasswordPolicy{MinLength: config.GetInt(cfg, "PASSWORD_MIN_LENGTH", 8)},
+			TOTPIssuer:                 config.GetString(cfg, "TOTP_ISSUER", "Finance App"),
+			MFAChallengeTTL:            config.GetDuration(cfg, "MFA_CHALLENGE_TTL", 5*time.Minute),
+			MFAEncryptionKey:           cfg["MFA_ENCRYPTION_KEY"],
+			PasskeyCeremonyTTL:         config.GetDuration(cfg, "WEBAUTHN_CEREMONY_TTL", 5*time.Minute),
+			SocialStateTTL:             config.GetDuration(cfg, "SOCIAL_STATE_TTL", 10*time.Minute),
+			MagicLinkTTL:               config.GetDuration(cfg, "MAGIC_LINK_TTL", 15*time.Minute),
+			StepUpTokenTTL:             config.GetDuration(cfg, "STEP_UP_TOKEN_TTL", 5*time.Minute),
+		})
+	roleService := service.NewRoleService(roleRepo, userRepo, auditLog, logs)
+	exportService := service.NewExportService(userRepo, roleRepo, sessionRepo, exportRepo, auditRepo, mail, logs, service.ExportServiceConfig{
+		AppBaseURL:   config.GetString(cfg, "APP_BASE_URL", "http://localhost:8081"),
+		Dir:          config.GetString(cfg, "EXPORT_DIR", filepath.Join(os.TempDir(), "auth-service-exports")),
+		LinkTTL:      config.GetDuration(cfg, "EXPORT_LINK_TTL", time.Hour),
+		PollInterval: config.GetDuration(cfg, "EXPORT_POLL_INTERVAL", 30*time.Second),
+	})
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo, userRepo, roleRepo, notifier.NewEmailNotifier(mail), logs, service.APIKeyServiceConfig{
+		MaxKeysPerUser: config.GetInt(cfg, "API_KEY_MAX_PER_USER", 20),
+		MaxLifetime:    config.GetDuration(cfg, "API_KEY_MAX_LIFETIME", 365*24*time.Hour),
+	})
+	oauthService := service.NewOAuthService(oauthRepo, userRepo, roleRepo, sessionRepo, jwtService, signer, tokenState, apiKeyService, logs,
+		service.OAuthServiceConfig{
+			ConsentURL:            config.GetString(cfg, "OAUTH_CONSENT_URL", config.GetString(cfg, "APP_BASE_URL", "http://localhost:8081")+"/oauth/consent"),
+			CodeTTL:               config.GetDuration(cfg, "OAUTH_CODE_TTL", time.Minute),
+			RefreshTokenTTL:       config.GetDuration(cfg, "OAUTH_REFRESH_TOKEN_TTL", 30*24*time.Hour),
+			IntrospectionCacheTTL: config.GetDuration(cfg, "OAUTH_INTROSPECTION_CACHE_TTL", 5*time.Second),
+			ServiceTokenTTL:       config.GetDuration(cfg, "OAUTH_SERVICE_TOKEN_TTL", 5*time.Minute),
+		})
+	adminService := service.NewAdminService(userRepo, roleRepo, userService, tokenState, auditLog, logs)
 	userHandler := controller.NewUserHandler(userService, logs)
-	jwtMiddleware := middleware.NewJWTMiddleware(jwtService)
+	adminHandler := controller.NewAdminHandler(adminService, roleService, logs)
+	exportHandler := controller.NewExportHandler(exportService, logs)
+	oauthHandler := controller.NewOAuthHandler(oauthService, logs)
+	apiKeyHandler := controller.NewAPIKeyHandler(apiKeyService, logs)
+	auditHandler := controller.NewAuditHandler(auditLog, logs)
+	jwtMiddleware := middleware.NewJWTMiddleware(jwtService, tokenState, apiKeyService)
+	// Other services fetch the keys with authn.NewRemoteVerifier; here the
+	// signer's own key is used.
+	serviceAuth := authn.NewVerifier(&oidc.StaticKeySet{PublicKeys: []crypto.PublicKey{signer.PublicKey()}}, signer.Issuer(), accessTokenAudience)
+	// Routes that add sign-in methods, hand out credentials or end the
+	// account need a recent sign-in or reauthentication.
+	stepUp := jwtMiddleware.RequireStepUp(middleware.StepUpPolicy{
+		MaxAge: config.GetDuration(cfg, "STEP_UP_MAX_AGE", 10*time.Minute),
+	})
+	// Removing a sign-in method could otherwise be used with a stolen session
+	// to take out the factor that protects the account.
+	stepUpSecondFactor := jwtMiddleware.RequireStepUp(middleware.StepUpPolicy{
+		MaxAge:       config.GetDuration(cfg, "STEP_UP_MAX_AGE", 10*time.Minute),
+		SecondFactor: true,
+	})
+	// Setting up a second factor or unlinking a provider needs the factor the
+	// user already has, if any; otherwise a recent sign-in has to do.
+	stepUpEnrolledFactor := jwtMiddleware.RequireStepUp(middleware.StepUpPolicy{
+		MaxAge:               config.GetDuration(cfg, "STEP_UP_MAX_AGE", 10*time.Minute),
+		SecondFactorEnrolled: userService.HasSecondFactor,
+	})
+	rateLimit := middleware.NewRateLimitMiddleware(newRateLimiter(cfg, redisClient, logs), logs)
+	loginLimit := rateLimit.Limit("login", middleware.RateLimitPolicy{
+		PerIP:      config.GetRate(cfg, "RATE_LIMIT_LOGIN_IP", ratelimit.Rate{Limit: 50, Window: 15 * time.Minute}),
+		PerEmail:   config.GetRate(cfg, "RATE_LIMIT_LOGIN_EMAIL", ratelimit.Rate{Limit: 20, Window: 15 * time.Minute}),
+		PerIPEmail: config.GetRate(cfg, "RATE_LIMIT_LOGIN_IP_EMAIL", ratelimit.Rate{Limit: 5, Window: time.Minute}),
+	})
+	mfaLimit := rateLimit.Limit("login_mfa", middleware.RateLimitPolicy{
+		PerIP: config.GetRate(cfg, "RATE_LIMIT_LOGIN_MFA_IP", ratelimit.Rate{Limit: 10, Window: time.Minute}),
+	})
+	registerLimit := rateLimit.Limit("register", middleware.RateLimitPolicy{
+		PerIP:      config.GetRate(cfg, "RATE_LIMIT_REGISTER_IP", ratelimit.Rate{Limit: 10, Window: time.Hour}),
+		PerEmail:   config.GetRate(cfg, "RATE_LIMIT_REGISTER_EMAIL", ratelimit.Rate{Limit: 5, Window: time.Hour}),
+		PerIPEmail: config.GetRate(cfg, "RATE_LIMIT_REGISTER_IP_EMAIL", ratelimit.Rate{Limit: 3, Window: time.Hour}),
+	})
+	verificationResendLimit := rateLimit.Limit("verify_email_resend", middleware.RateLimitPolicy{
+		PerIP:    config.GetRate(cfg, "RATE_LIMIT_RESEND_IP", ratelimit.Rate{Limit: 10, Window: 15 * time.Minute}),
+		PerEmail: config.GetRate(cfg, "RATE_LIMIT_RESEND_EMAIL", ratelimit.Rate{Limit: 3, Window: 15 * time.Minute}),
+	})
+	refreshLimit := rateLimit.Limit("refresh", middleware.RateLimitPolicy{
+		PerIP: config.GetRate(cfg, "RATE_LIMIT_REFRESH_IP", ratelimit.Rate{Limit: 60, Window: time.Minute}),
+	})
+	passwordResetLimit := rateLimit.Limit("password_reset", middleware.RateLimitPolicy{
+		PerIP:    config.GetRate(cfg, "RATE_LIMIT_PASSWORD_RESET_IP", ratelimit.Rate{Limit: 10, Window: 15 * time.Minute}),
+		PerEmail: config.GetRate(cfg, "RATE_LIMIT_PASSWORD_RESET_EMAIL", ratelimit.Rate{Limit: 3, Window: 15 * time.Minute}),
+	})
+	magicLinkLimit := rateLimit.Limit("magic_link", middleware.RateLimitPolicy{
+		PerIP:    config.GetRate(cfg, "RATE_LIMIT_MAGIC_LINK_IP", ratelimit.Rate{Limit: 10, Window: 15 * time.Minute}),
+		PerEmail: config.GetRate(cfg, "RATE_LIMIT_MAGIC_LINK_EMAIL", ratelimit.Rate{Limit: 3, Window: 15 * time.Minute}),
+	})
+	oauthTokenLimit := rateLimit.Limit("oauth_token", middleware.RateLimitPolicy{
+		PerIP: config.GetRate(cfg, "RATE_LIMIT_OAUTH_TOKEN_IP", ratelimit.Rate{Limit: 60, Window: time.Minute}),
+	})
+	// Resource servers introspect on every request they serve, so this one is
+	// generous; it is there to stop token and client secret guessing.
+	introspectLimit := rateLimit.Limit("oauth_introspect", middleware.RateLimitPolicy{
+		PerIP: config.GetRate(cfg, "RATE_LIMIT_OAUTH_INTROSPECT_IP", ratelimit.Rate{Limit: 600, Window: time.Minute}),
+	})
+
+	erasureJob := service.NewAccountErasureJob(userRepo, auditLog, logs, config.GetString(cfg, "ACCOUNT_ERASURE_MODE", service.ErasureModeAnonymize),
+		config.GetDuration(cfg, "ACCOUNT_ERASURE_INTERVAL", time.Hour))
+	go erasureJob.Run(context.Background())
+	go exportService.Run(context.Background())
+	outboxRelay := service.NewOutboxRelay(outboxRepo, newEventPublisher(cfg, redisClient, logs), logs, service.OutboxRelayConfig{
+		PollInterval: config.GetDuration(cfg, "OUTBOX_POLL_INTERVAL", 2*time.Second),
+		BatchSize:    config.GetInt(cfg, "OUTBOX_BATCH_SIZE", 100),
+		Lease:        config.GetDuration(cfg, "OUTBOX_LEASE", time.Minute),
+		MaxBackoff:   config.GetDuration(cfg, "OUTBOX_MAX_BACKOFF", 10*time.Minute),
+		Retention:    config.GetDuration(cfg, "OUTBOX_RETENTION", 7*24*time.Hour),
+	})
+	go outboxRelay.Run(context.Background())
 
 	r := chi.NewRouter()
+	r.Use(chimiddleware.RequestID)
+	r.Use(newClientAddressMiddleware(cfg, logs).Resolve)
+
+	r.Get("/.well-known/openid-configuration", oauthHandler.DiscoveryHandler)
+	r.Get("/.well-known/jwks.json", oauthHandler.JWKSHandler)
+	r.With(jwtMiddleware.AuthenticateDelegated).Get("/userinfo", oauthHandler.UserInfoHandler)
+	r.With(jwtMiddleware.AuthenticateDelegated).Post("/userinfo", oauthHandler.UserInfoHandler)
+
+	r.Route("/oauth", func(r chi.Router) {
+		r.Get("/authorize", oauthHandler.AuthorizeHandler)
+		r.With(oauthTokenLimit).Post("/token", oauthHandler.TokenHandler)
+		r.With(oauthTokenLimit).Post("/revoke", oauthHandler.RevokeHandler)
+		r.With(introspectLimit).Post("/introspect", oauthHandler.IntrospectHandler)
+	})
 
 	r.Route("/api/v1", func(r chi.Router) {
+		r.Route("/oauth", func(r chi.Router) {
+			r.Use(jwtMiddleware.Authenticate)
+			r.Use(jwtMiddleware.RequireVerifiedEmail)
+			r.Use(jwtMiddleware.RejectAPIKeys)
+			r.Get("/consent", oauthHandler.ConsentPromptHandler)
+			r.Post("/consent", oauthHandler.ConsentHandler)
+		})
+
 		r.Route("/auth", func(r chi.Router) {
-			r.Post("/register", userHandler.RegisterHandler)
-			r.Post("/login", userHandler.LoginHandler)
-			r.Post("/refresh", userHandler.RefreshTokenHandler)
+			r.With(registerLimit).Post("/register", userHandler.RegisterHandler)
+			r.With(loginLimit).Post("/login", userHandler.LoginHandler)
+			r.With(mfaLimit).Post("/login/mfa", userHandler.LoginMFAHandler)
+			r.With(mfaLimit).Post("/login/mfa/passkey", userHandler.BeginPasskeyMFAHandler)
+			r.With(loginLimit).Post("/passkey/login/begin", userHandler.BeginPasskeyLoginHandler)
+			r.With(loginLimit).Post("/passkey/login/finish", userHandler.FinishPasskeyLoginHandler)
+			r.Get("/social/providers", userHandler.ListSocialProvidersHandler)
+			r.With(loginLimit).Post("/social/{provider}/begin", userHandler.BeginSocialLoginHandler)
+			r.With(loginLimit).Post("/social/{provider}/callback", userHandler.FinishSocialLoginHandler)
+			r.With(magicLinkLimit).Post("/magic-link", userHandler.RequestMagicLinkHandler)
+			r.With(loginLimit).Post("/magic-link/consume", userHandler.ConsumeMagicLinkHandler)
+			r.With(refreshLimit).Post("/refresh", userHandler.RefreshTokenHandler)
+			r.With(refreshLimit).Post("/logout", userHandler.LogoutHandler)
+			r.Post("/verify-email", userHandler.VerifyEmailHandler)
+			r.With(verificationResendLimit).Post("/verify-email/resend", userHandler.ResendVerificationHandler)
+			r.With(passwordResetLimit).Post("/password/forgot", userHandler.ForgotPasswordHandler)
+			r.With(passwordResetLimit).Post("/password/reset", userHandler.ResetPasswordHandler)
+			r.Post("/email/confirm", userHandler.ConfirmEmailChangeHandler)
+			r.Post("/email/undo", userHandler.UndoEmailChangeHandler)
+			r.Post("/account/restore", userHandler.RestoreAccountHandler)
+			r.Get("/exports/download", exportHandler.DownloadExportHandler)
 
 			r.Group(func(protected chi.Router) {
 				protected.Use(jwtMiddleware.Authenticate)
 				protected.Get("/users/me", userHandler.GetCurrentUserHandler)
-				protected.Put("/user/me/update", userHandler.UpdateCurrentUserHandler)
-				protected.Delete("/user/me/delete", userHandler.DeleteCurrentUser)
+				protected.With(jwtMiddleware.RejectAPIKeys).Get("/users/me/activity", auditHandler.ActivityHandler)
+				protected.With(jwtMiddleware.RejectAPIKeys, mfaLimit).Post("/reauthenticate", userHandler.ReauthenticateHandler)
+				protected.With(jwtMiddleware.RejectAPIKeys, mfaLimit).Post("/reauthenticate/passkey", userHandler.BeginPasskeyReauthenticationHandler)
+
+				protected.Group(func(verified chi.Router) {
+					verified.Use(jwtMiddleware.RequireVerifiedEmail)
+
+					verified.Group(func(account chi.Router) {
+						account.Use(jwtMiddleware.RejectAPIKeys)
+						account.Get("/users/me/export", exportHandler.ExportHandler)
+						account.Get("/users/me/exports/{id}", exportHandler.GetExportJobHandler)
+						account.Get("/users/me/exports/{id}/download", exportHandler.DownloadUserExportHandler)
+						account.Patch("/users/me", userHandler.UpdateCurrentUserHandler)
+						account.With(stepUp).Delete("/users/me", userHandler.DeleteCurrentUser)
+						account.With(stepUp).Delete("/user/me/delete", userHandler.DeleteCurrentUser)
+						account.With(loginLimit).Put("/users/me/password", userHandler.ChangePasswordHandler)
+						account.With(stepUp).Post("/users/me/email", userHandler.RequestEmailChangeHandler)
+						account.Get("/users/me/mfa", userHandler.GetMFAStatusHandler)
+						account.With(mfaLimit).Delete("/users/me/mfa", userHandler.DisableMFAHandler)
+						account.With(stepUpEnrolledFactor).Post("/users/me/mfa/totp", userHandler.EnrollTOTPHandler)
+						account.With(stepUpEnrolledFactor).Post("/users/me/mfa/totp/confirm", userHandler.ConfirmTOTPHandler)
+						account.With(stepUpSecondFactor, mfaLimit).Post("/users/me/mfa/recovery-codes", userHandler.RegenerateRecoveryCodesHandler)
+						account.Get("/users/me/passkeys", userHandler.ListPasskeysHandler)
+						account.With(stepUp).Post("/users/me/passkeys/register/begin", userHandler.BeginPasskeyRegistrationHandler)
+						account.Post("/users/me/passkeys/register/finish", userHandler.FinishPasskeyRegistrationHandler)
+						account.With(stepUpSecondFactor).Delete("/users/me/passkeys/{id}", userHandler.DeletePasskeyHandler)
+						account.Get("/users/me/identities", userHandler.ListIdentitiesHandler)
+						account.With(stepUp).Post("/users/me/identities/{provider}/begin", userHandler.BeginIdentityLinkHandler)
+						account.Post("/users/me/identities/{provider}/link", userHandler.LinkIdentityHandler)
+						account.With(stepUpEnrolledFactor).Delete("/users/me/identities/{id}", userHandler.UnlinkIdentityHandler)
+						account.Get("/users/me/api-keys", apiKeyHandler.ListAPIKeysHandler)
+						account.With(stepUp).Post("/users/me/api-keys", apiKeyHandler.CreateAPIKeyHandler)
+						account.Delete("/users/me/api-keys/{id}", apiKeyHandler.RevokeAPIKeyHandler)
+					})
+				})
 			})
 		})
+
+		// Endpoints other finance services call as themselves.
+		r.Route("/internal", func(internal chi.Router) {
+			internal.Use(serviceAuth.Authenticate)
+			internal.Use(authn.RequireService())
+			internal.With(authn.RequireScope(model.PermissionUsersRead)).Get("/users/{id}", adminHandler.GetUserHandler)
+		})
+
+		r.Route("/admin", func(admin chi.Router) {
+			admin.Use(jwtMiddleware.Authenticate)
+			admin.Use(jwtMiddleware.RequireRole(model.RoleAdmin))
+			admin.Get("/users", adminHandler.ListUsersHandler)
+			admin.Get("/users/{id}", adminHandler.GetUserHandler)
+			admin.Post("/users/{id}/disable", adminHandler.DisableUserHandler)
+			admin.Post("/users/{id}/enable", adminHandler.EnableUserHandler)
+			admin.Post("/users/{id}/logout", adminHandler.RevokeSessionsHandler)
+			admin.Post("/users/{id}/password-reset", adminHandler.ResetPasswordHandler)
+			admin.Delete("/users/{id}", adminHandler.DeleteUserHandler)
+
+			admin.Get("/roles", adminHandler.ListRolesHandler)
+			admin.Get("/users/{id}/roles", adminHandler.GetUserRolesHandler)
+			admin.With(jwtMiddleware.RequirePermission(model.PermissionRolesWrite)).Post("/users/{id}/roles", adminHandler.AssignRoleHandler)
+			admin.With(jwtMiddleware.RequirePermission(model.PermissionRolesWrite)).Delete("/users/{id}/roles/{role}", adminHandler.RemoveRoleHandler)
+
+			admin.Get("/audit-events", auditHandler.ListEventsHandler)
+			admin.Get("/audit-events/verify", auditHandler.VerifyChainHandler)
+
+			admin.Get("/oauth/clients", oauthHandler.ListClientsHandler)
+			admin.Post("/oauth/clients", oauthHandler.RegisterClientHandler)
+			admin.Delete("/oauth/clients/{client_id}", oauthHandler.RevokeClientHandler)
+		})
 	})
 
 	logs.Info.Printf("Auth service running on port %s", ":8081")
@@ -50,6 +317,106 @@ func main() {
 	logs.Info.Fatalf("Can't start server: %v", err)
 }
 
+func newMailer(cfg map[string]string, logs *logger.Logger) mailer.Mailer {
+	switch cfg["MAILER_DRIVER"] {
+	case "smtp":
+		return mailer.NewSMTPMailer(cfg["SMTP_HOST"], config.GetString(cfg, "SMTP_PORT", "1025"), cfg["SMTP_USERNAME"], cfg["SMTP_PASSWORD"],
+			config.GetString(cfg, "MAIL_FROM", "no-reply@finance-app.local"))
+	default:
+		return mailer.NewLogMailer(logs, cfg["MAIL_LOG_DIR"])
+	}
+}
+
+func newWebAuthn(cfg map[string]string, logs *logger.Logger) *webauthn.WebAuthn {
+	webAuthn, err := webauthn.New(&webauthn.Config{
+		RPID:          config.GetString(cfg, "WEBAUTHN_RP_ID", "localhost"),
+		RPDisplayName: config.GetString(cfg, "WEBAUTHN_RP_NAME", "Finance App"),
+		RPOrigins:     strings.Split(config.GetString(cfg, "WEBAUTHN_RP_ORIGINS", "http://localhost:8081"), ","),
+	})
+	if err != nil {
+		logs.Error.Fatalf("invalid WebAuthn configuration: %v", err)
+	}
+	return webAuthn
+}
+
+// newSocialProviders builds the providers listed in SOCIAL_PROVIDERS. The
+// frontend serves the redirect URL and posts code and state to the callback
+// endpoint.
+func newSocialProviders(cfg map[string]string) []*service.SocialProvider {
+	providers := []*service.SocialProvider{}
+	for _, name := range config.SocialProviderNames(cfg) {
+		prefix := "SOCIAL_" + strings.ToUpper(name) + "_"
+		providers = append(providers, service.NewSocialProvider(service.SocialProviderConfig{
+			Name:         name,
+			Issuer:       cfg[prefix+"ISSUER"],
+			ClientID:     cfg[prefix+"CLIENT_ID"],
+			ClientSecret: cfg[prefix+"CLIENT_SECRET"],
+			RedirectURL: config.GetString(cfg, prefix+"REDIRECT_URL",
+				config.GetString(cfg, "APP_BASE_URL", "http://localhost:8081")+"/auth/social/"+name+"/callback"),
+		}))
+	}
+	return providers
+}
+
+func newIDTokenSigner(cfg map[string]string, logs *logger.Logger) *service.IDTokenSigner {
+	var key []byte
+	if path := cfg["OIDC_SIGNING_KEY_FILE"]; path != "" {
+		pemKey, err := os.ReadFile(path)
+		if err != nil {
+			logs.Error.Fatalf("could not read OIDC signing key: %v", err)
+		}
+		key = pemKey
+	} else {
+		logs.Error.Println("OIDC_SIGNING_KEY_FILE is not set, tokens are signed with a temporary key")
+	}
+
+	signer, err := service.NewIDTokenSigner(key, strings.TrimSuffix(config.GetString(cfg, "OIDC_ISSUER", "http://localhost:8081"), "/"))
+	if err != nil {
+		logs.Error.Fatalf("invalid OIDC signing key: %v", err)
+	}
+	return signer
+}
+
+// newRedisClient doesn't connect yet, so it costs nothing when neither the
+// rate limiter nor the event publisher use Redis.
+func newRedisClient(cfg map[string]string) *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr:     config.GetString(cfg, "REDIS_ADDR", "localhost:6379"),
+		Password: cfg["REDIS_PASSWORD"],
+		DB:       config.GetInt(cfg, "REDIS_DB", 0),
+	})
+}
+
+func newRateLimiter(cfg map[string]string, client *redis.Client, logs *logger.Logger) ratelimit.Limiter {
+	if cfg["RATE_LIMIT_BACKEND"] == "memory" {
+		logs.Info.Println("Using in-memory rate limiter")
+		return ratelimit.NewMemoryLimiter()
+	}
+	return ratelimit.NewFallbackLimiter(ratelimit.NewRedisLimiter(client, "auth:ratelimit:"), ratelimit.NewMemoryLimiter(), logs)
+}
+
+// newClientAddressMiddleware reads TRUSTED_PROXIES, the addresses of the load
+// balancers in front of the service. Without it forwarding headers are ignored.
+func newClientAddressMiddleware(cfg map[string]string, logs *logger.Logger) *middleware.ClientAddressMiddleware {
+	trusted, err := config.ParseCIDRs(cfg["TRUSTED_PROXIES"])
+	if err != nil {
+		logs.Error.Fatalf("invalid TRUSTED_PROXIES: %v", err)
+	}
+	return middleware.NewClientAddressMiddleware(trusted)
+}
+
+func newEventPublisher(cfg map[string]string, client *redis.Client, logs *logger.Logger) events.EventPublisher {
+	if cfg["EVENT_PUBLISHER"] == "memory" {
+		logs.Info.Println("Using in-memory event publisher, events are not delivered to other services")
+		return events.NewMemoryPublisher()
+	}
+	return events.NewRedisStreamPublisher(client, events.RedisStreamConfig{
+		Stream:    config.GetString(cfg, "EVENTS_STREAM", "auth:events"),
+		MaxLen:    int64(config.GetInt(cfg, "EVENTS_STREAM_MAXLEN", 100000)),
+		DedupeTTL: config.GetDuration(cfg, "EVENTS_DEDUPE_TTL", 24*time.Hour),
+	})
+}
+
 func connectToDB(config map[string]string, logs *logger.Logger) *sql.DB {
 	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
 		config["POSTGRES_USER"], config["POSTGRES_PASSWORD"], config["POSTGRES_HOST"], config["POSTGRES_PORT"], config["POSTGRES_DB"])
@@ -1,21 +1,189 @@
 package config
 
 import (
-	"auth-service/internal/logger"
+	"fmt"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/ratelimit"
 	"github.com/joho/godotenv"
+	"net"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func LoadConfig(logs *logger.Logger) map[string]string {
 	if err := godotenv.Load("../.env"); err != nil {
 		logs.Error.Println("No .env file found, using system environment variables")
 	}
-	return map[string]string{
-		"POSTGRES_HOST":     os.Getenv("POSTGRES_HOST"),
-		"POSTGRES_PORT":     os.Getenv("POSTGRES_PORT"),
-		"POSTGRES_USER":     os.Getenv("POSTGRES_USER"),
-		"POSTGRES_PASSWORD": os.Getenv("POSTGRES_PASSWORD"),
-		"POSTGRES_DB":       os.Getenv("POSTGRES_DB"),
-		"JWT_SECRET":        os.Getenv("JWT_SECRET"),
+	config := map[string]string{
+		"POSTGRES_HOST":                   os.Getenv("POSTGRES_HOST"),
+		"POSTGRES_PORT":                   os.Getenv("POSTGRES_PORT"),
+		"POSTGRES_USER":                   os.Getenv("POSTGRES_USER"),
+		"POSTGRES_PASSWORD":               os.Getenv("POSTGRES_PASSWORD"),
+		"POSTGRES_DB":                     os.Getenv("POSTGRES_DB"),
+		"JWT_SECRET":                      os.Getenv("JWT_SECRET"),
+		"MAX_FAILED_LOGIN_ATTEMPTS":       os.Getenv("MAX_FAILED_LOGIN_ATTEMPTS"),
+		"ACCOUNT_LOCK_DURATION":           os.Getenv("ACCOUNT_LOCK_DURATION"),
+		"MAX_ACCOUNT_LOCK_DURATION":       os.Getenv("MAX_ACCOUNT_LOCK_DURATION"),
+		"LOGIN_ALERT_LOOKBACK":            os.Getenv("LOGIN_ALERT_LOOKBACK"),
+		"TOKEN_STATE_CACHE_TTL":           os.Getenv("TOKEN_STATE_CACHE_TTL"),
+		"APP_BASE_URL":                    os.Getenv("APP_BASE_URL"),
+		"UNVERIFIED_USER_POLICY":          os.Getenv("UNVERIFIED_USER_POLICY"),
+		"EMAIL_VERIFICATION_TTL":          os.Getenv("EMAIL_VERIFICATION_TTL"),
+		"VERIFICATION_RESEND_DELAY":       os.Getenv("VERIFICATION_RESEND_DELAY"),
+		"PASSWORD_RESET_TTL":              os.Getenv("PASSWORD_RESET_TTL"),
+		"EMAIL_CHANGE_TTL":                os.Getenv("EMAIL_CHANGE_TTL"),
+		"EMAIL_CHANGE_UNDO_TTL":           os.Getenv("EMAIL_CHANGE_UNDO_TTL"),
+		"ACCOUNT_DELETION_GRACE_PERIOD":   os.Getenv("ACCOUNT_DELETION_GRACE_PERIOD"),
+		"ACCOUNT_ERASURE_MODE":            os.Getenv("ACCOUNT_ERASURE_MODE"),
+		"ACCOUNT_ERASURE_INTERVAL":        os.Getenv("ACCOUNT_ERASURE_INTERVAL"),
+		"EXPORT_DIR":                      os.Getenv("EXPORT_DIR"),
+		"EXPORT_LINK_TTL":                 os.Getenv("EXPORT_LINK_TTL"),
+		"EXPORT_POLL_INTERVAL":            os.Getenv("EXPORT_POLL_INTERVAL"),
+		"REGISTRATION_CONCEAL_EXISTING":   os.Getenv("REGISTRATION_CONCEAL_EXISTING"),
+		"PASSWORD_MIN_LENGTH":             os.Getenv("PASSWORD_MIN_LENGTH"),
+		"TOTP_ISSUER":                     os.Getenv("TOTP_ISSUER"),
+		"MFA_CHALLENGE_TTL":               os.Getenv("MFA_CHALLENGE_TTL"),
+		"MFA_ENCRYPTION_KEY":              os.Getenv("MFA_ENCRYPTION_KEY"),
+		"AUDIT_HASH_KEY":                  os.Getenv("AUDIT_HASH_KEY"),
+		"WEBAUTHN_RP_ID":                  os.Getenv("WEBAUTHN_RP_ID"),
+		"WEBAUTHN_RP_NAME":                os.Getenv("WEBAUTHN_RP_NAME"),
+		"WEBAUTHN_RP_ORIGINS":             os.Getenv("WEBAUTHN_RP_ORIGINS"),
+		"WEBAUTHN_CEREMONY_TTL":           os.Getenv("WEBAUTHN_CEREMONY_TTL"),
+		"OAUTH_CONSENT_URL":               os.Getenv("OAUTH_CONSENT_URL"),
+		"OAUTH_CODE_TTL":                  os.Getenv("OAUTH_CODE_TTL"),
+		"OAUTH_REFRESH_TOKEN_TTL":         os.Getenv("OAUTH_REFRESH_TOKEN_TTL"),
+		"OAUTH_INTROSPECTION_CACHE_TTL":   os.Getenv("OAUTH_INTROSPECTION_CACHE_TTL"),
+		"OAUTH_SERVICE_TOKEN_TTL":         os.Getenv("OAUTH_SERVICE_TOKEN_TTL"),
+		"API_KEY_MAX_PER_USER":            os.Getenv("API_KEY_MAX_PER_USER"),
+		"API_KEY_MAX_LIFETIME":            os.Getenv("API_KEY_MAX_LIFETIME"),
+		"OIDC_ISSUER":                     os.Getenv("OIDC_ISSUER"),
+		"OIDC_SIGNING_KEY_FILE":           os.Getenv("OIDC_SIGNING_KEY_FILE"),
+		"ACCESS_TOKEN_AUDIENCE":           os.Getenv("ACCESS_TOKEN_AUDIENCE"),
+		"MAILER_DRIVER":                   os.Getenv("MAILER_DRIVER"),
+		"MAIL_FROM":                       os.Getenv("MAIL_FROM"),
+		"MAIL_LOG_DIR":                    os.Getenv("MAIL_LOG_DIR"),
+		"SMTP_HOST":                       os.Getenv("SMTP_HOST"),
+		"SMTP_PORT":                       os.Getenv("SMTP_PORT"),
+		"SMTP_USERNAME":                   os.Getenv("SMTP_USERNAME"),
+		"SMTP_PASSWORD":                   os.Getenv("SMTP_PASSWORD"),
+		"RATE_LIMIT_BACKEND":              os.Getenv("RATE_LIMIT_BACKEND"),
+		"REDIS_ADDR":                      os.Getenv("REDIS_ADDR"),
+		"TRUSTED_PROXIES":                 os.Getenv("TRUSTED_PROXIES"),
+		"REDIS_PASSWORD":                  os.Getenv("REDIS_PASSWORD"),
+		"REDIS_DB":                        os.Getenv("REDIS_DB"),
+		"EVENT_PUBLISHER":                 os.Getenv("EVENT_PUBLISHER"),
+		"EVENTS_STREAM":                   os.Getenv("EVENTS_STREAM"),
+		"EVENTS_STREAM_MAXLEN":            os.Getenv("EVENTS_STREAM_MAXLEN"),
+		"EVENTS_DEDUPE_TTL":               os.Getenv("EVENTS_DEDUPE_TTL"),
+		"OUTBOX_POLL_INTERVAL":            os.Getenv("OUTBOX_POLL_INTERVAL"),
+		"OUTBOX_BATCH_SIZE":               os.Getenv("OUTBOX_BATCH_SIZE"),
+		"OUTBOX_LEASE":                    os.Getenv("OUTBOX_LEASE"),
+		"OUTBOX_MAX_BACKOFF":              os.Getenv("OUTBOX_MAX_BACKOFF"),
+		"OUTBOX_RETENTION":                os.Getenv("OUTBOX_RETENTION"),
+		"RATE_LIMIT_LOGIN_IP":             os.Getenv("RATE_LIMIT_LOGIN_IP"),
+		"RATE_LIMIT_LOGIN_EMAIL":          os.Getenv("RATE_LIMIT_LOGIN_EMAIL"),
+		"RATE_LIMIT_LOGIN_IP_EMAIL":       os.Getenv("RATE_LIMIT_LOGIN_IP_EMAIL"),
+		"RATE_LIMIT_LOGIN_MFA_IP":         os.Getenv("RATE_LIMIT_LOGIN_MFA_IP"),
+		"RATE_LIMIT_REGISTER_IP":          os.Getenv("RATE_LIMIT_REGISTER_IP"),
+		"RATE_LIMIT_REGISTER_EMAIL":       os.Getenv("RATE_LIMIT_REGISTER_EMAIL"),
+		"RATE_LIMIT_REGISTER_IP_EMAIL":    os.Getenv("RATE_LIMIT_REGISTER_IP_EMAIL"),
+		"RATE_LIMIT_RESEND_IP":            os.Getenv("RATE_LIMIT_RESEND_IP"),
+		"RATE_LIMIT_RESEND_EMAIL":         os.Getenv("RATE_LIMIT_RESEND_EMAIL"),
+		"RATE_LIMIT_REFRESH_IP":           os.Getenv("RATE_LIMIT_REFRESH_IP"),
+		"RATE_LIMIT_PASSWORD_RESET_IP":    os.Getenv("RATE_LIMIT_PASSWORD_RESET_IP"),
+		"RATE_LIMIT_PASSWORD_RESET_EMAIL": os.Getenv("RATE_LIMIT_PASSWORD_RESET_EMAIL"),
+		"RATE_LIMIT_MAGIC_LINK_IP":        os.Getenv("RATE_LIMIT_MAGIC_LINK_IP"),
+		"RATE_LIMIT_MAGIC_LINK_EMAIL":     os.Getenv("RATE_LIMIT_MAGIC_LINK_EMAIL"),
+		"RATE_LIMIT_OAUTH_TOKEN_IP":       os.Getenv("RATE_LIMIT_OAUTH_TOKEN_IP"),
+		"RATE_LIMIT_OAUTH_INTROSPECT_IP":  os.Getenv("RATE_LIMIT_OAUTH_INTROSPECT_IP"),
+		"SOCIAL_PROVIDERS":                os.Getenv("SOCIAL_PROVIDERS"),
+		"SOCIAL_STATE_TTL":                os.Getenv("SOCIAL_STATE_TTL"),
+		"MAGIC_LINK_TTL":                  os.Getenv("MAGIC_LINK_TTL"),
+		"STEP_UP_MAX_AGE":                 os.Getenv("STEP_UP_MAX_AGE"),
+		"STEP_UP_TOKEN_TTL":               os.Getenv("STEP_UP_TOKEN_TTL"),
 	}
+
+	// Every provider listed in SOCIAL_PROVIDERS has its own settings, e.g.
+	// SOCIAL_GOOGLE_ISSUER for "google".
+	for _, name := range SocialProviderNames(config) {
+		prefix := "SOCIAL_" + strings.ToUpper(name) + "_"
+		for _, key := range []string{"ISSUER", "CLIENT_ID", "CLIENT_SECRET", "REDIRECT_URL"} {
+			config[prefix+key] = os.Getenv(prefix + key)
+		}
+	}
+	return config
+}
+
+func SocialProviderNames(config map[string]string) []string {
+	names := []string{}
+	for _, name := range strings.Split(config["SOCIAL_PROVIDERS"], ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func GetInt(config map[string]string, key string, fallback int) int {
+	value, err := strconv.Atoi(config[key])
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func GetDuration(config map[string]string, key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(config[key])
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// ParseCIDRs reads a comma separated list of networks. Single addresses are
+// taken as networks of one.
+func ParseCIDRs(value string) ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// GetRate reads a rate limit written as "<limit>/<window>".
+func GetRate(config map[string]string, key string, fallback ratelimit.Rate) ratelimit.Rate {
+	value, err := ratelimit.ParseRate(config[key])
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func GetString(config map[string]string, key string, fallback string) string {
+	if value := config[key]; value != "" {
+		return value
+	}
+	return fallback
 }
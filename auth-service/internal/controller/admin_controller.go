@@ -0,0 +1,223 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/finance-app/finance-app/auth-service/internal/service"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type AdminController struct {
+	adminService *service.AdminService
+	roleService  *service.RoleService
+	logs         *logger.Logger
+}
+
+func NewAdminHandler(adminService *service.AdminService, roleService *service.RoleService, logs *logger.Logger) *AdminController {
+	return &AdminController{
+		adminService: adminService,
+		roleService:  roleService,
+		logs:         logs,
+	}
+}
+
+func (c *AdminController) ListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := model.UserFilter{
+		Email:  query.Get("email"),
+		Status: query.Get("status"),
+	}
+
+	var err error
+	if filter.CreatedAfter, err = parseDateParam(query.Get("created_after")); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid created_after value")
+		return
+	}
+	if filter.CreatedBefore, err = parseDateParam(query.Get("created_before")); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid created_before value")
+		return
+	}
+
+	page, _ := strconv.Atoi(query.Get("page"))
+	pageSize, _ := strconv.Atoi(query.Get("page_size"))
+
+	users, err := c.adminService.ListUsers(filter, page, pageSize)
+	if err != nil {
+		c.logs.Error.Printf("Error listing users: %v", err)
+		SendErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve users")
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, users)
+}
+
+func (c *AdminController) GetUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	user, err := c.adminService.GetUser(userID)
+	if err != nil {
+		c.sendUserError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, user)
+}
+
+func (c *AdminController) DisableUserHandler(w http.ResponseWriter, r *http.Request) {
+	c.handleUserAction(w, r, c.adminService.DisableUser)
+}
+
+func (c *AdminController) EnableUserHandler(w http.ResponseWriter, r *http.Request) {
+	c.handleUserAction(w, r, c.adminService.EnableUser)
+}
+
+func (c *AdminController) RevokeSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	c.handleUserAction(w, r, c.adminService.RevokeSessions)
+}
+
+func (c *AdminController) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	c.handleUserAction(w, r, c.adminService.DeleteUser)
+}
+
+func (c *AdminController) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	c.handleUserAction(w, r, c.adminService.ResetPassword)
+}
+
+func (c *AdminController) ListRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := c.roleService.ListRoles()
+	if err != nil {
+		c.logs.Error.Printf("Error listing roles: %v", err)
+		SendErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve roles")
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, roles)
+}
+
+func (c *AdminController) GetUserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	roles, err := c.roleService.GetUserRoles(userID)
+	if err != nil {
+		c.sendRoleError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, map[string][]string{"roles": roles})
+}
+
+func (c *AdminController) AssignRoleHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var request model.AssignRole
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		c.logs.Error.Printf("Failed to decode JSON: %v", err)
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid Request Format")
+		return
+	}
+
+	if err := c.roleService.AssignRole(adminID, userID, request.Role, ClientInfo(r)); err != nil {
+		c.sendRoleError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusNoContent, nil)
+}
+
+func (c *AdminController) RemoveRoleHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if err := c.roleService.RemoveRole(adminID, userID, chi.URLParam(r, "role"), ClientInfo(r)); err != nil {
+		c.sendRoleError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusNoContent, nil)
+}
+
+func (c *AdminController) handleUserAction(w http.ResponseWriter, r *http.Request, action func(adminID int, userID int, client model.ClientInfo) error) {
+	adminID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if err := action(adminID, userID, ClientInfo(r)); err != nil {
+		c.sendUserError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusNoContent, nil)
+}
+
+func (c *AdminController) sendUserError(w http.ResponseWriter, err error) {
+	switch err.Error() {
+	case "user not found":
+		SendErrorResponse(w, http.StatusNotFound, "User not found")
+	case "cannot modify own account":
+		SendErrorResponse(w, http.StatusBadRequest, "Admins cannot perform this action on their own account")
+	case "invalid status transition":
+		SendErrorResponse(w, http.StatusConflict, "Account status does not allow this action")
+	default:
+		c.logs.Error.Printf("Error managing user: %v", err)
+		SendErrorResponse(w, http.StatusInternalServerError, "Failed to update user")
+	}
+}
+
+func (c *AdminController) sendRoleError(w http.ResponseWriter, err error) {
+	switch err.Error() {
+	case "role is required":
+		SendErrorResponse(w, http.StatusBadRequest, "Role is required")
+	case "user not found":
+		SendErrorResponse(w, http.StatusNotFound, "User not found")
+	case "role not found":
+		SendErrorResponse(w, http.StatusNotFound, "Role not found")
+	case "role not assigned":
+		SendErrorResponse(w, http.StatusNotFound, "Role is not assigned to user")
+	default:
+		c.logs.Error.Printf("Error managing roles: %v", err)
+		SendErrorResponse(w, http.StatusInternalServerError, "Failed to update roles")
+	}
+}
+
+func parseDateParam(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/finance-app/finance-app/auth-service/internal/service"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+)
+
+type APIKeyController struct {
+	apiKeyService *service.APIKeyService
+	logs          *logger.Logger
+}
+
+func NewAPIKeyHandler(apiKeyService *service.APIKeyService, logs *logger.Logger) *APIKeyController {
+	return &APIKeyController{
+		apiKeyService: apiKeyService,
+		logs:          logs,
+	}
+}
+
+func (c *APIKeyController) ListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	keys, err := c.apiKeyService.ListAPIKeys(userID)
+	if err != nil {
+		c.sendAPIKeyError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, keys)
+}
+
+// CreateAPIKeyHandler responds with the key itself; it cannot be shown again.
+func (c *APIKeyController) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var request model.CreateAPIKey
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		c.logs.Error.Printf("Failed to decode JSON: %v", err)
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid Request Format")
+		return
+	}
+
+	key, err := c.apiKeyService.CreateAPIKey(userID, request)
+	if err != nil {
+		c.sendAPIKeyError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusCreated, key)
+}
+
+func (c *APIKeyController) RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	keyID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid API key ID")
+		return
+	}
+
+	if err := c.apiKeyService.RevokeAPIKey(userID, keyID); err != nil {
+		c.sendAPIKeyError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusNoContent, nil)
+}
+
+func (c *APIKeyController) sendAPIKeyError(w http.ResponseWriter, err error) {
+	switch err.Error() {
+	case "invalid name":
+		SendErrorResponse(w, http.StatusBadRequest, "Name is required and must be at most 100 characters")
+	case "invalid scope":
+		SendErrorResponse(w, http.StatusBadRequest, "Scopes must be permissions you hold")
+	case "invalid expiry":
+		SendErrorResponse(w, http.StatusBadRequest, "Expiry must be in the future and within the allowed key lifetime")
+	case "too many api keys":
+		SendErrorResponse(w, http.StatusConflict, "Too many active API keys, revoke one first")
+	case "api key not found":
+		SendErrorResponse(w, http.StatusNotFound, "API key not found")
+	default:
+		c.logs.Error.Printf("API key error: %v", err)
+		SendErrorResponse(w, http.StatusInternalServerError, "Something went wrong, please try again later")
+	}
+}
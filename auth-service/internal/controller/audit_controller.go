@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/finance-app/finance-app/auth-service/internal/service"
+	"net/http"
+	"strconv"
+)
+
+type AuditController struct {
+	audit *service.AuditLog
+	logs  *logger.Logger
+}
+
+func NewAuditHandler(audit *service.AuditLog, logs *logger.Logger) *AuditController {
+	return &AuditController{
+		audit: audit,
+		logs:  logs,
+	}
+}
+
+func (c *AuditController) ActivityHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+
+	activity, err := c.audit.ListActivity(userID, page, pageSize)
+	if err != nil {
+		c.logs.Error.Printf("Error listing activity: %v", err)
+		SendErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve activity")
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, activity)
+}
+
+func (c *AuditController) ListEventsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := model.AuditFilter{
+		Type:      query.Get("type"),
+		RequestID: query.Get("request_id"),
+	}
+
+	var err error
+	if filter.ActorID, err = parseIDParam(query.Get("actor_id")); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid actor_id value")
+		return
+	}
+	if filter.TargetID, err = parseIDParam(query.Get("target_id")); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid target_id value")
+		return
+	}
+	if filter.From, err = parseDateParam(query.Get("from")); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid from value")
+		return
+	}
+	if filter.To, err = parseDateParam(query.Get("to")); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid to value")
+		return
+	}
+
+	page, _ := strconv.Atoi(query.Get("page"))
+	pageSize, _ := strconv.Atoi(query.Get("page_size"))
+
+	events, err := c.audit.ListEvents(filter, page, pageSize)
+	if err != nil {
+		c.logs.Error.Printf("Error listing audit events: %v", err)
+		SendErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve audit events")
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, events)
+}
+
+func (c *AuditController) VerifyChainHandler(w http.ResponseWriter, r *http.Request) {
+	result, err := c.audit.VerifyChain()
+	if err != nil {
+		c.logs.Error.Printf("Error verifying audit chain: %v", err)
+		SendErrorResponse(w, http.StatusInternalServerError, "Failed to verify audit log")
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, result)
+}
+
+func parseIDParam(value string) (*int, error) {
+	if value == "" {
+		return nil, nil
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Profile ETags are derived from updated_at, which Postgres stores with
+// microsecond precision.
+func setETag(w http.ResponseWriter, updatedAt time.Time) {
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, updatedAt.UnixMicro()))
+}
+
+func parseETag(value string) (*time.Time, error) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "W/")
+	value = strings.Trim(value, `"`)
+	micros, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid etag")
+	}
+	t := time.UnixMicro(micros)
+	return &t, nil
+}
@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/finance-app/finance-app/auth-service/internal/service"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+type ExportController struct {
+	exportService *service.ExportService
+	logs          *logger.Logger
+}
+
+func NewExportHandler(exportService *service.ExportService, logs *logger.Logger) *ExportController {
+	return &ExportController{
+		exportService: exportService,
+		logs:          logs,
+	}
+}
+
+// ExportHandler returns the export right away as JSON. Zip bundles, or any
+// request with async=true, are generated in the background instead.
+func (c *ExportController) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = model.ExportFormatJSON
+	}
+
+	if format == model.ExportFormatZip || r.URL.Query().Get("async") == "true" {
+		job, err := c.exportService.RequestExport(userID, format)
+		if err != nil {
+			c.sendExportError(w, err)
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/api/v1/auth/users/me/exports/%d", job.ID))
+		SendSuccessResponse(w, http.StatusAccepted, job)
+		return
+	}
+	if format != model.ExportFormatJSON {
+		SendErrorResponse(w, http.StatusBadRequest, "Unsupported export format")
+		return
+	}
+
+	export, err := c.exportService.BuildExport(userID)
+	if err != nil {
+		c.sendExportError(w, err)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="export-%s.json"`, time.Now().Format("20060102")))
+	SendSuccessResponse(w, http.StatusOK, export)
+}
+
+func (c *ExportController) GetExportJobHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	jobID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid export ID")
+		return
+	}
+
+	job, err := c.exportService.GetExportJob(userID, jobID)
+	if err != nil {
+		c.sendExportError(w, err)
+		return
+	}
+	if job.Status == model.ExportStatusReady {
+		job.DownloadURL = fmt.Sprintf("/api/v1/auth/users/me/exports/%d/download", job.ID)
+	}
+	SendSuccessResponse(w, http.StatusOK, job)
+}
+
+func (c *ExportController) DownloadUserExportHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	jobID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid export ID")
+		return
+	}
+
+	job, err := c.exportService.GetUserDownload(userID, jobID)
+	if err != nil {
+		c.sendExportError(w, err)
+		return
+	}
+	serveExport(w, r, job)
+}
+
+func (c *ExportController) DownloadExportHandler(w http.ResponseWriter, r *http.Request) {
+	job, err := c.exportService.GetDownload(r.URL.Query().Get("token"))
+	if err != nil {
+		c.sendExportError(w, err)
+		return
+	}
+	serveExport(w, r, job)
+}
+
+func (c *ExportController) sendExportError(w http.ResponseWriter, err error) {
+	switch err.Error() {
+	case "invalid export format":
+		SendErrorResponse(w, http.StatusBadRequest, "Unsupported export format")
+	case "export not found", "user not found":
+		SendErrorResponse(w, http.StatusNotFound, "Export not found or expired")
+	case "export not ready":
+		SendErrorResponse(w, http.StatusConflict, "Export is not ready for download")
+	default:
+		c.logs.Error.Printf("Error exporting user data: %v", err)
+		SendErrorResponse(w, http.StatusInternalServerError, "Failed to export user data")
+	}
+}
+
+func serveExport(w http.ResponseWriter, r *http.Request, job *model.ExportJob) {
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="export-%d%s"`, job.ID, filepath.Ext(job.FilePath)))
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeFile(w, r, job.FilePath)
+}
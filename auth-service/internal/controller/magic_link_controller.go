@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"net/http"
+)
+
+// magicLinkCookie binds a magic link to the browser that asked for it. It is
+// scoped to the magic link endpoints and never readable by scripts.
+const magicLinkCookie = "magic_link_nonce"
+
+func (c *UserController) RequestMagicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	var request model.EmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		c.logs.Error.Printf("Failed to decode JSON: %v", err)
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid Request Format")
+		return
+	}
+
+	nonce, err := c.userService.RequestMagicLink(request.Email)
+	if err != nil {
+		c.logs.Error.Printf("Error requesting magic link: %v", err)
+		SendErrorResponse(w, http.StatusInternalServerError, "Something went wrong, please try again later")
+		return
+	}
+	setMagicLinkCookie(w, r, nonce, 0)
+	SendSuccessResponse(w, http.StatusAccepted, map[string]string{
+		"message": "If an account with this email exists, a sign-in link has been sent",
+	})
+}
+
+func (c *UserController) ConsumeMagicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	var request model.MagicLinkLogin
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		c.logs.Error.Printf("Failed to decode JSON: %v", err)
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid Request Format")
+		return
+	}
+	if cookie, err := r.Cookie(magicLinkCookie); err == nil {
+		request.Nonce = cookie.Value
+	}
+
+	request.Client = ClientInfo(r)
+	tokens, challenge, err := c.userService.ConsumeMagicLink(request)
+	if err != nil {
+		switch err.Error() {
+		case "invalid magic link", "user not found":
+			SendErrorResponse(w, http.StatusUnauthorized, "Sign-in link is invalid or has expired, or was opened in another browser")
+		case "account disabled":
+			SendErrorResponse(w, http.StatusForbidden, "Account is disabled")
+		case "account locked":
+			SendErrorResponse(w, http.StatusLocked, "Account is temporarily locked, please try again later")
+		case "account not verified":
+			SendErrorResponse(w, http.StatusForbidden, "Account is pending verification")
+		default:
+			c.logs.Error.Printf("Error in magic link login: %v", err)
+			SendErrorResponse(w, http.StatusInternalServerError, "Login failed, please try again later")
+		}
+		return
+	}
+	setMagicLinkCookie(w, r, "", -1)
+
+	if challenge != nil {
+		SendSuccessResponse(w, http.StatusOK, challenge)
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, tokens)
+}
+
+func setMagicLinkCookie(w http.ResponseWriter, r *http.Request, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     magicLinkCookie,
+		Value:    value,
+		Path:     "/api/v1/auth/magic-link",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,281 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+)
+
+func (c *UserController) LoginMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var request model.MFALogin
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		c.logs.Error.Printf("Failed to decode JSON: %v", err)
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid Request Format")
+		return
+	}
+
+	request.Client = ClientInfo(r)
+	tokens, err := c.userService.CompleteMFALogin(request)
+	if err != nil {
+		c.sendMFAError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, tokens)
+}
+
+func (c *UserController) GetMFAStatusHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	status, err := c.userService.GetMFAStatus(userID)
+	if err != nil {
+		c.sendMFAError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, status)
+}
+
+func (c *UserController) EnrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	enrollment, err := c.userService.EnrollTOTP(userID)
+	if err != nil {
+		c.sendMFAError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, enrollment)
+}
+
+func (c *UserController) ConfirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var request model.MFACode
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		c.logs.Error.Printf("Failed to decode JSON: %v", err)
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid Request Format")
+		return
+	}
+
+	codes, err := c.userService.ConfirmTOTP(userID, request.Code)
+	if err != nil {
+		c.sendMFAError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, codes)
+}
+
+func (c *UserController) DisableMFAHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var request model.DisableMFA
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		c.logs.Error.Printf("Failed to decode JSON: %v", err)
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid Request Format")
+		return
+	}
+	request.Client = ClientInfo(r)
+
+	if err := c.userService.DisableMFA(userID, request); err != nil {
+		c.sendMFAError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusNoContent, nil)
+}
+
+func (c *UserController) RegenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var request model.MFACode
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		c.logs.Error.Printf("Failed to decode JSON: %v", err)
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid Request Format")
+		return
+	}
+	request.Client = ClientInfo(r)
+
+	codes, err := c.userService.RegenerateRecoveryCodes(userID, request)
+	if err != nil {
+		c.sendMFAError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, codes)
+}
+
+func (c *UserController) sendMFAError(w http.ResponseWriter, err error) {
+	switch err.Error() {
+	case "invalid mfa token":
+		SendErrorResponse(w, http.StatusUnauthorized, "MFA challenge is invalid or has expired, please log in again")
+	case "invalid mfa code":
+		SendErrorResponse(w, http.StatusUnauthorized, "Invalid authentication code")
+	case "wrong user password":
+		SendErrorResponse(w, http.StatusForbidden, "Current password is incorrect")
+	case "wrong credentials":
+		SendErrorResponse(w, http.StatusUnauthorized, "Password or authentication code is incorrect")
+	case "mfa already enabled":
+		SendErrorResponse(w, http.StatusConflict, "Two-factor authentication is already enabled")
+	case "mfa not enrolled":
+		SendErrorResponse(w, http.StatusConflict, "Start the enrollment first")
+	case "mfa not enabled":
+		SendErrorResponse(w, http.StatusConflict, "Two-factor authentication is not enabled")
+	case "invalid ceremony":
+		SendErrorResponse(w, http.StatusBadRequest, "Passkey ceremony is invalid or has expired, please start again")
+	case "invalid passkey":
+		SendErrorResponse(w, http.StatusUnauthorized, "Passkey could not be verified")
+	case "passkey not found":
+		SendErrorResponse(w, http.StatusNotFound, "Passkey not found")
+	case "invalid name":
+		SendErrorResponse(w, http.StatusBadRequest, "Passkey name is too long")
+	case "account locked":
+		SendErrorResponse(w, http.StatusLocked, "Account is temporarily locked, please try again later")
+	case "account disabled":
+		SendErrorResponse(w, http.StatusForbidden, "Account is disabled")
+	case "account not verified":
+		SendErrorResponse(w, http.StatusForbidden, "Account is pending verification")
+	case "user not found":
+		SendErrorResponse(w, http.StatusNotFound, "User not found")
+	default:
+		c.logs.Error.Printf("MFA error: %v", err)
+		SendErrorResponse(w, http.StatusInternalServerError, "Something went wrong, please try again later")
+	}
+}
+
+func (c *UserController) ListPasskeysHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	passkeys, err := c.userService.ListPasskeys(userID)
+	if err != nil {
+		c.sendMFAError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, passkeys)
+}
+
+func (c *UserController) BeginPasskeyRegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var request model.BeginPasskeyRegistration
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		c.logs.Error.Printf("Failed to decode JSON: %v", err)
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid Request Format")
+		return
+	}
+
+	ceremony, err := c.userService.BeginPasskeyRegistration(userID, request.Name)
+	if err != nil {
+		c.sendMFAError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, ceremony)
+}
+
+func (c *UserController) FinishPasskeyRegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var request model.PasskeyRegistration
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		c.logs.Error.Printf("Failed to decode JSON: %v", err)
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid Request Format")
+		return
+	}
+
+	registered, err := c.userService.FinishPasskeyRegistration(userID, request)
+	if err != nil {
+		c.sendMFAError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusCreated, registered)
+}
+
+func (c *UserController) DeletePasskeyHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	passkeyID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid passkey ID")
+		return
+	}
+	if err := c.userService.DeletePasskey(userID, passkeyID); err != nil {
+		c.sendMFAError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusNoContent, nil)
+}
+
+func (c *UserController) BeginPasskeyLoginHandler(w http.ResponseWriter, r *http.Request) {
+	ceremony, err := c.userService.BeginPasskeyLogin()
+	if err != nil {
+		c.sendMFAError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, ceremony)
+}
+
+func (c *UserController) FinishPasskeyLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var request model.PasskeyLogin
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		c.logs.Error.Printf("Failed to decode JSON: %v", err)
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid Request Format")
+		return
+	}
+
+	request.Client = ClientInfo(r)
+	tokens, err := c.userService.FinishPasskeyLogin(request)
+	if err != nil {
+		c.sendMFAError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, tokens)
+}
+
+func (c *UserController) BeginPasskeyMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var request model.PasskeyMFABegin
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		c.logs.Error.Printf("Failed to decode JSON: %v", err)
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid Request Format")
+		return
+	}
+
+	ceremony, err := c.userService.BeginPasskeyMFA(request)
+	if err != nil {
+		c.sendMFAError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, ceremony)
+}
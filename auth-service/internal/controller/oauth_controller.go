@@ -0,0 +1,283 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/finance-app/finance-app/auth-service/internal/service"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type OAuthController struct {
+	oauthService *service.OAuthService
+	logs         *logger.Logger
+}
+
+func NewOAuthHandler(oauthService *service.OAuthService, logs *logger.Logger) *OAuthController {
+	return &OAuthController{
+		oauthService: oauthService,
+		logs:         logs,
+	}
+}
+
+// AuthorizeHandler checks the request before the user sees anything. Errors
+// about the client or redirect URI are shown here; everything else goes back
+// to the client. Valid requests continue on the consent screen.
+func (c *OAuthController) AuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	request := authorizationRequest(r.URL.Query())
+	if _, _, err := c.oauthService.ValidateAuthorizationRequest(&request); err != nil {
+		switch err.Error() {
+		case "invalid client":
+			SendErrorResponse(w, http.StatusBadRequest, "Unknown or revoked client")
+		case "invalid redirect uri":
+			SendErrorResponse(w, http.StatusBadRequest, "Redirect URI is not registered for this client")
+		case "database error":
+			SendErrorResponse(w, http.StatusInternalServerError, "server_error")
+		default:
+			http.Redirect(w, r, service.AuthorizationErrorRedirect(request, err.Error()), http.StatusFound)
+		}
+		return
+	}
+	http.Redirect(w, r, c.oauthService.ConsentRedirect(r.URL.RawQuery), http.StatusFound)
+}
+
+func (c *OAuthController) ConsentPromptHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	prompt, err := c.oauthService.GetConsentPrompt(userID, authorizationRequest(r.URL.Query()))
+	if err != nil {
+		c.sendConsentError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, prompt)
+}
+
+func (c *OAuthController) ConsentHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value("claims").(*service.AccessClaims)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var request model.ConsentDecision
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		c.logs.Error.Printf("Failed to decode JSON: %v", err)
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid Request Format")
+		return
+	}
+
+	result, err := c.oauthService.DecideConsent(claims.UserID, claims.AuthTime, request)
+	if err != nil {
+		c.sendConsentError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, result)
+}
+
+func (c *OAuthController) TokenHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+	clientID, clientSecret := clientCredentials(r)
+	request := model.TokenRequest{
+		GrantType:    r.PostForm.Get("grant_type"),
+		Code:         r.PostForm.Get("code"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+		RefreshToken: r.PostForm.Get("refresh_token"),
+		Scope:        r.PostForm.Get("scope"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	tokens, err := c.oauthService.Token(request)
+	if err != nil {
+		c.sendTokenError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, tokens)
+}
+
+func (c *OAuthController) RevokeHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+	clientID, clientSecret := clientCredentials(r)
+
+	if err := c.oauthService.Revoke(clientID, clientSecret, r.PostForm.Get("token")); err != nil {
+		c.sendTokenError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *OAuthController) IntrospectHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+	clientID, clientSecret := clientCredentials(r)
+
+	w.Header().Set("Cache-Control", "no-store")
+	result, err := c.oauthService.Introspect(clientID, clientSecret, r.PostForm.Get("token"), r.PostForm.Get("token_type_hint"))
+	if err != nil {
+		c.sendTokenError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, result)
+}
+
+func (c *OAuthController) DiscoveryHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	SendSuccessResponse(w, http.StatusOK, c.oauthService.Discovery())
+}
+
+func (c *OAuthController) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	SendSuccessResponse(w, http.StatusOK, c.oauthService.JWKS())
+}
+
+// UserInfoHandler must be mounted after AuthenticateDelegated.
+func (c *OAuthController) UserInfoHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value("claims").(*service.AccessClaims)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "invalid_token")
+		return
+	}
+
+	userInfo, err := c.oauthService.UserInfo(claims)
+	if err != nil {
+		switch err.Error() {
+		case "insufficient_scope":
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+			SendErrorResponse(w, http.StatusForbidden, err.Error())
+		case "invalid_token":
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			SendErrorResponse(w, http.StatusUnauthorized, err.Error())
+		default:
+			c.logs.Error.Printf("Error in userinfo endpoint: %v", err)
+			SendErrorResponse(w, http.StatusInternalServerError, "server_error")
+		}
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	SendSuccessResponse(w, http.StatusOK, userInfo)
+}
+
+func (c *OAuthController) ListClientsHandler(w http.ResponseWriter, r *http.Request) {
+	clients, err := c.oauthService.ListClients()
+	if err != nil {
+		c.logs.Error.Printf("Error listing OAuth clients: %v", err)
+		SendErrorResponse(w, http.StatusInternalServerError, "Failed to list clients")
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, clients)
+}
+
+func (c *OAuthController) RegisterClientHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var request model.RegisterOAuthClient
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		c.logs.Error.Printf("Failed to decode JSON: %v", err)
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid Request Format")
+		return
+	}
+
+	client, err := c.oauthService.RegisterClient(adminID, request)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "invalid client metadata") {
+			SendErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		c.logs.Error.Printf("Error registering OAuth client: %v", err)
+		SendErrorResponse(w, http.StatusInternalServerError, "Failed to register client")
+		return
+	}
+	SendSuccessResponse(w, http.StatusCreated, client)
+}
+
+func (c *OAuthController) RevokeClientHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	if err := c.oauthService.RevokeClient(adminID, chi.URLParam(r, "client_id")); err != nil {
+		if err.Error() == "client not found" {
+			SendErrorResponse(w, http.StatusNotFound, "Client not found")
+			return
+		}
+		c.logs.Error.Printf("Error revoking OAuth client: %v", err)
+		SendErrorResponse(w, http.StatusInternalServerError, "Failed to revoke client")
+		return
+	}
+	SendSuccessResponse(w, http.StatusNoContent, nil)
+}
+
+func (c *OAuthController) sendConsentError(w http.ResponseWriter, err error) {
+	switch err.Error() {
+	case "invalid client":
+		SendErrorResponse(w, http.StatusBadRequest, "Unknown or revoked client")
+	case "invalid redirect uri":
+		SendErrorResponse(w, http.StatusBadRequest, "Redirect URI is not registered for this client")
+	case "unsupported_response_type", "unauthorized_client", "invalid_request", "invalid_scope":
+		SendErrorResponse(w, http.StatusBadRequest, err.Error())
+	default:
+		c.logs.Error.Printf("Error handling OAuth consent: %v", err)
+		SendErrorResponse(w, http.StatusInternalServerError, "Failed to process consent")
+	}
+}
+
+// sendTokenError answers in the RFC 6749 format, which the error response
+// already matches: {"error": "<code>"}.
+func (c *OAuthController) sendTokenError(w http.ResponseWriter, err error) {
+	switch err.Error() {
+	case "invalid_client":
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		SendErrorResponse(w, http.StatusUnauthorized, err.Error())
+	case "invalid_request", "invalid_grant", "unauthorized_client", "unsupported_grant_type", "invalid_scope":
+		SendErrorResponse(w, http.StatusBadRequest, err.Error())
+	default:
+		c.logs.Error.Printf("Error in OAuth token endpoint: %v", err)
+		SendErrorResponse(w, http.StatusInternalServerError, "server_error")
+	}
+}
+
+func authorizationRequest(query url.Values) model.AuthorizationRequest {
+	return model.AuthorizationRequest{
+		ResponseType:        query.Get("response_type"),
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+		Nonce:               query.Get("nonce"),
+	}
+}
+
+// clientCredentials accepts client_secret_basic as well as client_secret_post.
+func clientCredentials(r *http.Request) (string, string) {
+	if clientID, clientSecret, ok := r.BasicAuth(); ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+		return clientID, clientSecret
+	}
+	return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+}
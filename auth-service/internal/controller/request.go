@@ -0,0 +1,29 @@
+package controller
+
+import (
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"net"
+	"net/http"
+)
+
+// ClientInfo reads the address and country that ClientAddressMiddleware
+// resolved. Without it only the peer address is known. The request ID comes
+// from the chi RequestID middleware, which keeps an X-Request-Id set by the
+// proxy.
+func ClientInfo(r *http.Request) model.ClientInfo {
+	ip, ok := r.Context().Value("client_ip").(string)
+	if !ok {
+		ip = r.RemoteAddr
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			ip = host
+		}
+	}
+	country, _ := r.Context().Value("client_country").(string)
+	return model.ClientInfo{
+		IP:        ip,
+		UserAgent: r.UserAgent(),
+		Country:   country,
+		RequestID: chimiddleware.GetReqID(r.Context()),
+	}
+}
@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+)
+
+func (c *UserController) ListSocialProvidersHandler(w http.ResponseWriter, r *http.Request) {
+	SendSuccessResponse(w, http.StatusOK, map[string][]string{"providers": c.userService.SocialProviders()})
+}
+
+func (c *UserController) BeginSocialLoginHandler(w http.ResponseWriter, r *http.Request) {
+	authorization, err := c.userService.BeginSocialLogin(chi.URLParam(r, "provider"))
+	if err != nil {
+		c.sendSocialError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, authorization)
+}
+
+func (c *UserController) FinishSocialLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var request model.SocialCallback
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		c.logs.Error.Printf("Failed to decode JSON: %v", err)
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid Request Format")
+		return
+	}
+
+	request.Client = ClientInfo(r)
+	tokens, challenge, err := c.userService.FinishSocialLogin(chi.URLParam(r, "provider"), request)
+	if err != nil {
+		c.sendSocialError(w, err)
+		return
+	}
+	if challenge != nil {
+		SendSuccessResponse(w, http.StatusOK, challenge)
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, tokens)
+}
+
+func (c *UserController) ListIdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	identities, err := c.userService.ListIdentities(userID)
+	if err != nil {
+		c.sendSocialError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, identities)
+}
+
+func (c *UserController) BeginIdentityLinkHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	authorization, err := c.userService.BeginIdentityLink(userID, chi.URLParam(r, "provider"))
+	if err != nil {
+		c.sendSocialError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, authorization)
+}
+
+func (c *UserController) LinkIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var request model.SocialCallback
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		c.logs.Error.Printf("Failed to decode JSON: %v", err)
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid Request Format")
+		return
+	}
+
+	identity, err := c.userService.LinkIdentity(userID, chi.URLParam(r, "provider"), request)
+	if err != nil {
+		c.sendSocialError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusCreated, identity)
+}
+
+func (c *UserController) UnlinkIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	identityID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid identity ID")
+		return
+	}
+
+	if err := c.userService.UnlinkIdentity(userID, identityID); err != nil {
+		c.sendSocialError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusNoContent, nil)
+}
+
+func (c *UserController) sendSocialError(w http.ResponseWriter, err error) {
+	switch err.Error() {
+	case "unknown provider":
+		SendErrorResponse(w, http.StatusNotFound, "Sign-in provider is not configured")
+	case "provider unavailable":
+		SendErrorResponse(w, http.StatusBadGateway, "Sign-in provider is unavailable, please try again later")
+	case "invalid social state":
+		SendErrorResponse(w, http.StatusBadRequest, "Sign-in request is invalid or has expired, please start again")
+	case "social login failed":
+		SendErrorResponse(w, http.StatusUnauthorized, "Sign-in with the provider could not be verified")
+	case "email not verified by provider":
+		SendErrorResponse(w, http.StatusForbidden, "The provider did not confirm your email address")
+	case "account exists":
+		SendErrorResponse(w, http.StatusConflict, "An account with this email already exists, sign in and link the provider in your settings")
+	case "identity already linked":
+		SendErrorResponse(w, http.StatusConflict, "This provider account is already linked")
+	case "identity not found":
+		SendErrorResponse(w, http.StatusNotFound, "Identity not found")
+	case "last sign-in method":
+		SendErrorResponse(w, http.StatusConflict, "Set a password or add a passkey before unlinking your last sign-in provider")
+	case "account locked":
+		SendErrorResponse(w, http.StatusLocked, "Account is temporarily locked, please try again later")
+	case "account disabled":
+		SendErrorResponse(w, http.StatusForbidden, "Account is disabled")
+	case "account not verified":
+		SendErrorResponse(w, http.StatusForbidden, "Account is pending verification")
+	case "user not found":
+		SendErrorResponse(w, http.StatusNotFound, "User not found")
+	default:
+		c.logs.Error.Printf("Social login error: %v", err)
+		SendErrorResponse(w, http.StatusInternalServerError, "Something went wrong, please try again later")
+	}
+}
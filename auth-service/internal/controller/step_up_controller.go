@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"net/http"
+)
+
+// ReauthenticateHandler answers a step-up challenge with an elevated token.
+func (c *UserController) ReauthenticateHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var request model.Reauthenticate
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		c.logs.Error.Printf("Failed to decode JSON: %v", err)
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid Request Format")
+		return
+	}
+
+	request.Client = ClientInfo(r)
+	token, err := c.userService.Reauthenticate(userID, request)
+	if err != nil {
+		if err.Error() == "no authentication factor" {
+			SendErrorResponse(w, http.StatusBadRequest, "Provide your password, an authentication code or a passkey")
+			return
+		}
+		c.sendMFAError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, token)
+}
+
+func (c *UserController) BeginPasskeyReauthenticationHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	ceremony, err := c.userService.BeginPasskeyReauthentication(userID)
+	if err != nil {
+		c.sendMFAError(w, err)
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, ceremony)
+}
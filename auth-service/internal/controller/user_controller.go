@@ -1,11 +1,12 @@
 package controller
 
 import (
-	"auth-service/internal/logger"
-	"auth-service/internal/model"
-	"auth-service/internal/service"
 	"encoding/json"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/finance-app/finance-app/auth-service/internal/service"
 	"net/http"
+	"strings"
 )
 
 type UserController struct {
@@ -30,17 +31,29 @@ func (c *UserController) RegisterHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	createdUser, err := c.userService.RegisterUser(user)
+	createdUser, err := c.userService.RegisterUser(user, ClientInfo(r))
 	if err != nil {
 		if err.Error() == "user already exists" {
 			c.logs.Info.Printf("Attempt to register existing user: %s", user.Email)
 			SendErrorResponse(w, http.StatusConflict, "User with this email already exists")
 			return
 		}
+		if strings.HasPrefix(err.Error(), "weak password") {
+			SendErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		c.logs.Error.Printf("Registration error: %v", err)
 		SendErrorResponse(w, http.StatusInternalServerError, "Registration failed, please try again later")
 		return
 	}
+	// Without the ID, the response for a taken address can't be told apart.
+	if c.userService.ConcealsExistingAccounts() {
+		SendSuccessResponse(w, http.StatusAccepted, model.RegisterResponse{
+			Name:  user.Name,
+			Email: user.Email,
+		})
+		return
+	}
 	c.logs.Info.Printf("User registered successfully: ID=%d, Email=%s", createdUser.ID, createdUser.Email)
 	SendSuccessResponse(w, http.StatusCreated, model.RegisterResponse{
 		ID:    createdUser.ID,
@@ -59,14 +72,21 @@ func (c *UserController) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tokens, err := c.userService.LoginUser(loginInfo)
+	loginInfo.Client = ClientInfo(r)
+	tokens, challenge, err := c.userService.LoginUser(loginInfo)
 	if err != nil {
 		statusCode := http.StatusInternalServerError
 		errorMessage := "Login failed, please try again later"
 
-		if err.Error() == "user not found" || err.Error() == "wrong user password" {
+		if err.Error() == "wrong user password" {
 			statusCode = http.StatusUnauthorized
 			errorMessage = "Invalid email or password"
+		} else if err.Error() == "account disabled" {
+			statusCode = http.StatusForbidden
+			errorMessage = "Account is disabled"
+		} else if err.Error() == "account not verified" {
+			statusCode = http.StatusForbidden
+			errorMessage = "Account is pending verification"
 		}
 
 		SendErrorResponse(w, statusCode, errorMessage)
@@ -74,6 +94,10 @@ func (c *UserController) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if challenge != nil {
+		SendSuccessResponse(w, http.StatusOK, challenge)
+		return
+	}
 	SendSuccessResponse(w, http.StatusOK, tokens)
 }
 
@@ -89,13 +113,19 @@ func (c *UserController) RefreshTokenHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	tokens, err := c.userService.RefreshAccessToken(request.RefreshToken)
+	tokens, err := c.userService.RefreshAccessToken(request.RefreshToken, ClientInfo(r))
 	if err != nil {
 		statusCode := http.StatusUnauthorized
 		errorMessage := "Invalid refresh token"
 
 		if err.Error() == "refresh token not found" {
 			statusCode = http.StatusUnauthorized
+		} else if err.Error() == "account disabled" {
+			statusCode = http.StatusForbidden
+			errorMessage = "Account is disabled"
+		} else if err.Error() == "account not verified" {
+			statusCode = http.StatusForbidden
+			errorMessage = "Account is pending verification"
 		} else if err.Error() == "database error" {
 			statusCode = http.StatusInternalServerError
 			errorMessage = "Something went wrong, please try again later"
@@ -110,6 +140,24 @@ func (c *UserController) RefreshTokenHandler(w http.ResponseWriter, r *http.Requ
 
 }
 
+func (c *UserController) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		c.logs.Error.Printf("Failed to decode JSON: %v", err)
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid Request Format")
+		return
+	}
+
+	if err := c.userService.Logout(request.RefreshToken, ClientInfo(r)); err != nil {
+		c.logs.Error.Printf("Error logging out: %v", err)
+		SendErrorResponse(w, http.StatusInternalServerError, "Something went wrong, please try again later")
+		return
+	}
+	SendSuccessResponse(w, http.StatusNoContent, nil)
+}
+
 func (c *UserController) GetCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("user_id").(int)
 	if !ok {
@@ -123,15 +171,13 @@ func (c *UserController) GetCurrentUserHandler(w http.ResponseWriter, r *http.Re
 		SendErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve user")
 		return
 	}
-
-	userInfo := model.UserInfo{
-		ID:        user.ID,
-		Name:      user.Name,
-		Email:     user.Email,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
+	if user == nil {
+		SendErrorResponse(w, http.StatusNotFound, "User not found")
+		return
 	}
-	SendSuccessResponse(w, http.StatusOK, userInfo)
+
+	setETag(w, user.UpdatedAt)
+	SendSuccessResponse(w, http.StatusOK, user.ToInfo())
 }
 
 func (c *UserController) UpdateCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -141,30 +187,47 @@ func (c *UserController) UpdateCurrentUserHandler(w http.ResponseWriter, r *http
 		return
 	}
 
-	var updateData struct {
-		Name  string `json:"name"`
-		Email string `json:"email"`
-	}
-
-	err := json.NewDecoder(r.Body).Decode(&updateData)
+	var updateData model.UserUpdate
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&updateData)
 	if err != nil {
 		c.logs.Error.Printf("Failed to decode JSON: %v", err)
 		SendErrorResponse(w, http.StatusBadRequest, "Invalid Request Format")
 		return
 	}
 
-	updateUserInfo, err := c.userService.UpdateCurrentUser(userID, updateData.Name, updateData.Email)
+	expectedUpdatedAt := updateData.UpdatedAt
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != "*" {
+		expectedUpdatedAt, err = parseETag(ifMatch)
+		if err != nil {
+			SendErrorResponse(w, http.StatusPreconditionFailed, "Invalid If-Match header")
+			return
+		}
+	}
+
+	user, err := c.userService.UpdateCurrentUser(userID, updateData, expectedUpdatedAt, ClientInfo(r))
 	if err != nil {
-		if err.Error() == "email already in use" {
-			SendErrorResponse(w, http.StatusConflict, "Email already in use")
-		} else {
+		switch err.Error() {
+		case "invalid name":
+			SendErrorResponse(w, http.StatusBadRequest, "Name must be between 1 and 255 characters")
+		case "invalid email":
+			SendErrorResponse(w, http.StatusBadRequest, "Invalid email address")
+		case "email change requires confirmation":
+			SendErrorResponse(w, http.StatusConflict, "Email changes must be requested through /users/me/email")
+		case "precondition failed":
+			SendErrorResponse(w, http.StatusPreconditionFailed, "Profile was modified by another request")
+		case "user not found":
+			SendErrorResponse(w, http.StatusNotFound, "User not found")
+		default:
+			c.logs.Error.Printf("Error updating user: %v", err)
 			SendErrorResponse(w, http.StatusInternalServerError, "Failed to update profile")
 		}
-		c.logs.Error.Printf("Error updating user: %v", err)
 		return
 	}
 
-	SendSuccessResponse(w, http.StatusOK, updateUserInfo)
+	setETag(w, user.UpdatedAt)
+	SendSuccessResponse(w, http.StatusOK, user.ToInfo())
 }
 
 func (c *UserController) DeleteCurrentUser(w http.ResponseWriter, r *http.Request) {
@@ -173,11 +236,244 @@ func (c *UserController) DeleteCurrentUser(w http.ResponseWriter, r *http.Reques
 		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
-	err := c.userService.DeleteCurrentUser(userID)
+
+	var request model.DeleteAccount
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		c.logs.Error.Printf("Failed to decode JSON: %v", err)
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid Request Format")
+		return
+	}
+
+	scheduledAt, err := c.userService.DeleteCurrentUser(userID, request.Password, ClientInfo(r))
 	if err != nil {
+		switch err.Error() {
+		case "wrong user password":
+			SendErrorResponse(w, http.StatusForbidden, "Password is incorrect")
+			return
+		case "account locked":
+			SendErrorResponse(w, http.StatusLocked, "Account is temporarily locked, please try again later")
+			return
+		}
 		SendErrorResponse(w, http.StatusInternalServerError, "Failed to delete account")
 		c.logs.Error.Printf("Error deleting user: %v", err)
 		return
 	}
+	SendSuccessResponse(w, http.StatusAccepted, model.DeletionScheduled{DeletionScheduledAt: *scheduledAt})
+}
+
+func (c *UserController) RestoreAccountHandler(w http.ResponseWriter, r *http.Request) {
+	var request model.EmailToken
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		c.logs.Error.Printf("Failed to decode JSON: %v", err)
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid Request Format")
+		return
+	}
+
+	if err := c.userService.RestoreAccount(request.Token, ClientInfo(r)); err != nil {
+		if err.Error() == "invalid restore token" {
+			SendErrorResponse(w, http.StatusBadRequest, "Invalid or expired restore token")
+			return
+		}
+		c.logs.Error.Printf("Error restoring account: %v", err)
+		SendErrorResponse(w, http.StatusInternalServerError, "Something went wrong, please try again later")
+		return
+	}
+	SendSuccessResponse(w, http.StatusNoContent, nil)
+}
+
+func (c *UserController) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var request model.EmailToken
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		c.logs.Error.Printf("Failed to decode JSON: %v", err)
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid Request Format")
+		return
+	}
+
+	if err := c.userService.VerifyEmail(request.Token); err != nil {
+		if err.Error() == "invalid verification token" {
+			SendErrorResponse(w, http.StatusBadRequest, "Invalid or expired verification token")
+			return
+		}
+		c.logs.Error.Printf("Error verifying email: %v", err)
+		SendErrorResponse(w, http.StatusInternalServerError, "Something went wrong, please try again later")
+		return
+	}
+	SendSuccessResponse(w, http.StatusNoContent, nil)
+}
+
+func (c *UserController) ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	var request model.EmailRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		c.logs.Error.Printf("Failed to decode JSON: %v", err)
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid Request Format")
+		return
+	}
+
+	if err := c.userService.ResendVerificationEmail(request.Email); err != nil {
+		c.logs.Error.Printf("Error resending verification email: %v", err)
+		SendErrorResponse(w, http.StatusInternalServerError, "Something went wrong, please try again later")
+		return
+	}
+	SendSuccessResponse(w, http.StatusAccepted, map[string]string{
+		"message": "If the account exists and is not verified yet, a new verification email has been sent",
+	})
+}
+
+func (c *UserController) ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var request model.EmailRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		c.logs.Error.Printf("Failed to decode JSON: %v", err)
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid Request Format")
+		return
+	}
+
+	c.userService.ForgotPassword(request.Email)
+	SendSuccessResponse(w, http.StatusAccepted, map[string]string{
+		"message": "If an account with this email exists, a password reset link has been sent",
+	})
+}
+
+func (c *UserController) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var request model.ResetPassword
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		c.logs.Error.Printf("Failed to decode JSON: %v", err)
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid Request Format")
+		return
+	}
+
+	if err := c.userService.ResetPassword(request.Token, request.Password, ClientInfo(r)); err != nil {
+		if err.Error() == "invalid reset token" {
+			SendErrorResponse(w, http.StatusBadRequest, "Invalid or expired reset token")
+			return
+		}
+		if strings.HasPrefix(err.Error(), "weak password") {
+			SendErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		c.logs.Error.Printf("Error resetting password: %v", err)
+		SendErrorResponse(w, http.StatusInternalServerError, "Something went wrong, please try again later")
+		return
+	}
+	SendSuccessResponse(w, http.StatusNoContent, nil)
+}
+
+func (c *UserController) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var request model.ChangePassword
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		c.logs.Error.Printf("Failed to decode JSON: %v", err)
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid Request Format")
+		return
+	}
+
+	request.Client = ClientInfo(r)
+	tokens, err := c.userService.ChangePassword(userID, request)
+	if err != nil {
+		if err.Error() == "wrong user password" {
+			SendErrorResponse(w, http.StatusForbidden, "Current password is incorrect")
+			return
+		}
+		if err.Error() == "account locked" {
+			SendErrorResponse(w, http.StatusLocked, "Account is temporarily locked, please try again later")
+			return
+		}
+		if strings.HasPrefix(err.Error(), "weak password") {
+			SendErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		c.logs.Error.Printf("Error changing password: %v", err)
+		SendErrorResponse(w, http.StatusInternalServerError, "Failed to change password")
+		return
+	}
+
+	if tokens == nil {
+		SendSuccessResponse(w, http.StatusNoContent, nil)
+		return
+	}
+	SendSuccessResponse(w, http.StatusOK, tokens)
+}
+
+func (c *UserController) RequestEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var request model.ChangeEmail
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		c.logs.Error.Printf("Failed to decode JSON: %v", err)
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid Request Format")
+		return
+	}
+
+	request.Client = ClientInfo(r)
+	if err := c.userService.RequestEmailChange(userID, request); err != nil {
+		switch err.Error() {
+		case "wrong user password":
+			SendErrorResponse(w, http.StatusForbidden, "Password is incorrect")
+		case "account locked":
+			SendErrorResponse(w, http.StatusLocked, "Account is temporarily locked, please try again later")
+		case "invalid email":
+			SendErrorResponse(w, http.StatusBadRequest, "Invalid email address")
+		case "email unchanged":
+			SendErrorResponse(w, http.StatusBadRequest, "New email matches the current one")
+		case "email already in use":
+			SendErrorResponse(w, http.StatusConflict, "Email already in use")
+		default:
+			c.logs.Error.Printf("Error requesting email change: %v", err)
+			SendErrorResponse(w, http.StatusInternalServerError, "Failed to request email change")
+		}
+		return
+	}
+	SendSuccessResponse(w, http.StatusAccepted, map[string]string{
+		"message": "A confirmation link has been sent to the new email address",
+	})
+}
+
+func (c *UserController) ConfirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	c.handleEmailChangeToken(w, r, c.userService.ConfirmEmailChange)
+}
+
+func (c *UserController) UndoEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	c.handleEmailChangeToken(w, r, c.userService.UndoEmailChange)
+}
+
+func (c *UserController) handleEmailChangeToken(w http.ResponseWriter, r *http.Request, action func(token string, client model.ClientInfo) error) {
+	var request model.EmailToken
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		c.logs.Error.Printf("Failed to decode JSON: %v", err)
+		SendErrorResponse(w, http.StatusBadRequest, "Invalid Request Format")
+		return
+	}
+
+	if err := action(request.Token, ClientInfo(r)); err != nil {
+		switch err.Error() {
+		case "invalid email change token":
+			SendErrorResponse(w, http.StatusBadRequest, "Invalid or expired token")
+		case "email already in use":
+			SendErrorResponse(w, http.StatusConflict, "Email already in use")
+		default:
+			c.logs.Error.Printf("Error processing email change: %v", err)
+			SendErrorResponse(w, http.StatusInternalServerError, "Something went wrong, please try again later")
+		}
+		return
+	}
 	SendSuccessResponse(w, http.StatusNoContent, nil)
 }
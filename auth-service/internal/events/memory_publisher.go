@@ -0,0 +1,38 @@
+package events
+
+import (
+	"context"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"sync"
+)
+
+// MemoryPublisher keeps published events in process memory. It is meant for
+// tests and for running the service without Redis.
+type MemoryPublisher struct {
+	mu     sync.Mutex
+	events []model.DomainEvent
+	seen   map[string]bool
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{seen: make(map[string]bool)}
+}
+
+func (p *MemoryPublisher) Publish(_ context.Context, event model.DomainEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.seen[event.IdempotencyKey] {
+		return nil
+	}
+	p.seen[event.IdempotencyKey] = true
+	p.events = append(p.events, event)
+	return nil
+}
+
+// Events returns what was published so far, oldest first.
+func (p *MemoryPublisher) Events() []model.DomainEvent {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]model.DomainEvent(nil), p.events...)
+}
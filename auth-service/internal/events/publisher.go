@@ -0,0 +1,14 @@
+package events
+
+import (
+	"context"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+)
+
+// EventPublisher hands domain events to other services. Publishing the same
+// event twice is possible after a relay crash; implementations drop repeats
+// of an idempotency key they have seen recently, and consumers should do the
+// same.
+type EventPublisher interface {
+	Publish(ctx context.Context, event model.DomainEvent) error
+}
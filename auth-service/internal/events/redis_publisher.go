@@ -0,0 +1,59 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+// The entry is added and the idempotency key remembered in one atomic step,
+// so a redelivered event is not appended twice while the key is kept. The key
+// is only set after XADD succeeded; a failed append can be retried.
+// Returns the entry ID, or false for a repeat.
+var publishScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	return false
+end
+local id = redis.call('XADD', KEYS[1], 'MAXLEN', '~', ARGV[2], '*',
+	'idempotency_key', ARGV[3], 'type', ARGV[4], 'user_id', ARGV[5], 'payload', ARGV[6], 'occurred_at', ARGV[7])
+redis.call('SET', KEYS[2], '1', 'PX', ARGV[1])
+return id
+`)
+
+type RedisStreamConfig struct {
+	Stream string
+	// MaxLen caps the stream length; Redis trims the oldest entries.
+	MaxLen int64
+	// DedupeTTL is how long idempotency keys are remembered.
+	DedupeTTL time.Duration
+}
+
+// RedisStreamPublisher appends events to a Redis stream. Consumers read it
+// with XREADGROUP.
+type RedisStreamPublisher struct {
+	client *redis.Client
+	config RedisStreamConfig
+}
+
+func NewRedisStreamPublisher(client *redis.Client, config RedisStreamConfig) *RedisStreamPublisher {
+	return &RedisStreamPublisher{client: client, config: config}
+}
+
+func (p *RedisStreamPublisher) Publish(ctx context.Context, event model.DomainEvent) error {
+	payload, err := json.Marshal(event.Payload)
+	if err != nil {
+		return fmt.Errorf("encode event payload: %w", err)
+	}
+
+	err = publishScript.Run(ctx, p.client, []string{p.config.Stream, p.config.Stream + ":seen:" + event.IdempotencyKey},
+		p.config.DedupeTTL.Milliseconds(), p.config.MaxLen, event.IdempotencyKey, event.Type, strconv.Itoa(event.UserID),
+		string(payload), event.OccurredAt.UTC().Format(time.RFC3339Nano)).Err()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("redis publish: %w", err)
+	}
+	return nil
+}
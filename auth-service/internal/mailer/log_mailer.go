@@ -0,0 +1,46 @@
+package mailer
+
+import (
+	"fmt"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// LogMailer is meant for local development and tests. It prints every message
+// to the info log and, when a directory is configured, also stores it there
+// as a plain text file so links can be picked up by scripts.
+type LogMailer struct {
+	logs *logger.Logger
+	dir  string
+	mu   sync.Mutex
+	seq  int
+}
+
+func NewLogMailer(logs *logger.Logger, dir string) *LogMailer {
+	return &LogMailer{logs: logs, dir: dir}
+}
+
+func (m *LogMailer) Send(message Message) error {
+	m.logs.Info.Printf("Mail to %s: %s\n%s", message.To, message.Subject, message.Body)
+	if m.dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return fmt.Errorf("create mail directory: %w", err)
+	}
+
+	m.mu.Lock()
+	m.seq++
+	name := fmt.Sprintf("%s-%04d.txt", time.Now().Format("20060102T150405"), m.seq)
+	m.mu.Unlock()
+
+	content := fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n", message.To, message.Subject, message.Body)
+	if err := os.WriteFile(filepath.Join(m.dir, name), []byte(content), 0o644); err != nil {
+		return fmt.Errorf("write mail file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientAddressMiddleware works out who sent the request. Forwarding headers
+// are only believed when the connection comes from one of the trusted
+// proxies; anyone else could put any address and country in them.
+type ClientAddressMiddleware struct {
+	trusted []*net.IPNet
+}
+
+func NewClientAddressMiddleware(trusted []*net.IPNet) *ClientAddressMiddleware {
+	return &ClientAddressMiddleware{trusted: trusted}
+}
+
+// Resolve stores the client address and country in the request context,
+// where controller.ClientInfo picks them up.
+func (m *ClientAddressMiddleware) Resolve(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, country := m.resolve(r)
+		ctx := context.WithValue(r.Context(), "client_ip", ip)
+		ctx = context.WithValue(ctx, "client_country", country)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// resolve walks X-Forwarded-For from the right, skipping the hops added by
+// trusted proxies. The first address that isn't one of them is the client;
+// everything to its left was written by the client itself.
+func (m *ClientAddressMiddleware) resolve(r *http.Request) (string, string) {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+	if !m.isTrusted(ip) {
+		return ip, ""
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !m.isTrusted(hop) {
+			break
+		}
+	}
+
+	country := r.Header.Get("X-Country-Code")
+	if country == "" {
+		country = r.Header.Get("CF-IPCountry")
+	}
+	if len(country) != 2 {
+		country = ""
+	}
+	return ip, strings.ToUpper(country)
+}
+
+func (m *ClientAddressMiddleware) isTrusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range m.trusted {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"github.com/finance-app/finance-app/auth-service/internal/config"
+	"github.com/finance-app/finance-app/auth-service/internal/controller"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientAddress(t *testing.T) {
+	trusted, err := config.ParseCIDRs("10.0.0.0/8, 192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewClientAddressMiddleware(trusted)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		country    string
+		want       model.ClientInfo
+	}{
+		{"direct client", "203.0.113.7:4000", nil, "", model.ClientInfo{IP: "203.0.113.7"}},
+		{"headers from an untrusted peer are ignored", "203.0.113.7:4000", []string{"198.51.100.1"}, "DE", model.ClientInfo{IP: "203.0.113.7"}},
+		{"behind a trusted proxy", "10.1.2.3:4000", []string{"198.51.100.1"}, "de", model.ClientInfo{IP: "198.51.100.1", Country: "DE"}},
+		{"spoofed leftmost hops are skipped", "10.1.2.3:4000", []string{"1.1.1.1, 198.51.100.1"}, "", model.ClientInfo{IP: "198.51.100.1"}},
+		{"chain of trusted proxies", "10.1.2.3:4000", []string{"1.1.1.1, 198.51.100.1, 192.0.2.1", "10.9.9.9"}, "", model.ClientInfo{IP: "198.51.100.1"}},
+		{"garbage stops the walk", "10.1.2.3:4000", []string{"198.51.100.1, not-an-ip, 10.9.9.9"}, "", model.ClientInfo{IP: "10.9.9.9"}},
+		{"trusted proxy without header", "10.1.2.3:4000", nil, "", model.ClientInfo{IP: "10.1.2.3"}},
+		{"invalid country", "10.1.2.3:4000", nil, "DEU", model.ClientInfo{IP: "10.1.2.3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.country != "" {
+				r.Header.Set("X-Country-Code", tt.country)
+			}
+
+			var got model.ClientInfo
+			m.Resolve(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = controller.ClientInfo(r)
+			})).ServeHTTP(httptest.NewRecorder(), r)
+			if got.IP != tt.want.IP || got.Country != tt.want.Country {
+				t.Errorf("got IP %q country %q, want IP %q country %q", got.IP, got.Country, tt.want.IP, tt.want.Country)
+			}
+		})
+	}
+}
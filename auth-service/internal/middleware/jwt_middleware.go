@@ -1,19 +1,25 @@
 package middleware
 
 import (
-	"auth-service/internal/controller"
-	"auth-service/internal/service"
 	"context"
+	"errors"
+	"fmt"
+	"github.com/finance-app/finance-app/auth-service/internal/controller"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/finance-app/finance-app/auth-service/internal/service"
 	"net/http"
 	"strings"
+	"time"
 )
 
 type JWTMiddleware struct {
 	JWTService *service.JWTService
+	TokenState *service.TokenStateCache
+	APIKeys    *service.APIKeyService
 }
 
-func NewJWTMiddleware(jwtService *service.JWTService) *JWTMiddleware {
-	return &JWTMiddleware{JWTService: jwtService}
+func NewJWTMiddleware(jwtService *service.JWTService, tokenState *service.TokenStateCache, apiKeys *service.APIKeyService) *JWTMiddleware {
+	return &JWTMiddleware{JWTService: jwtService, TokenState: tokenState, APIKeys: apiKeys}
 }
 
 func (m *JWTMiddleware) Authenticate(next http.Handler) http.Handler {
@@ -24,17 +30,206 @@ func (m *JWTMiddleware) Authenticate(next http.Handler) http.Handler {
 			return
 		}
 		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
+		if len(parts) != 2 || (parts[0] != "Bearer" && parts[0] != "ApiKey") {
 			controller.SendErrorResponse(w, http.StatusUnauthorized, "Invalid Authorization header format")
 			return
 		}
 
-		userID, err := m.JWTService.ValidateAccessToken(parts[1])
-		if err != nil {
+		var claims *service.AccessClaims
+		var err error
+		if parts[0] == "ApiKey" {
+			claims, err = m.APIKeys.Authenticate(parts[1])
+			if err != nil {
+				if err.Error() == "database error" {
+					controller.SendErrorResponse(w, http.StatusInternalServerError, "Something went wrong, please try again later")
+					return
+				}
+				controller.SendErrorResponse(w, http.StatusUnauthorized, "Invalid API key")
+				return
+			}
+		} else {
+			claims, err = m.JWTService.ValidateAccessToken(parts[1])
+			if err != nil {
+				controller.SendErrorResponse(w, http.StatusUnauthorized, "Invalid token")
+				return
+			}
+			// Tokens issued to OAuth clients are for resource APIs, not for
+			// managing the account itself.
+			if claims.ClientID != "" {
+				controller.SendErrorResponse(w, http.StatusUnauthorized, "Invalid token")
+				return
+			}
+		}
+		if err := m.TokenState.ValidateClaims(claims); err != nil {
+			if err.Error() == "database error" {
+				controller.SendErrorResponse(w, http.StatusInternalServerError, "Something went wrong, please try again later")
+				return
+			}
 			controller.SendErrorResponse(w, http.StatusUnauthorized, "Invalid token")
 			return
 		}
-		ctx := context.WithValue(r.Context(), "user_id", userID)
+		ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
+		ctx = context.WithValue(ctx, "claims", claims)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// AuthenticateDelegated is the counterpart of Authenticate for endpoints that
+// serve OAuth clients, such as /userinfo. Only tokens issued to a client on a
+// user's behalf are accepted, and failures are reported the RFC 6750 way.
+func (m *JWTMiddleware) AuthenticateDelegated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="auth-service"`)
+			controller.SendErrorResponse(w, http.StatusUnauthorized, "invalid_request")
+			return
+		}
+
+		claims, err := m.JWTService.ValidateAccessToken(token)
+		if err == nil && claims.ClientID == "" {
+			err = errors.New("invalid token")
+		}
+		if err == nil {
+			err = m.TokenState.ValidateClaims(claims)
+		}
+		if err != nil {
+			if err.Error() == "database error" {
+				controller.SendErrorResponse(w, http.StatusInternalServerError, "server_error")
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			controller.SendErrorResponse(w, http.StatusUnauthorized, "invalid_token")
+			return
+		}
+		ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
+		ctx = context.WithValue(ctx, "claims", claims)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// RejectAPIKeys must be mounted after Authenticate. API keys are for scripts
+// working with finance data; managing the account takes a signed-in session.
+func (m *JWTMiddleware) RejectAPIKeys(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value("claims").(*service.AccessClaims)
+		if !ok {
+			controller.SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+			return
+		}
+		if claims.APIKeyID != 0 {
+			controller.SendErrorResponse(w, http.StatusForbidden, "API keys cannot be used for this endpoint")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireRole must be mounted after Authenticate. It lets the request through
+// if the token carries at least one of the given roles.
+func (m *JWTMiddleware) RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value("claims").(*service.AccessClaims)
+			if !ok {
+				controller.SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+				return
+			}
+			for _, role := range roles {
+				if claims.HasRole(role) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			controller.SendErrorResponse(w, http.StatusForbidden, "Insufficient role")
+		})
+	}
+}
+
+// RequirePermission must be mounted after Authenticate. All of the given
+// permissions have to be present in the token scope.
+func (m *JWTMiddleware) RequirePermission(permissions ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value("claims").(*service.AccessClaims)
+			if !ok {
+				controller.SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+				return
+			}
+			for _, permission := range permissions {
+				if !claims.HasPermission(permission) {
+					controller.SendErrorResponse(w, http.StatusForbidden, "Insufficient permissions")
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// StepUpPolicy flags a route as sensitive. The user must have authenticated
+// within MaxAge, and with a second factor when SecondFactor is set or when
+// SecondFactorEnrolled reports that the user has one.
+type StepUpPolicy struct {
+	MaxAge               time.Duration
+	SecondFactor         bool
+	SecondFactorEnrolled func(userID int) (bool, error)
+}
+
+// RequireStepUp must be mounted after Authenticate. Requests that fall short
+// get the RFC 9470 insufficient_user_authentication error, telling the client
+// to call /auth/reauthenticate and retry with the elevated token.
+func (m *JWTMiddleware) RequireStepUp(policy StepUpPolicy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value("claims").(*service.AccessClaims)
+			if !ok {
+				controller.SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+				return
+			}
+			secondFactor := policy.SecondFactor
+			if !secondFactor && policy.SecondFactorEnrolled != nil && !claims.HasSecondFactor() {
+				enrolled, err := policy.SecondFactorEnrolled(claims.UserID)
+				if err != nil {
+					controller.SendErrorResponse(w, http.StatusInternalServerError, "Something went wrong, please try again later")
+					return
+				}
+				secondFactor = enrolled
+			}
+			if claims.AuthenticatedWithin(policy.MaxAge) && (!secondFactor || claims.HasSecondFactor()) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			description := "Recent authentication is required"
+			if secondFactor {
+				description = "Recent authentication with a second factor is required"
+			}
+			maxAge := int(policy.MaxAge.Seconds())
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_user_authentication", error_description="%s", max_age=%d`, description, maxAge))
+			controller.SendSuccessResponse(w, http.StatusUnauthorized, model.InsufficientAuthentication{
+				Error:            "insufficient_user_authentication",
+				ErrorDescription: description,
+				MaxAge:           maxAge,
+				SecondFactor:     secondFactor,
+			})
+		})
+	}
+}
+
+// RequireVerifiedEmail must be mounted after Authenticate. It only matters when
+// unverified users are allowed to log in with limited access.
+func (m *JWTMiddleware) RequireVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value("claims").(*service.AccessClaims)
+		if !ok {
+			controller.SendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+			return
+		}
+		if !claims.EmailVerified {
+			controller.SendErrorResponse(w, http.StatusForbidden, "Email address is not verified")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
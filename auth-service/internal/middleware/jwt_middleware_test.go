@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/finance-app/finance-app/auth-service/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRequireStepUpEnrolledFactor(t *testing.T) {
+	enrolled := map[int]bool{1: true}
+	m := &JWTMiddleware{}
+	handler := m.RequireStepUp(StepUpPolicy{
+		MaxAge: 10 * time.Minute,
+		SecondFactorEnrolled: func(userID int) (bool, error) {
+			if userID == 3 {
+				return false, errors.New("database error")
+			}
+			return enrolled[userID], nil
+		},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name   string
+		claims service.AccessClaims
+		want   int
+	}{
+		{"no second factor enrolled", service.AccessClaims{UserID: 2, AuthTime: time.Now(), AMR: []string{model.AMRPassword}}, http.StatusNoContent},
+		{"enrolled but not used", service.AccessClaims{UserID: 1, AuthTime: time.Now(), AMR: []string{model.AMRPassword}}, http.StatusUnauthorized},
+		{"enrolled and used", service.AccessClaims{UserID: 1, AuthTime: time.Now(), AMR: []string{model.AMRPassword, model.AMROTP}}, http.StatusNoContent},
+		{"too long ago", service.AccessClaims{UserID: 2, AuthTime: time.Now().Add(-time.Hour), AMR: []string{model.AMRPassword}}, http.StatusUnauthorized},
+		{"lookup fails", service.AccessClaims{UserID: 3, AuthTime: time.Now(), AMR: []string{model.AMRPassword}}, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r = r.WithContext(context.WithValue(r.Context(), "claims", &tt.claims))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/finance-app/finance-app/auth-service/internal/controller"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/ratelimit"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxRateLimitBody caps how much of the body is buffered to find the email.
+const maxRateLimitBody = 1 << 16
+
+// RateLimitPolicy holds the rates for one endpoint. Rates that are not
+// enabled are skipped, so an endpoint without an email in its body only needs
+// PerIP.
+type RateLimitPolicy struct {
+	PerIP      ratelimit.Rate
+	PerEmail   ratelimit.Rate
+	PerIPEmail ratelimit.Rate
+}
+
+type rateCheck struct {
+	key  string
+	rate ratelimit.Rate
+}
+
+type RateLimitMiddleware struct {
+	limiter ratelimit.Limiter
+	logs    *logger.Logger
+}
+
+func NewRateLimitMiddleware(limiter ratelimit.Limiter, logs *logger.Logger) *RateLimitMiddleware {
+	return &RateLimitMiddleware{limiter: limiter, logs: logs}
+}
+
+// Limit rejects requests over any of the policy rates with 429 and a
+// Retry-After header. If the limiter fails the request is refused with 503:
+// the limits guard the login endpoints against password guessing, so they
+// must not go away with the backend. Wrap a shared backend in a
+// FallbackLimiter to keep serving in that case.
+func (m *RateLimitMiddleware) Limit(scope string, policy RateLimitPolicy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := controller.ClientInfo(r).IP
+			checks := []rateCheck{{scope + ":ip:" + ip, policy.PerIP}}
+			if policy.PerEmail.Enabled() || policy.PerIPEmail.Enabled() {
+				if email := requestEmail(r); email != "" {
+					checks = append(checks,
+						rateCheck{scope + ":email:" + email, policy.PerEmail},
+						rateCheck{scope + ":ip_email:" + ip + ":" + email, policy.PerIPEmail},
+					)
+				}
+			}
+
+			for _, check := range checks {
+				if !check.rate.Enabled() {
+					continue
+				}
+				result, err := m.limiter.Allow(r.Context(), check.key, check.rate)
+				if err != nil {
+					m.logs.Error.Printf("Rate limiter unavailable for %s: %v", scope, err)
+					controller.SendErrorResponse(w, http.StatusServiceUnavailable, "Service temporarily unavailable, please try again later")
+					return
+				}
+				if !result.Allowed {
+					m.logs.Info.Printf("Rate limit exceeded for %s", check.key)
+					w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+					controller.SendErrorResponse(w, http.StatusTooManyRequests, "Too many requests, please try again later")
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requestEmail reads the email field from a JSON body and puts the body back
+// for the handler.
+func requestEmail(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRateLimitBody))
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	var payload struct {
+		Email string `json:"email"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(payload.Email))
+}
@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// APIKeyPrefix starts every personal API key, so leaked keys are easy to
+// recognise by secret scanners.
+const APIKeyPrefix = "fin_"
+
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type CreateAPIKey struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreatedAPIKey is only returned once; the key itself is not stored.
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,140 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// Audit event types. The part before the dot names the area.
+const (
+	AuditUserRegistered       = "user.registered"
+	AuditLoginSucceeded       = "login.succeeded"
+	AuditLoginFailed          = "login.failed"
+	AuditTokenRefreshed       = "session.refreshed"
+	AuditLogout               = "session.logout"
+	AuditProfileUpdated       = "profile.updated"
+	AuditEmailChangeRequested = "email.change_requested"
+	AuditEmailChanged         = "email.changed"
+	AuditEmailChangeUndone    = "email.change_undone"
+	AuditPasswordChanged      = "password.changed"
+	AuditPasswordReset        = "password.reset"
+	AuditDeletionScheduled    = "account.deletion_scheduled"
+	AuditAccountRestored      = "account.restored"
+	AuditAccountErased        = "account.erased"
+	AuditUserDisabled         = "admin.user_disabled"
+	AuditUserEnabled          = "admin.user_enabled"
+	AuditSessionsRevoked      = "admin.sessions_revoked"
+	AuditPasswordResetForced  = "admin.password_reset"
+	AuditUserDeleted          = "admin.user_deleted"
+	AuditRoleAssigned         = "admin.role_assigned"
+	AuditRoleRemoved          = "admin.role_removed"
+)
+
+// Who caused an audit event. A user acts on their own account, an admin on
+// somebody else's. Anonymous events come from requests that did not prove an
+// identity, such as failed logins.
+const (
+	AuditActorUser      = "user"
+	AuditActorAdmin     = "admin"
+	AuditActorAnonymous = "anonymous"
+	AuditActorSystem    = "system"
+)
+
+// AuditEvent is one row of the append-only audit log. Hash covers the event
+// and PrevHash, so changing or removing a row breaks the chain after it. IP
+// and UserAgent are personal data and get erased with the account, so the
+// chain covers their keyed hashes instead; those still tell whether two
+// events came from the same client.
+type AuditEvent struct {
+	ID            int64             `json:"id"`
+	Type          string            `json:"type"`
+	ActorType     string            `json:"actor_type"`
+	ActorID       *int              `json:"actor_id,omitempty"`
+	TargetID      *int              `json:"target_id,omitempty"`
+	IP            string            `json:"ip,omitempty"`
+	UserAgent     string            `json:"user_agent,omitempty"`
+	IPHash        string            `json:"ip_hash,omitempty"`
+	UserAgentHash string            `json:"user_agent_hash,omitempty"`
+	RequestID     string            `json:"request_id,omitempty"`
+	Details       map[string]string `json:"details,omitempty"`
+	PrevHash      string            `json:"prev_hash"`
+	Hash          string            `json:"hash"`
+	CreatedAt     time.Time         `json:"created_at"`
+}
+
+// ChainHash returns the hex SHA-256 of PrevHash and the event fields. The ID
+// is left out because it is only known after the insert.
+func (e AuditEvent) ChainHash() string {
+	content, _ := json.Marshal(struct {
+		Type          string            `json:"type"`
+		ActorType     string            `json:"actor_type"`
+		ActorID       *int              `json:"actor_id"`
+		TargetID      *int              `json:"target_id"`
+		IPHash        string            `json:"ip_hash"`
+		UserAgentHash string            `json:"user_agent_hash"`
+		RequestID     string            `json:"request_id"`
+		Details       map[string]string `json:"details"`
+		CreatedAt     string            `json:"created_at"`
+	}{e.Type, e.ActorType, e.ActorID, e.TargetID, e.IPHash, e.UserAgentHash, e.RequestID, e.Details, e.CreatedAt.UTC().Format(time.RFC3339Nano)})
+
+	sum := sha256.Sum256(append([]byte(e.PrevHash+"\n"), content...))
+	return hex.EncodeToString(sum[:])
+}
+
+// ToActivity is the view of the event shown to the account owner.
+func (e AuditEvent) ToActivity() ActivityEvent {
+	return ActivityEvent{
+		Type:      e.Type,
+		Actor:     e.ActorType,
+		IP:        e.IP,
+		UserAgent: e.UserAgent,
+		Details:   e.Details,
+		CreatedAt: e.CreatedAt,
+	}
+}
+
+type ActivityEvent struct {
+	Type      string            `json:"type"`
+	Actor     string            `json:"actor"`
+	IP        string            `json:"ip,omitempty"`
+	UserAgent string            `json:"user_agent,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+type AuditFilter struct {
+	Type      string
+	ActorID   *int
+	TargetID  *int
+	RequestID string
+	From      *time.Time
+	To        *time.Time
+	Limit     int
+	Offset    int
+}
+
+type AuditEventList struct {
+	Events   []AuditEvent `json:"events"`
+	Total    int          `json:"total"`
+	Page     int          `json:"page"`
+	PageSize int          `json:"page_size"`
+}
+
+type ActivityList struct {
+	Events   []ActivityEvent `json:"events"`
+	Total    int             `json:"total"`
+	Page     int             `json:"page"`
+	PageSize int             `json:"page_size"`
+}
+
+// AuditVerification is the result of walking the whole chain. LastHash can be
+// stored outside the database, which also makes cutting off the newest rows
+// detectable.
+type AuditVerification struct {
+	Valid         bool   `json:"valid"`
+	EventsChecked int    `json:"events_checked"`
+	BrokenAtID    int64  `json:"broken_at_id,omitempty"`
+	LastHash      string `json:"last_hash,omitempty"`
+}
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// Domain events other services subscribe to.
+const (
+	EventUserRegistered   = "user.registered"
+	EventUserDeleted      = "user.deleted"
+	EventUserEmailChanged = "user.email_changed"
+)
+
+// DomainEvent is written to the outbox together with the change it
+// announces. Delivery is at least once, so consumers should skip events whose
+// IdempotencyKey they have seen before.
+type DomainEvent struct {
+	ID             int64             `json:"-"`
+	IdempotencyKey string            `json:"idempotency_key"`
+	Type           string            `json:"type"`
+	UserID         int               `json:"user_id"`
+	Payload        map[string]string `json:"payload"`
+	OccurredAt     time.Time         `json:"occurred_at"`
+	Attempts       int               `json:"-"`
+}
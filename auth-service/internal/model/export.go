@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+const (
+	ExportStatusPending    = "pending"
+	ExportStatusProcessing = "processing"
+	ExportStatusReady      = "ready"
+	ExportStatusFailed     = "failed"
+	ExportStatusExpired    = "expired"
+
+	ExportFormatJSON = "json"
+	ExportFormatZip  = "zip"
+)
+
+type UserDataExport struct {
+	GeneratedAt  time.Time       `json:"generated_at"`
+	Profile      UserInfo        `json:"profile"`
+	Roles        []string        `json:"roles"`
+	Sessions     []Session       `json:"sessions"`
+	LoginHistory []LoginEvent    `json:"login_history"`
+	Activity     []ActivityEvent `json:"activity"`
+}
+
+type ExportJob struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"-"`
+	Status      string     `json:"status"`
+	Format      string     `json:"format"`
+	FilePath    string     `json:"-"`
+	Error       string     `json:"-"`
+	DownloadURL string     `json:"download_url,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
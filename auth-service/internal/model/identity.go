@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+// Identity links an account at an external OpenID Connect provider to a user.
+type Identity struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"-"`
+	Provider   string     `json:"provider"`
+	Subject    string     `json:"-"`
+	Email      string     `json:"email,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// SocialLoginState is kept between the redirect to the provider and the
+// callback. UserID is set when a signed-in user links a new identity.
+type SocialLoginState struct {
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	UserID       *int
+	ExpiresAt    time.Time
+}
+
+// SocialAuthorization tells the frontend where to send the browser. It has to
+// keep State and compare it with the one coming back on the callback.
+type SocialAuthorization struct {
+	AuthorizationURL string `json:"authorization_url"`
+	State            string `json:"state"`
+}
+
+// SocialCallback carries the query parameters the provider redirected back
+// with.
+type SocialCallback struct {
+	Code   string     `json:"code"`
+	State  string     `json:"state"`
+	Client ClientInfo `json:"-"`
+}
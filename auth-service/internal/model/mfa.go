@@ -0,0 +1,68 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	MFAMethodTOTP     = "totp"
+	MFAMethodWebAuthn = "webauthn"
+)
+
+type TOTPCredential struct {
+	UserID       int
+	Secret       string
+	ConfirmedAt  *time.Time
+	LastUsedStep int64
+	CreatedAt    time.Time
+}
+
+type TOTPEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+	QRCode          string `json:"qr_code"`
+}
+
+// MFAChallenge is returned by login instead of Tokens when a second factor is
+// required. The token is only good for /auth/login/mfa.
+type MFAChallenge struct {
+	MFARequired bool     `json:"mfa_required"`
+	MFAToken    string   `json:"mfa_token"`
+	Methods     []string `json:"methods"`
+	ExpiresIn   int      `json:"expires_in"`
+}
+
+// MFALogin carries exactly one second factor: a TOTP code, a recovery code or
+// a passkey assertion for a ceremony started with the same MFA token.
+type MFALogin struct {
+	MFAToken     string          `json:"mfa_token"`
+	Code         string          `json:"code"`
+	RecoveryCode string          `json:"recovery_code"`
+	CeremonyID   string          `json:"ceremony_id"`
+	Credential   json.RawMessage `json:"credential"`
+	Client       ClientInfo      `json:"-"`
+}
+
+type MFACode struct {
+	Code         string     `json:"code"`
+	RecoveryCode string     `json:"recovery_code"`
+	Client       ClientInfo `json:"-"`
+}
+
+type DisableMFA struct {
+	Password     string     `json:"password"`
+	Code         string     `json:"code"`
+	RecoveryCode string     `json:"recovery_code"`
+	Client       ClientInfo `json:"-"`
+}
+
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
+}
+
+type MFAStatus struct {
+	Enabled                bool     `json:"enabled"`
+	Methods                []string `json:"methods"`
+	RecoveryCodesRemaining int      `json:"recovery_codes_remaining"`
+}
@@ -0,0 +1,175 @@
+package model
+
+import "time"
+
+// OAuthClientService clients are service accounts: other finance services
+// calling as themselves. They hold a secret like confidential clients but only
+// use client_credentials, and their name is the service claim of their tokens.
+const (
+	OAuthClientConfidential = "confidential"
+	OAuthClientPublic       = "public"
+	OAuthClientService      = "service"
+)
+
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantRefreshToken      = "refresh_token"
+	GrantClientCredentials = "client_credentials"
+)
+
+const (
+	ScopeOpenID        = "openid"
+	ScopeProfile       = "profile"
+	ScopeEmail         = "email"
+	ScopeOfflineAccess = "offline_access"
+	// ScopeTokensIntrospect lets a service account introspect tokens that
+	// were issued to other clients.
+	ScopeTokensIntrospect = "tokens:introspect"
+)
+
+// OAuthScopes lists every scope a client can ask for, with the text shown on
+// the consent screen. Scopes named after a permission only end up in a token
+// if the user holds that permission.
+var OAuthScopes = map[string]string{
+	ScopeOpenID:                 "Sign you in with your account",
+	ScopeProfile:                "See your name",
+	ScopeEmail:                  "See your email address",
+	ScopeOfflineAccess:          "Keep access while you are not using the app",
+	PermissionAccountsRead:      "See your accounts and balances",
+	PermissionAccountsWrite:     "Manage your accounts",
+	PermissionTransactionsRead:  "See your transactions",
+	PermissionTransactionsWrite: "Create and change transactions",
+}
+
+// ServiceScopes lists what a service account can be granted. They are checked
+// by the receiving service, never against a user's permissions.
+var ServiceScopes = map[string]string{
+	PermissionUsersRead:         "Look up users",
+	PermissionAccountsRead:      "Read accounts of any user",
+	PermissionAccountsWrite:     "Change accounts of any user",
+	PermissionTransactionsRead:  "Read transactions of any user",
+	PermissionTransactionsWrite: "Change transactions of any user",
+	ScopeTokensIntrospect:       "Check tokens issued to other clients",
+}
+
+type OAuthClient struct {
+	ID               int        `json:"-"`
+	ClientID         string     `json:"client_id"`
+	ClientSecretHash string     `json:"-"`
+	Name             string     `json:"name"`
+	Type             string     `json:"type"`
+	RedirectURIs     []string   `json:"redirect_uris"`
+	GrantTypes       []string   `json:"grant_types"`
+	Scopes           []string   `json:"scopes"`
+	CreatedBy        *int       `json:"created_by,omitempty"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+type RegisterOAuthClient struct {
+	Name         string   `json:"name"`
+	Type         string   `json:"type"`
+	RedirectURIs []string `json:"redirect_uris"`
+	GrantTypes   []string `json:"grant_types"`
+	Scopes       []string `json:"scopes"`
+}
+
+// RegisteredOAuthClient is only returned once; the secret is not stored in
+// clear text.
+type RegisteredOAuthClient struct {
+	OAuthClient
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+type AuthorizationCode struct {
+	ClientID      int
+	UserID        int
+	RedirectURI   string
+	Scope         string
+	CodeChallenge string
+	Nonce         string
+	AuthTime      *time.Time
+	ExpiresAt     time.Time
+}
+
+// AuthorizationRequest holds the query parameters of /oauth/authorize. The
+// consent screen sends them back unchanged together with the decision.
+type AuthorizationRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Nonce               string `json:"nonce,omitempty"`
+}
+
+type ConsentDecision struct {
+	AuthorizationRequest
+	Approved bool `json:"approved"`
+}
+
+type ScopeInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type ConsentPrompt struct {
+	ClientID       string      `json:"client_id"`
+	ClientName     string      `json:"client_name"`
+	Scopes         []ScopeInfo `json:"scopes"`
+	AlreadyGranted bool        `json:"already_granted"`
+}
+
+type ConsentResult struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+type TokenRequest struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+	Scope        string
+	ClientID     string
+	ClientSecret string
+}
+
+type OAuthTokens struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+// TokenIntrospection is the RFC 7662 response. Inactive tokens only carry
+// Active, so nothing is revealed about them.
+type TokenIntrospection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Service   string `json:"service,omitempty"`
+}
+
+// RefreshTokenInfo describes a stored refresh token for introspection.
+// ClientID is empty for first-party sessions.
+type RefreshTokenInfo struct {
+	UserID    int
+	ClientID  string
+	Scope     string
+	ExpiresAt time.Time
+}
+
+// OAuthGrant is what a stored OAuth refresh token stands for.
+type OAuthGrant struct {
+	UserID   int
+	Scope    string
+	AuthTime *time.Time
+}
@@ -0,0 +1,57 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	PasskeyCeremonyRegistration = "registration"
+	PasskeyCeremonyLogin        = "login"
+	PasskeyCeremonyMFA          = "mfa"
+)
+
+// Passkey is a stored WebAuthn credential. Data holds the credential record
+// as the WebAuthn library serializes it; SignCount is kept in its own column
+// because it changes on every use.
+type Passkey struct {
+	ID           int        `json:"id"`
+	UserID       int        `json:"-"`
+	CredentialID []byte     `json:"-"`
+	Name         string     `json:"name"`
+	Data         []byte     `json:"-"`
+	SignCount    uint32     `json:"-"`
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// PasskeyCeremony is handed to the browser to start a WebAuthn ceremony. The
+// ceremony ID has to be sent back with the authenticator response.
+type PasskeyCeremony struct {
+	CeremonyID string `json:"ceremony_id"`
+	Options    any    `json:"options"`
+}
+
+type BeginPasskeyRegistration struct {
+	Name string `json:"name"`
+}
+
+type PasskeyRegistration struct {
+	CeremonyID string          `json:"ceremony_id"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+type PasskeyRegistered struct {
+	Passkey       Passkey  `json:"passkey"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+type PasskeyLogin struct {
+	CeremonyID string          `json:"ceremony_id"`
+	Credential json.RawMessage `json:"credential"`
+	Client     ClientInfo      `json:"-"`
+}
+
+type PasskeyMFABegin struct {
+	MFAToken string `json:"mfa_token"`
+}
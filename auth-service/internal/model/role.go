@@ -0,0 +1,27 @@
+package model
+
+const (
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+	RoleUser    = "user"
+)
+
+const (
+	PermissionUsersRead         = "users:read"
+	PermissionUsersWrite        = "users:write"
+	PermissionRolesWrite        = "roles:write"
+	PermissionAccountsRead      = "accounts:read"
+	PermissionAccountsWrite     = "accounts:write"
+	PermissionTransactionsRead  = "transactions:read"
+	PermissionTransactionsWrite = "transactions:write"
+)
+
+type Role struct {
+	ID          int      `json:"id,omitempty"`
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+type AssignRole struct {
+	Role string `json:"role"`
+}
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+	Country   string
+	RequestID string
+}
+
+type Session struct {
+	ID        int       `json:"id"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type LoginEvent struct {
+	ID        int       `json:"id"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Country   string    `json:"country,omitempty"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Authentication methods recorded in the amr claim. The names follow RFC 8176
+// where it has one.
+const (
+	AMRPassword  = "pwd"
+	AMROTP       = "otp"
+	AMRWebAuthn  = "webauthn"
+	AMRMFA       = "mfa"
+	AMRFederated = "fed"
+	AMREmail     = "email"
+)
+
+// Authentication records when and how the user proved who they are. It is
+// carried over when a session is refreshed, so it always describes the sign-in
+// and not the latest token.
+type Authentication struct {
+	Time    time.Time
+	Methods []string
+}
+
+// Reauthenticate takes the password, a second factor, or both. A passkey
+// assertion needs a ceremony started with /auth/reauthenticate/passkey.
+type Reauthenticate struct {
+	Password     string          `json:"password"`
+	Code         string          `json:"code"`
+	RecoveryCode string          `json:"recovery_code"`
+	CeremonyID   string          `json:"ceremony_id"`
+	Credential   json.RawMessage `json:"credential"`
+	Client       ClientInfo      `json:"-"`
+}
+
+// ElevatedToken is a short-lived access token with a fresh auth_time. It comes
+// without a refresh token and is only meant for the operation at hand.
+type ElevatedToken struct {
+	AccessToken string   `json:"access_token"`
+	TokenType   string   `json:"token_type"`
+	ExpiresIn   int      `json:"expires_in"`
+	AMR         []string `json:"amr"`
+}
+
+// InsufficientAuthentication is the step-up error of RFC 9470.
+type InsufficientAuthentication struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+	MaxAge           int    `json:"max_age"`
+	SecondFactor     bool   `json:"second_factor_required"`
+}
@@ -2,13 +2,56 @@ package model
 
 import "time"
 
+const (
+	UserStatusPending  = "pending_verification"
+	UserStatusActive   = "active"
+	UserStatusLocked   = "locked"
+	UserStatusDisabled = "disabled"
+	UserStatusDeleted  = "deleted"
+)
+
+var userStatusTransitions = map[string][]string{
+	UserStatusPending:  {UserStatusActive, UserStatusDisabled, UserStatusDeleted},
+	UserStatusActive:   {UserStatusLocked, UserStatusDisabled, UserStatusDeleted},
+	UserStatusLocked:   {UserStatusActive, UserStatusDisabled, UserStatusDeleted},
+	UserStatusDisabled: {UserStatusActive, UserStatusDeleted},
+	UserStatusDeleted:  {UserStatusActive, UserStatusPending},
+}
+
+func CanTransitionStatus(from string, to string) bool {
+	for _, status := range userStatusTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
 type User struct {
-	ID        int       `json:"id,omitempty"`
-	Name      string    `json:"name,omitempty"`
-	Email     string    `json:"email,omitempty"`
-	Password  string    `json:"password"`
-	CreatedAt time.Time `json:"created_at,omitempty"`
-	UpdatedAt time.Time `json:"updated_at,omitempty"`
+	ID                  int        `json:"id,omitempty"`
+	Name                string     `json:"name,omitempty"`
+	Email               string     `json:"email,omitempty"`
+	Password            string     `json:"password"`
+	Status              string     `json:"-"`
+	TokenVersion        int        `json:"-"`
+	FailedLoginAttempts int        `json:"-"`
+	LockedUntil         *time.Time `json:"-"`
+	EmailVerifiedAt     *time.Time `json:"-"`
+	DeletionScheduledAt *time.Time `json:"-"`
+	CreatedAt           time.Time  `json:"created_at,omitempty"`
+	UpdatedAt           time.Time  `json:"updated_at,omitempty"`
+}
+
+func (u *User) ToInfo() UserInfo {
+	return UserInfo{
+		ID:            u.ID,
+		Name:          u.Name,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerifiedAt != nil,
+		Status:        u.Status,
+		CreatedAt:     u.CreatedAt,
+		UpdatedAt:     u.UpdatedAt,
+	}
 }
 
 type RegisterResponse struct {
@@ -18,14 +61,86 @@ type RegisterResponse struct {
 }
 
 type UserInfo struct {
-	ID        int       `json:"id,omitempty"`
-	Name      string    `json:"name,omitempty"`
-	Email     string    `json:"email,omitempty"`
-	CreatedAt time.Time `json:"created_at,omitempty"`
-	UpdatedAt time.Time `json:"updated_at,omitempty"`
+	ID            int       `json:"id,omitempty"`
+	Name          string    `json:"name,omitempty"`
+	Email         string    `json:"email,omitempty"`
+	EmailVerified bool      `json:"email_verified"`
+	Status        string    `json:"status,omitempty"`
+	CreatedAt     time.Time `json:"created_at,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at,omitempty"`
+}
+
+type UserFilter struct {
+	Email         string
+	Status        string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Limit         int
+	Offset        int
+}
+
+type UserList struct {
+	Users    []UserInfo `json:"users"`
+	Total    int        `json:"total"`
+	Page     int        `json:"page"`
+	PageSize int        `json:"page_size"`
+}
+
+type AdminUserInfo struct {
+	UserInfo
+	Roles []string `json:"roles"`
 }
 
 type Login struct {
-	Email    string `json:"email"`
+	Email    string     `json:"email"`
+	Password string     `json:"password"`
+	Client   ClientInfo `json:"-"`
+}
+
+// MagicLinkLogin carries the token from the emailed link. Nonce comes from the
+// cookie set on the browser that asked for the link.
+type MagicLinkLogin struct {
+	Token  string     `json:"token"`
+	Nonce  string     `json:"-"`
+	Client ClientInfo `json:"-"`
+}
+
+type EmailRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPassword struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type ChangePassword struct {
+	CurrentPassword string     `json:"current_password"`
+	NewPassword     string     `json:"new_password"`
+	RefreshToken    string     `json:"refresh_token,omitempty"`
+	Client          ClientInfo `json:"-"`
+}
+
+type ChangeEmail struct {
+	NewEmail string     `json:"new_email"`
+	Password string     `json:"password"`
+	Client   ClientInfo `json:"-"`
+}
+
+type EmailToken struct {
+	Token string `json:"token"`
+}
+
+type UserUpdate struct {
+	Name      *string    `json:"name,omitempty"`
+	Email     *string    `json:"email,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+type DeleteAccount struct {
 	Password string `json:"password"`
 }
+
+type DeletionScheduled struct {
+	DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
+}
@@ -0,0 +1,10 @@
+package model
+
+const (
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailChange       = "email_change"
+	TokenPurposeEmailChangeUndo   = "email_change_undo"
+	TokenPurposeAccountRestore    = "account_restore"
+	TokenPurposeMagicLink         = "magic_link"
+)
@@ -0,0 +1,41 @@
+package notifier
+
+import (
+	"fmt"
+	"github.com/finance-app/finance-app/auth-service/internal/mailer"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"strings"
+	"time"
+)
+
+type EmailNotifier struct {
+	mailer mailer.Mailer
+}
+
+func NewEmailNotifier(mailer mailer.Mailer) *EmailNotifier {
+	return &EmailNotifier{mailer: mailer}
+}
+
+func (n *EmailNotifier) Notify(user *model.User, event Event) error {
+	var body strings.Builder
+	fmt.Fprintf(&body, "Hi %s,\n\n%s\n", user.Name, event.Text)
+	if event.Client.IP != "" || event.Client.UserAgent != "" {
+		fmt.Fprintf(&body, "\nTime: %s\n", event.OccurredAt.Format(time.RFC1123))
+		if event.Client.IP != "" {
+			fmt.Fprintf(&body, "IP address: %s\n", event.Client.IP)
+		}
+		if event.Client.Country != "" {
+			fmt.Fprintf(&body, "Country: %s\n", event.Client.Country)
+		}
+		if event.Client.UserAgent != "" {
+			fmt.Fprintf(&body, "Device: %s\n", event.Client.UserAgent)
+		}
+	}
+	body.WriteString("\nIf this wasn't you, reset your password immediately and contact support.")
+
+	return n.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: event.Subject,
+		Body:    body.String(),
+	})
+}
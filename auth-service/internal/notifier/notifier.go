@@ -0,0 +1,31 @@
+package notifier
+
+import (
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"time"
+)
+
+const (
+	EventPasswordChanged = "password_changed"
+	EventAccountLocked   = "account_locked"
+	EventNewLogin        = "new_login"
+	EventMFAChanged      = "mfa_changed"
+	EventIdentityChanged = "identity_changed"
+	EventAPIKeyCreated   = "api_key_created"
+)
+
+// Event describes something security relevant that happened to an account.
+// Client is empty for events that were not triggered by a request.
+type Event struct {
+	Type       string
+	Subject    string
+	Text       string
+	Client     model.ClientInfo
+	OccurredAt time.Time
+}
+
+// Notifier tells users about security events on their account. Delivery is
+// best effort; callers only log failures.
+type Notifier interface {
+	Notify(user *model.User, event Event) error
+}
@@ -0,0 +1,28 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+)
+
+// FallbackLimiter counts in the fallback limiter while the primary one fails,
+// e.g. when Redis is down. Limits then hold per instance instead of across
+// the cluster, which is weaker but still slows down password guessing.
+type FallbackLimiter struct {
+	primary  Limiter
+	fallback Limiter
+	logs     *logger.Logger
+}
+
+func NewFallbackLimiter(primary Limiter, fallback Limiter, logs *logger.Logger) *FallbackLimiter {
+	return &FallbackLimiter{primary: primary, fallback: fallback, logs: logs}
+}
+
+func (l *FallbackLimiter) Allow(ctx context.Context, key string, rate Rate) (Result, error) {
+	result, err := l.primary.Allow(ctx, key, rate)
+	if err == nil {
+		return result, nil
+	}
+	l.logs.Error.Printf("Rate limiter unavailable, counting %s in memory: %v", key, err)
+	return l.fallback.Allow(ctx, key, rate)
+}
@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+// stubLimiter answers every hit the same way and counts them.
+type stubLimiter struct {
+	result Result
+	err    error
+	calls  int
+}
+
+func (l *stubLimiter) Allow(context.Context, string, Rate) (Result, error) {
+	l.calls++
+	return l.result, l.err
+}
+
+func TestFallbackLimiter(t *testing.T) {
+	logs := &logger.Logger{Info: log.New(io.Discard, "", 0), Error: log.New(io.Discard, "", 0)}
+	rate := Rate{Limit: 2, Window: time.Minute}
+
+	t.Run("primary answers", func(t *testing.T) {
+		primary := &stubLimiter{result: Result{Allowed: false, RetryAfter: time.Second}}
+		fallback := &stubLimiter{result: Result{Allowed: true}}
+		result := allow(t, NewFallbackLimiter(primary, fallback, logs), "key", rate)
+		if result.Allowed || fallback.calls != 0 {
+			t.Fatalf("result = %+v with %d fallback calls, want the primary's answer", result, fallback.calls)
+		}
+	})
+
+	t.Run("primary fails", func(t *testing.T) {
+		primary := &stubLimiter{err: errors.New("connection refused")}
+		l := NewFallbackLimiter(primary, NewMemoryLimiter(), logs)
+		for i := range 2 {
+			if result := allow(t, l, "key", rate); !result.Allowed {
+				t.Fatalf("hit %d was denied", i+1)
+			}
+		}
+		if result := allow(t, l, "key", rate); result.Allowed {
+			t.Fatal("the fallback didn't enforce the limit")
+		}
+		if primary.calls != 3 {
+			t.Fatalf("primary was tried %d times, want every time", primary.calls)
+		}
+	})
+}
@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Rate struct {
+	Limit  int
+	Window time.Duration
+}
+
+type Result struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// Limiter counts hits per key over a sliding window.
+type Limiter interface {
+	Allow(ctx context.Context, key string, rate Rate) (Result, error)
+}
+
+// ParseRate reads rates written as "<limit>/<window>", e.g. "10/1m". A limit
+// of 0 disables the rate.
+func ParseRate(value string) (Rate, error) {
+	parts := strings.Split(value, "/")
+	if len(parts) != 2 {
+		return Rate{}, errors.New("rate must look like <limit>/<window>")
+	}
+	limit, err := strconv.Atoi(parts[0])
+	if err != nil || limit < 0 {
+		return Rate{}, errors.New("invalid rate limit")
+	}
+	window, err := time.ParseDuration(parts[1])
+	if err != nil || window <= 0 {
+		return Rate{}, errors.New("invalid rate window")
+	}
+	return Rate{Limit: limit, Window: window}, nil
+}
+
+func (r Rate) Enabled() bool {
+	return r.Limit > 0 && r.Window > 0
+}
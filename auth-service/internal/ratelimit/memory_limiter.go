@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryLimiter keeps a sliding log of hits per key in process memory. It is
+// meant for single-node deployments and tests.
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	keys      map[string]*memoryKey
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// memoryKey remembers the window its hits were counted for, so that a sweep
+// triggered by a short rate doesn't forget the hits of a longer one.
+type memoryKey struct {
+	hits   []time.Time
+	window time.Duration
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{keys: make(map[string]*memoryKey), lastSweep: time.Now(), now: time.Now}
+}
+
+func (l *MemoryLimiter) Allow(_ context.Context, key string, rate Rate) (Result, error) {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.keys[key]
+	if !ok {
+		entry = &memoryKey{}
+		l.keys[key] = entry
+	}
+	entry.window = max(entry.window, rate.Window)
+	entry.hits = dropBefore(entry.hits, now.Add(-rate.Window))
+	if len(entry.hits) >= rate.Limit {
+		return Result{Allowed: false, RetryAfter: entry.hits[0].Add(rate.Window).Sub(now)}, nil
+	}
+
+	entry.hits = append(entry.hits, now)
+	l.sweep(now)
+	return Result{Allowed: true, Remaining: rate.Limit - len(entry.hits)}, nil
+}
+
+// sweep drops keys that haven't been hit for longer than their window so
+// memory doesn't grow with every IP address ever seen.
+func (l *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, entry := range l.keys {
+		if len(entry.hits) == 0 || now.Sub(entry.hits[len(entry.hits)-1]) > entry.window {
+			delete(l.keys, key)
+		}
+	}
+}
+
+func dropBefore(hits []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(hits) && !hits[i].After(cutoff) {
+		i++
+	}
+	return hits[i:]
+}
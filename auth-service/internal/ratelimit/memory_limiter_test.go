@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// newTestMemoryLimiter returns a limiter whose clock only moves when advance
+// is called.
+func newTestMemoryLimiter() (*MemoryLimiter, func(time.Duration)) {
+	l := NewMemoryLimiter()
+	now := l.lastSweep
+	l.now = func() time.Time { return now }
+	return l, func(d time.Duration) { now = now.Add(d) }
+}
+
+func allow(t *testing.T, l Limiter, key string, rate Rate) Result {
+	t.Helper()
+	result, err := l.Allow(context.Background(), key, rate)
+	if err != nil {
+		t.Fatalf("Allow(%s): %v", key, err)
+	}
+	return result
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	l, advance := newTestMemoryLimiter()
+	rate := Rate{Limit: 3, Window: time.Minute}
+
+	for i := range 3 {
+		result := allow(t, l, "login:ip:203.0.113.7", rate)
+		if !result.Allowed || result.Remaining != 2-i {
+			t.Fatalf("hit %d = %+v, want allowed with %d remaining", i+1, result, 2-i)
+		}
+		advance(10 * time.Second)
+	}
+
+	result := allow(t, l, "login:ip:203.0.113.7", rate)
+	if result.Allowed || result.RetryAfter != 30*time.Second {
+		t.Fatalf("hit over the limit = %+v, want denied for 30s", result)
+	}
+	if result := allow(t, l, "login:ip:198.51.100.1", rate); !result.Allowed {
+		t.Fatal("another key shares the limit")
+	}
+
+	advance(30 * time.Second)
+	if result := allow(t, l, "login:ip:203.0.113.7", rate); !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("hit after the oldest one left the window = %+v, want allowed with 0 remaining", result)
+	}
+}
+
+func TestMemoryLimiterSweepKeepsLongerWindows(t *testing.T) {
+	l, advance := newTestMemoryLimiter()
+	long := Rate{Limit: 3, Window: 15 * time.Minute}
+	short := Rate{Limit: 5, Window: time.Minute}
+
+	for range 3 {
+		allow(t, l, "login:email:alice@example.com", long)
+	}
+	if result := allow(t, l, "login:email:alice@example.com", long); result.Allowed {
+		t.Fatal("4th attempt was allowed")
+	}
+
+	// A hit on a short rate sweeps keys idle for more than their own window
+	// only.
+	advance(2 * time.Minute)
+	allow(t, l, "login:ip_email:198.51.100.1:bob@example.com", short)
+	if result := allow(t, l, "login:email:alice@example.com", long); result.Allowed {
+		t.Fatal("the sweep reset a key whose window hasn't passed")
+	}
+
+	advance(16 * time.Minute)
+	allow(t, l, "login:ip_email:198.51.100.1:bob@example.com", short)
+	if _, ok := l.keys["login:email:alice@example.com"]; ok {
+		t.Fatal("a key idle for longer than its window was kept")
+	}
+}
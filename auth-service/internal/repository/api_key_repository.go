@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/lib/pq"
+	"time"
+)
+
+const apiKeyColumns = `id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at, revoked_at, created_at`
+
+type APIKeyRepository struct {
+	db   *sql.DB
+	logs *logger.Logger
+}
+
+func NewAPIKeyRepository(db *sql.DB, logs *logger.Logger) *APIKeyRepository {
+	return &APIKeyRepository{db: db, logs: logs}
+}
+
+func scanAPIKey(row rowScanner) (*model.APIKey, error) {
+	var key model.APIKey
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, pq.Array(&key.Scopes), &key.ExpiresAt, &key.LastUsedAt,
+		&key.RevokedAt, &key.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *APIKeyRepository) InsertAPIKey(key *model.APIKey) error {
+	query := `INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`
+	err := r.db.QueryRow(query, key.UserID, key.Name, key.Prefix, key.KeyHash, pq.Array(key.Scopes), key.ExpiresAt, time.Now()).
+		Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		r.logs.Error.Printf("Database error in InsertAPIKey: %v", err)
+		return errors.New("database error: failed to insert api key")
+	}
+	return nil
+}
+
+// GetActiveAPIKey returns the key with the given prefix unless it is revoked
+// or expired.
+func (r *APIKeyRepository) GetActiveAPIKey(prefix string) (*model.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys
+		WHERE prefix = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())`
+	key, err := scanAPIKey(r.db.QueryRow(query, prefix))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		r.logs.Error.Printf("Database error in GetActiveAPIKey: %v", err)
+		return nil, err
+	}
+	return key, nil
+}
+
+func (r *APIKeyRepository) ListAPIKeys(userID int) ([]model.APIKey, error) {
+	rows, err := r.db.Query(`SELECT `+apiKeyColumns+` FROM api_keys WHERE user_id = $1 AND revoked_at IS NULL ORDER BY created_at DESC`, userID)
+	if err != nil {
+		r.logs.Error.Printf("Database error in ListAPIKeys: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []model.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			r.logs.Error.Printf("Database error in ListAPIKeys: %v", err)
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *APIKeyRepository) CountActiveAPIKeys(userID int) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM api_keys WHERE user_id = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())`
+	if err := r.db.QueryRow(query, userID).Scan(&count); err != nil {
+		r.logs.Error.Printf("Database error in CountActiveAPIKeys: %v", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// TouchAPIKey records a use. Writes are throttled to one a minute per key.
+func (r *APIKeyRepository) TouchAPIKey(keyID int) error {
+	query := `UPDATE api_keys SET last_used_at = NOW() WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`
+	if _, err := r.db.Exec(query, keyID); err != nil {
+		r.logs.Error.Printf("Database error in TouchAPIKey: %v", err)
+		return errors.New("database error: failed to update api key")
+	}
+	return nil
+}
+
+func (r *APIKeyRepository) RevokeAPIKey(userID int, keyID int) (bool, error) {
+	result, err := r.db.Exec(`UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL`, time.Now(), keyID, userID)
+	if err != nil {
+		r.logs.Error.Printf("Database error in RevokeAPIKey: %v", err)
+		return false, errors.New("database error: failed to revoke api key")
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		r.logs.Error.Printf("Database error in RevokeAPIKey: %v", err)
+		return false, errors.New("database error: failed to revoke api key")
+	}
+	return rows > 0, nil
+}
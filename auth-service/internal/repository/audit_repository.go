@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"strings"
+	"time"
+)
+
+const auditEventColumns = `id, type, actor_type, actor_id, target_id, COALESCE(ip, ''), COALESCE(user_agent, ''),
+	COALESCE(ip_hash, ''), COALESCE(user_agent_hash, ''), COALESCE(request_id, ''), details, prev_hash, hash, created_at`
+
+type AuditRepository struct {
+	db   *sql.DB
+	logs *logger.Logger
+}
+
+func NewAuditRepository(db *sql.DB, logs *logger.Logger) *AuditRepository {
+	return &AuditRepository{db: db, logs: logs}
+}
+
+func scanAuditEvent(row rowScanner) (*model.AuditEvent, error) {
+	var event model.AuditEvent
+	var details []byte
+	err := row.Scan(&event.ID, &event.Type, &event.ActorType, &event.ActorID, &event.TargetID, &event.IP, &event.UserAgent,
+		&event.IPHash, &event.UserAgentHash, &event.RequestID, &details, &event.PrevHash, &event.Hash, &event.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if len(details) > 0 {
+		if err := json.Unmarshal(details, &event.Details); err != nil {
+			return nil, err
+		}
+	}
+	return &event, nil
+}
+
+// InsertAuditEvent links the event to the newest row and stores it. The table
+// lock makes concurrent writers take turns, so no two events share a
+// predecessor; readers are not blocked.
+func (r *AuditRepository) InsertAuditEvent(event *model.AuditEvent) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		r.logs.Error.Printf("Database error in InsertAuditEvent: %v", err)
+		return errors.New("database error: failed to insert audit event")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`LOCK TABLE audit_events IN EXCLUSIVE MODE`); err != nil {
+		r.logs.Error.Printf("Database error in InsertAuditEvent: %v", err)
+		return errors.New("database error: failed to insert audit event")
+	}
+	var prevHash string
+	err = tx.QueryRow(`SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1`).Scan(&prevHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		r.logs.Error.Printf("Database error in InsertAuditEvent: %v", err)
+		return errors.New("database error: failed to insert audit event")
+	}
+
+	// Stored with microsecond precision, which the hash has to match.
+	event.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	if len(event.Details) == 0 {
+		event.Details = nil
+	}
+	event.PrevHash = prevHash
+	event.Hash = event.ChainHash()
+
+	var details []byte
+	if event.Details != nil {
+		if details, err = json.Marshal(event.Details); err != nil {
+			return errors.New("database error: failed to insert audit event")
+		}
+	}
+	query := `INSERT INTO audit_events (type, actor_type, actor_id, target_id, ip, user_agent, ip_hash, user_agent_hash, request_id,
+		details, prev_hash, hash, created_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, ''), $10, $11, $12, $13) RETURNING id`
+	err = tx.QueryRow(query, event.Type, event.ActorType, event.ActorID, event.TargetID, event.IP, event.UserAgent, event.IPHash, event.UserAgentHash,
+		event.RequestID, details, event.PrevHash, event.Hash, event.CreatedAt).Scan(&event.ID)
+	if err != nil {
+		r.logs.Error.Printf("Database error in InsertAuditEvent: %v", err)
+		return errors.New("database error: failed to insert audit event")
+	}
+	if err := tx.Commit(); err != nil {
+		r.logs.Error.Printf("Database error in InsertAuditEvent: %v", err)
+		return errors.New("database error: failed to insert audit event")
+	}
+	return nil
+}
+
+// RedactAuditEvents erases the IP and user agent of every event the user
+// caused or was the target of. Only the hashes are chained, so the chain
+// stays valid.
+func (r *AuditRepository) RedactAuditEvents(userID int) error {
+	query := `UPDATE audit_events SET ip = NULL, user_agent = NULL
+		WHERE (target_id = $1 OR actor_id = $1) AND (ip IS NOT NULL OR user_agent IS NOT NULL)`
+	if _, err := r.db.Exec(query, userID); err != nil {
+		r.logs.Error.Printf("Database error in RedactAuditEvents: %v", err)
+		return errors.New("database error: failed to redact audit events")
+	}
+	return nil
+}
+
+// ListAuditEvents returns the matching events newest first, and how many match
+// in total.
+func (r *AuditRepository) ListAuditEvents(filter model.AuditFilter) ([]model.AuditEvent, int, error) {
+	var conditions []string
+	var args []any
+
+	if filter.Type != "" {
+		args = append(args, filter.Type)
+		conditions = append(conditions, fmt.Sprintf("type = $%d", len(args)))
+	}
+	if filter.ActorID != nil {
+		args = append(args, *filter.ActorID)
+		conditions = append(conditions, fmt.Sprintf("actor_id = $%d", len(args)))
+	}
+	if filter.TargetID != nil {
+		args = append(args, *filter.TargetID)
+		conditions = append(conditions, fmt.Sprintf("target_id = $%d", len(args)))
+	}
+	if filter.RequestID != "" {
+		args = append(args, filter.RequestID)
+		conditions = append(conditions, fmt.Sprintf("request_id = $%d", len(args)))
+	}
+	if filter.From != nil {
+		args = append(args, filter.From.UTC())
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+	if filter.To != nil {
+		args = append(args, filter.To.UTC())
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM audit_events`+where, args...).Scan(&total); err != nil {
+		r.logs.Error.Printf("Database error in ListAuditEvents: %v", err)
+		return nil, 0, err
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	query := fmt.Sprintf(`SELECT `+auditEventColumns+` FROM audit_events%s ORDER BY id DESC LIMIT $%d OFFSET $%d`, where, len(args)-1, len(args))
+	events, err := r.queryAuditEvents(query, args...)
+	if err != nil {
+		r.logs.Error.Printf("Database error in ListAuditEvents: %v", err)
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+// GetAuditEventsAfter returns up to limit events with an ID above afterID, in
+// chain order.
+func (r *AuditRepository) GetAuditEventsAfter(afterID int64, limit int) ([]model.AuditEvent, error) {
+	query := `SELECT ` + auditEventColumns + ` FROM audit_events WHERE id > $1 ORDER BY id LIMIT $2`
+	events, err := r.queryAuditEvents(query, afterID, limit)
+	if err != nil {
+		r.logs.Error.Printf("Database error in GetAuditEventsAfter: %v", err)
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *AuditRepository) queryAuditEvents(query string, args ...any) ([]model.AuditEvent, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []model.AuditEvent{}
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *event)
+	}
+	return events, rows.Err()
+}
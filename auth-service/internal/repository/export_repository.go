@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"time"
+)
+
+const exportJobColumns = `id, user_id, status, format, COALESCE(file_path, ''), COALESCE(error, ''), expires_at, created_at, completed_at`
+
+type ExportRepository struct {
+	db   *sql.DB
+	logs *logger.Logger
+}
+
+func NewExportRepository(db *sql.DB, logs *logger.Logger) *ExportRepository {
+	return &ExportRepository{db: db, logs: logs}
+}
+
+func (r *ExportRepository) InsertJob(userID int, format string) (*model.ExportJob, error) {
+	query := `INSERT INTO export_jobs (user_id, status, format, created_at) VALUES ($1, $2, $3, $4) RETURNING ` + exportJobColumns
+	job, err := scanExportJob(r.db.QueryRow(query, userID, model.ExportStatusPending, format, time.Now()))
+	if err != nil {
+		r.logs.Error.Printf("Database error in InsertJob: %v", err)
+		return nil, errors.New("database error: failed to create export job")
+	}
+	return job, nil
+}
+
+func (r *ExportRepository) GetJob(jobID int, userID int) (*model.ExportJob, error) {
+	query := `SELECT ` + exportJobColumns + ` FROM export_jobs WHERE id = $1 AND user_id = $2`
+	job, err := scanExportJob(r.db.QueryRow(query, jobID, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		r.logs.Error.Printf("Database error in GetJob: %v", err)
+		return nil, err
+	}
+	return job, nil
+}
+
+func (r *ExportRepository) GetJobByDownloadToken(tokenHash string) (*model.ExportJob, error) {
+	query := `SELECT ` + exportJobColumns + ` FROM export_jobs WHERE download_token_hash = $1 AND status = $2 AND expires_at > $3`
+	job, err := scanExportJob(r.db.QueryRow(query, tokenHash, model.ExportStatusReady, time.Now()))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		r.logs.Error.Printf("Database error in GetJobByDownloadToken: %v", err)
+		return nil, err
+	}
+	return job, nil
+}
+
+// ClaimPendingJob moves the oldest pending job to processing. SKIP LOCKED lets
+// several instances run the worker without picking the same job.
+func (r *ExportRepository) ClaimPendingJob() (*model.ExportJob, error) {
+	query := `UPDATE export_jobs SET status = $1 WHERE id = (
+			SELECT id FROM export_jobs WHERE status = $2 ORDER BY created_at LIMIT 1 FOR UPDATE SKIP LOCKED
+		) RETURNING ` + exportJobColumns
+	job, err := scanExportJob(r.db.QueryRow(query, model.ExportStatusProcessing, model.ExportStatusPending))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		r.logs.Error.Printf("Database error in ClaimPendingJob: %v", err)
+		return nil, err
+	}
+	return job, nil
+}
+
+func (r *ExportRepository) CompleteJob(jobID int, filePath string, tokenHash string, expiresAt time.Time) error {
+	query := `UPDATE export_jobs SET status = $1, file_path = $2, download_token_hash = $3, expires_at = $4, completed_at = $5 WHERE id = $6`
+	_, err := r.db.Exec(query, model.ExportStatusReady, filePath, tokenHash, expiresAt, time.Now(), jobID)
+	if err != nil {
+		r.logs.Error.Printf("Database error in CompleteJob: %v", err)
+		return errors.New("database error: failed to complete export job")
+	}
+	return nil
+}
+
+func (r *ExportRepository) FailJob(jobID int, message string) error {
+	query := `UPDATE export_jobs SET status = $1, error = $2, completed_at = $3 WHERE id = $4`
+	_, err := r.db.Exec(query, model.ExportStatusFailed, message, time.Now(), jobID)
+	if err != nil {
+		r.logs.Error.Printf("Database error in FailJob: %v", err)
+		return errors.New("database error: failed to update export job")
+	}
+	return nil
+}
+
+// ExpireJobs marks ready jobs past their expiry as expired and returns their
+// file paths so the caller can remove the files.
+func (r *ExportRepository) ExpireJobs() ([]string, error) {
+	query := `UPDATE export_jobs SET status = $1, download_token_hash = NULL WHERE status = $2 AND expires_at <= $3 RETURNING COALESCE(file_path, '')`
+	rows, err := r.db.Query(query, model.ExportStatusExpired, model.ExportStatusReady, time.Now())
+	if err != nil {
+		r.logs.Error.Printf("Database error in ExpireJobs: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			r.logs.Error.Printf("Database error in ExpireJobs: %v", err)
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, rows.Err()
+}
+
+func scanExportJob(row rowScanner) (*model.ExportJob, error) {
+	var job model.ExportJob
+	var expiresAt, completedAt sql.NullTime
+	err := row.Scan(&job.ID, &job.UserID, &job.Status, &job.Format, &job.FilePath, &job.Error, &expiresAt, &job.CreatedAt, &completedAt)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		job.ExpiresAt = &expiresAt.Time
+	}
+	if completedAt.Valid {
+		job.CompletedAt = &completedAt.Time
+	}
+	return &job, nil
+}
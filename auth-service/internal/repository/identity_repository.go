@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"time"
+)
+
+type IdentityRepository struct {
+	db   *sql.DB
+	logs *logger.Logger
+}
+
+func NewIdentityRepository(db *sql.DB, logs *logger.Logger) *IdentityRepository {
+	return &IdentityRepository{db: db, logs: logs}
+}
+
+func (r *IdentityRepository) GetIdentity(provider string, subject string) (*model.Identity, error) {
+	query := `SELECT id, user_id, provider, subject, COALESCE(email, ''), created_at, last_used_at FROM user_identities
+		WHERE provider = $1 AND subject = $2`
+
+	var identity model.Identity
+	err := r.db.QueryRow(query, provider, subject).Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject,
+		&identity.Email, &identity.CreatedAt, &identity.LastUsedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		r.logs.Error.Printf("Database error in GetIdentity: %v", err)
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *IdentityRepository) ListIdentities(userID int) ([]model.Identity, error) {
+	query := `SELECT id, user_id, provider, subject, COALESCE(email, ''), created_at, last_used_at FROM user_identities
+		WHERE user_id = $1 ORDER BY created_at`
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		r.logs.Error.Printf("Database error in ListIdentities: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []model.Identity{}
+	for rows.Next() {
+		var identity model.Identity
+		if err := rows.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email,
+			&identity.CreatedAt, &identity.LastUsedAt); err != nil {
+			r.logs.Error.Printf("Database error in ListIdentities: %v", err)
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+// InsertIdentity returns false if the identity is linked to a user already or
+// the user has an identity at that provider.
+func (r *IdentityRepository) InsertIdentity(identity model.Identity) (bool, error) {
+	query := `INSERT INTO user_identities (user_id, provider, subject, email, created_at, last_used_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $5) ON CONFLICT DO NOTHING`
+	result, err := r.db.Exec(query, identity.UserID, identity.Provider, identity.Subject, identity.Email, time.Now())
+	if err != nil {
+		r.logs.Error.Printf("Database error in InsertIdentity: %v", err)
+		return false, errors.New("database error: failed to insert identity")
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		r.logs.Error.Printf("Database error in InsertIdentity: %v", err)
+		return false, errors.New("database error: failed to insert identity")
+	}
+	return rows > 0, nil
+}
+
+// InsertUserWithIdentity creates a verified user signed up through a provider,
+// together with the identity and the event announcing the user, so none of
+// them exists without the others.
+func (r *IdentityRepository) InsertUserWithIdentity(user model.User, identity model.Identity, event model.DomainEvent) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		r.logs.Error.Printf("Database error in InsertUserWithIdentity: %v", err)
+		return -1, errors.New("database error: failed to insert user")
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	query := `INSERT INTO users (name, email, password, status, email_verified_at, created_at, updated_at) VALUES ($1, $2, '', $3, $4, $4, $4) RETURNING id`
+	if err := tx.QueryRow(query, user.Name, user.Email, user.Status, now).Scan(&user.ID); err != nil {
+		if isUniqueViolation(err) {
+			return -1, errors.New("email already in use")
+		}
+		r.logs.Error.Printf("Database error in InsertUserWithIdentity: %v", err)
+		return -1, errors.New("database error: failed to insert user")
+	}
+	query = `INSERT INTO user_identities (user_id, provider, subject, email, created_at, last_used_at) VALUES ($1, $2, $3, NULLIF($4, ''), $5, $5)`
+	if _, err := tx.Exec(query, user.ID, identity.Provider, identity.Subject, identity.Email, now); err != nil {
+		r.logs.Error.Printf("Database error in InsertUserWithIdentity: %v", err)
+		return -1, errors.New("database error: failed to insert identity")
+	}
+	event.UserID = user.ID
+	if err := insertOutboxEvent(tx, event); err != nil {
+		r.logs.Error.Printf("Database error in InsertUserWithIdentity: %v", err)
+		return -1, errors.New("database error: failed to insert user")
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logs.Error.Printf("Database error in InsertUserWithIdentity: %v", err)
+		return -1, errors.New("database error: failed to insert user")
+	}
+	return user.ID, nil
+}
+
+func (r *IdentityRepository) TouchIdentity(identityID int) error {
+	_, err := r.db.Exec(`UPDATE user_identities SET last_used_at = $1 WHERE id = $2`, time.Now(), identityID)
+	if err != nil {
+		r.logs.Error.Printf("Database error in TouchIdentity: %v", err)
+		return errors.New("database error: failed to update identity")
+	}
+	return nil
+}
+
+func (r *IdentityRepository) DeleteIdentity(userID int, identityID int) (bool, error) {
+	result, err := r.db.Exec(`DELETE FROM user_identities WHERE id = $1 AND user_id = $2`, identityID, userID)
+	if err != nil {
+		r.logs.Error.Printf("Database error in DeleteIdentity: %v", err)
+		return false, errors.New("database error: failed to delete identity")
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		r.logs.Error.Printf("Database error in DeleteIdentity: %v", err)
+		return false, errors.New("database error: failed to delete identity")
+	}
+	return rows > 0, nil
+}
+
+func (r *IdentityRepository) CountIdentities(userID int) (int, error) {
+	var count int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM user_identities WHERE user_id = $1`, userID).Scan(&count); err != nil {
+		r.logs.Error.Printf("Database error in CountIdentities: %v", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+func (r *IdentityRepository) InsertSocialState(stateHash string, state model.SocialLoginState) error {
+	query := `INSERT INTO social_login_states (state_hash, provider, nonce, code_verifier, user_id, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := r.db.Exec(query, stateHash, state.Provider, state.Nonce, state.CodeVerifier, state.UserID, state.ExpiresAt, time.Now())
+	if err != nil {
+		r.logs.Error.Printf("Database error in InsertSocialState: %v", err)
+		return errors.New("database error: failed to insert social login state")
+	}
+	return nil
+}
+
+// ConsumeSocialState deletes the state and returns it, or nil if it is
+// unknown, expired or was started for another provider.
+func (r *IdentityRepository) ConsumeSocialState(stateHash string, provider string) (*model.SocialLoginState, error) {
+	query := `DELETE FROM social_login_states WHERE state_hash = $1 AND provider = $2 AND expires_at > NOW()
+		RETURNING provider, nonce, code_verifier, user_id, expires_at`
+
+	var state model.SocialLoginState
+	err := r.db.QueryRow(query, stateHash, provider).Scan(&state.Provider, &state.Nonce, &state.CodeVerifier, &state.UserID, &state.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		r.logs.Error.Printf("Database error in ConsumeSocialState: %v", err)
+		return nil, err
+	}
+	return &state, nil
+}
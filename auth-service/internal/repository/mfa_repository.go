@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"time"
+)
+
+type MFARepository struct {
+	db   *sql.DB
+	logs *logger.Logger
+}
+
+func NewMFARepository(db *sql.DB, logs *logger.Logger) *MFARepository {
+	return &MFARepository{db: db, logs: logs}
+}
+
+func (r *MFARepository) GetTOTPCredential(userID int) (*model.TOTPCredential, error) {
+	query := `SELECT user_id, secret, confirmed_at, last_used_step, created_at FROM totp_credentials WHERE user_id = $1`
+
+	var credential model.TOTPCredential
+	err := r.db.QueryRow(query, userID).Scan(&credential.UserID, &credential.Secret, &credential.ConfirmedAt, &credential.LastUsedStep, &credential.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		r.logs.Error.Printf("Database error in GetTOTPCredential: %v", err)
+		return nil, err
+	}
+	return &credential, nil
+}
+
+// SaveTOTPSecret starts a new enrollment. An unconfirmed secret is replaced,
+// a confirmed one is left alone.
+func (r *MFARepository) SaveTOTPSecret(userID int, secret string) error {
+	query := `INSERT INTO totp_credentials (user_id, secret, created_at) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_used_step = 0, created_at = EXCLUDED.created_at
+		WHERE totp_credentials.confirmed_at IS NULL`
+	result, err := r.db.Exec(query, userID, secret, time.Now())
+	if err != nil {
+		r.logs.Error.Printf("Database error in SaveTOTPSecret: %v", err)
+		return errors.New("database error: failed to save totp secret")
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errors.New("mfa already enabled")
+	}
+	return nil
+}
+
+// ConfirmTOTP enables the credential and replaces the recovery codes in one
+// transaction, so an enabled credential always comes with codes.
+func (r *MFARepository) ConfirmTOTP(userID int, step int64, codeHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		r.logs.Error.Printf("Database error in ConfirmTOTP: %v", err)
+		return errors.New("database error: failed to confirm totp")
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE totp_credentials SET confirmed_at = $1, last_used_step = $2 WHERE user_id = $3 AND confirmed_at IS NULL`
+	result, err := tx.Exec(query, time.Now(), step, userID)
+	if err != nil {
+		r.logs.Error.Printf("Database error in ConfirmTOTP: %v", err)
+		return errors.New("database error: failed to confirm totp")
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errors.New("mfa already enabled")
+	}
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		r.logs.Error.Printf("Database error in ConfirmTOTP: %v", err)
+		return errors.New("database error: failed to confirm totp")
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logs.Error.Printf("Database error in ConfirmTOTP: %v", err)
+		return errors.New("database error: failed to confirm totp")
+	}
+	return nil
+}
+
+// UseTOTPStep records the step of an accepted code. It returns false if that
+// step or a later one was used already, which means the code is a replay.
+func (r *MFARepository) UseTOTPStep(userID int, step int64) (bool, error) {
+	query := `UPDATE totp_credentials SET last_used_step = $1 WHERE user_id = $2 AND last_used_step < $1`
+	result, err := r.db.Exec(query, step, userID)
+	if err != nil {
+		r.logs.Error.Printf("Database error in UseTOTPStep: %v", err)
+		return false, errors.New("database error: failed to use totp step")
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+func (r *MFARepository) DeleteTOTP(userID int) error {
+	_, err := r.db.Exec(`DELETE FROM totp_credentials WHERE user_id = $1`, userID)
+	if err != nil {
+		r.logs.Error.Printf("Database error in DeleteTOTP: %v", err)
+		return errors.New("database error: failed to delete totp")
+	}
+	return nil
+}
+
+func (r *MFARepository) DeleteRecoveryCodes(userID int) error {
+	_, err := r.db.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		r.logs.Error.Printf("Database error in DeleteRecoveryCodes: %v", err)
+		return errors.New("database error: failed to delete recovery codes")
+	}
+	return nil
+}
+
+func (r *MFARepository) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		r.logs.Error.Printf("Database error in ReplaceRecoveryCodes: %v", err)
+		return errors.New("database error: failed to replace recovery codes")
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		r.logs.Error.Printf("Database error in ReplaceRecoveryCodes: %v", err)
+		return errors.New("database error: failed to replace recovery codes")
+	}
+	if err := tx.Commit(); err != nil {
+		r.logs.Error.Printf("Database error in ReplaceRecoveryCodes: %v", err)
+		return errors.New("database error: failed to replace recovery codes")
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, hash := range codeHashes {
+		query := `INSERT INTO mfa_recovery_codes (user_id, code_hash, created_at) VALUES ($1, $2, $3)`
+		if _, err := tx.Exec(query, userID, hash, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConsumeRecoveryCode marks an unused code as used. It returns false if the
+// code is unknown or has been used before.
+func (r *MFARepository) ConsumeRecoveryCode(userID int, codeHash string) (bool, error) {
+	query := `UPDATE mfa_recovery_codes SET used_at = $1 WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL`
+	result, err := r.db.Exec(query, time.Now(), userID, codeHash)
+	if err != nil {
+		r.logs.Error.Printf("Database error in ConsumeRecoveryCode: %v", err)
+		return false, errors.New("database error: failed to consume recovery code")
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+func (r *MFARepository) CountRecoveryCodes(userID int) (int, error) {
+	var count int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL`, userID).Scan(&count)
+	if err != nil {
+		r.logs.Error.Printf("Database error in CountRecoveryCodes: %v", err)
+		return 0, err
+	}
+	return count, nil
+}
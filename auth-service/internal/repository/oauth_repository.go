@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/lib/pq"
+	"time"
+)
+
+const oauthClientColumns = `id, client_id, COALESCE(client_secret_hash, ''), name, type, redirect_uris, grant_types, scopes, created_by, revoked_at, created_at`
+
+type OAuthRepository struct {
+	db   *sql.DB
+	logs *logger.Logger
+}
+
+func NewOAuthRepository(db *sql.DB, logs *logger.Logger) *OAuthRepository {
+	return &OAuthRepository{db: db, logs: logs}
+}
+
+func scanOAuthClient(row rowScanner) (*model.OAuthClient, error) {
+	var client model.OAuthClient
+	err := row.Scan(&client.ID, &client.ClientID, &client.ClientSecretHash, &client.Name, &client.Type, pq.Array(&client.RedirectURIs),
+		pq.Array(&client.GrantTypes), pq.Array(&client.Scopes), &client.CreatedBy, &client.RevokedAt, &client.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+func (r *OAuthRepository) InsertClient(client *model.OAuthClient) error {
+	query := `INSERT INTO oauth_clients (client_id, client_secret_hash, name, type, redirect_uris, grant_types, scopes, created_by, created_at)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7, $8, $9) RETURNING id`
+	client.CreatedAt = time.Now()
+	err := r.db.QueryRow(query, client.ClientID, client.ClientSecretHash, client.Name, client.Type, pq.Array(client.RedirectURIs),
+		pq.Array(client.GrantTypes), pq.Array(client.Scopes), client.CreatedBy, client.CreatedAt).Scan(&client.ID)
+	if err != nil {
+		r.logs.Error.Printf("Database error in InsertClient: %v", err)
+		return errors.New("database error: failed to insert oauth client")
+	}
+	return nil
+}
+
+// GetClient only returns clients that have not been revoked.
+func (r *OAuthRepository) GetClient(clientID string) (*model.OAuthClient, error) {
+	query := `SELECT ` + oauthClientColumns + ` FROM oauth_clients WHERE client_id = $1 AND revoked_at IS NULL`
+	client, err := scanOAuthClient(r.db.QueryRow(query, clientID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		r.logs.Error.Printf("Database error in GetClient: %v", err)
+		return nil, err
+	}
+	return client, nil
+}
+
+// GetServiceAccount finds the active service account with the given name.
+func (r *OAuthRepository) GetServiceAccount(name string) (*model.OAuthClient, error) {
+	query := `SELECT ` + oauthClientColumns + ` FROM oauth_clients WHERE name = $1 AND type = $2 AND revoked_at IS NULL`
+	client, err := scanOAuthClient(r.db.QueryRow(query, name, model.OAuthClientService))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		r.logs.Error.Printf("Database error in GetServiceAccount: %v", err)
+		return nil, err
+	}
+	return client, nil
+}
+
+func (r *OAuthRepository) ListClients() ([]model.OAuthClient, error) {
+	rows, err := r.db.Query(`SELECT ` + oauthClientColumns + ` FROM oauth_clients ORDER BY created_at DESC`)
+	if err != nil {
+		r.logs.Error.Printf("Database error in ListClients: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []model.OAuthClient{}
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+		if err != nil {
+			r.logs.Error.Printf("Database error in ListClients: %v", err)
+			return nil, err
+		}
+		clients = append(clients, *client)
+	}
+	return clients, rows.Err()
+}
+
+// RevokeClient disables the client and drops every refresh token it holds.
+// Access tokens already issued stay valid until they expire.
+func (r *OAuthRepository) RevokeClient(clientID string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		r.logs.Error.Printf("Database error in RevokeClient: %v", err)
+		return errors.New("database error: failed to revoke oauth client")
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(`UPDATE oauth_clients SET revoked_at = $1 WHERE client_id = $2 AND revoked_at IS NULL RETURNING id`, time.Now(), clientID).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("client not found")
+		}
+		r.logs.Error.Printf("Database error in RevokeClient: %v", err)
+		return errors.New("database error: failed to revoke oauth client")
+	}
+	if _, err := tx.Exec(`DELETE FROM refresh_tokens WHERE client_id = $1`, id); err != nil {
+		r.logs.Error.Printf("Database error in RevokeClient: %v", err)
+		return errors.New("database error: failed to revoke oauth client")
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logs.Error.Printf("Database error in RevokeClient: %v", err)
+		return errors.New("database error: failed to revoke oauth client")
+	}
+	return nil
+}
+
+func (r *OAuthRepository) InsertAuthorizationCode(codeHash string, code model.AuthorizationCode) error {
+	query := `INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scope, code_challenge, nonce, auth_time, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, $9, $10)`
+	_, err := r.db.Exec(query, codeHash, code.ClientID, code.UserID, code.RedirectURI, code.Scope, code.CodeChallenge, code.Nonce, code.AuthTime,
+		code.ExpiresAt, time.Now())
+	if err != nil {
+		r.logs.Error.Printf("Database error in InsertAuthorizationCode: %v", err)
+		return errors.New("database error: failed to insert authorization code")
+	}
+	return nil
+}
+
+// ConsumeAuthorizationCode marks a code as used and returns it. It returns nil
+// if the code is unknown, expired, used or belongs to another client.
+func (r *OAuthRepository) ConsumeAuthorizationCode(codeHash string, clientID int) (*model.AuthorizationCode, error) {
+	query := `UPDATE oauth_authorization_codes SET used_at = $1
+		WHERE code_hash = $2 AND client_id = $3 AND used_at IS NULL AND expires_at > $1
+		RETURNING client_id, user_id, redirect_uri, scope, code_challenge, COALESCE(nonce, ''), auth_time, expires_at`
+
+	var code model.AuthorizationCode
+	err := r.db.QueryRow(query, time.Now(), codeHash, clientID).Scan(&code.ClientID, &code.UserID, &code.RedirectURI, &code.Scope,
+		&code.CodeChallenge, &code.Nonce, &code.AuthTime, &code.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		r.logs.Error.Printf("Database error in ConsumeAuthorizationCode: %v", err)
+		return nil, err
+	}
+	return &code, nil
+}
+
+func (r *OAuthRepository) GetConsent(userID int, clientID int) ([]string, error) {
+	var scopes []string
+	err := r.db.QueryRow(`SELECT scopes FROM oauth_consents WHERE user_id = $1 AND client_id = $2`, userID, clientID).Scan(pq.Array(&scopes))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		r.logs.Error.Printf("Database error in GetConsent: %v", err)
+		return nil, err
+	}
+	return scopes, nil
+}
+
+func (r *OAuthRepository) SaveConsent(userID int, clientID int, scopes []string) error {
+	query := `INSERT INTO oauth_consents (user_id, client_id, scopes, updated_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, client_id) DO UPDATE SET scopes = EXCLUDED.scopes, updated_at = EXCLUDED.updated_at`
+	_, err := r.db.Exec(query, userID, clientID, pq.Array(scopes), time.Now())
+	if err != nil {
+		r.logs.Error.Printf("Database error in SaveConsent: %v", err)
+		return errors.New("database error: failed to save consent")
+	}
+	return nil
+}
+
+func (r *OAuthRepository) InsertRefreshToken(userID int, clientID int, token string, grant model.OAuthGrant, expiresAt time.Time) error {
+	query := `INSERT INTO refresh_tokens (user_id, client_id, token, scope, auth_time, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := r.db.Exec(query, userID, clientID, token, grant.Scope, grant.AuthTime, expiresAt, time.Now())
+	if err != nil {
+		r.logs.Error.Printf("Database error in InsertRefreshToken: %v", err)
+		return errors.New("database error: failed to insert refresh token")
+	}
+	return nil
+}
+
+// ConsumeRefreshToken deletes a refresh token issued to the client and returns
+// the grant behind it. Refresh tokens are rotated on every use.
+func (r *OAuthRepository) ConsumeRefreshToken(token string, clientID int) (*model.OAuthGrant, error) {
+	query := `DELETE FROM refresh_tokens WHERE token = $1 AND client_id = $2 AND expires_at > NOW() RETURNING user_id, COALESCE(scope, ''), auth_time`
+
+	var grant model.OAuthGrant
+	err := r.db.QueryRow(query, token, clientID).Scan(&grant.UserID, &grant.Scope, &grant.AuthTime)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		r.logs.Error.Printf("Database error in ConsumeRefreshToken: %v", err)
+		return nil, err
+	}
+	return &grant, nil
+}
+
+// GetRefreshTokenInfo returns nil if the token is unknown or expired.
+func (r *OAuthRepository) GetRefreshTokenInfo(token string) (*model.RefreshTokenInfo, error) {
+	query := `SELECT t.user_id, COALESCE(c.client_id, ''), COALESCE(t.scope, ''), t.expires_at FROM refresh_tokens t
+		LEFT JOIN oauth_clients c ON c.id = t.client_id
+		WHERE t.token = $1 AND t.expires_at > NOW() AND (t.client_id IS NULL OR c.revoked_at IS NULL)`
+
+	var info model.RefreshTokenInfo
+	err := r.db.QueryRow(query, token).Scan(&info.UserID, &info.ClientID, &info.Scope, &info.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		r.logs.Error.Printf("Database error in GetRefreshTokenInfo: %v", err)
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (r *OAuthRepository) DeleteRefreshToken(token string, clientID int) error {
+	_, err := r.db.Exec(`DELETE FROM refresh_tokens WHERE token = $1 AND client_id = $2`, token, clientID)
+	if err != nil {
+		r.logs.Error.Printf("Database error in DeleteRefreshToken: %v", err)
+		return errors.New("database error: failed to delete refresh token")
+	}
+	return nil
+}
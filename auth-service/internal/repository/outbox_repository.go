@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"time"
+)
+
+const outboxColumns = `id, idempotency_key, type, user_id, payload, attempts, created_at`
+
+type OutboxRepository struct {
+	db   *sql.DB
+	logs *logger.Logger
+}
+
+func NewOutboxRepository(db *sql.DB, logs *logger.Logger) *OutboxRepository {
+	return &OutboxRepository{db: db, logs: logs}
+}
+
+func scanDomainEvent(row rowScanner) (*model.DomainEvent, error) {
+	var event model.DomainEvent
+	var payload []byte
+	if err := row.Scan(&event.ID, &event.IdempotencyKey, &event.Type, &event.UserID, &payload, &event.Attempts, &event.OccurredAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(payload, &event.Payload); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// insertOutboxEvent is called by the repositories inside the transaction
+// that makes the change the event announces.
+func insertOutboxEvent(tx *sql.Tx, event model.DomainEvent) error {
+	payload, err := json.Marshal(event.Payload)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO outbox (idempotency_key, type, user_id, payload, available_at, created_at) VALUES ($1, $2, $3, $4, $5, $5)`
+	_, err = tx.Exec(query, event.IdempotencyKey, event.Type, event.UserID, payload, event.OccurredAt)
+	return err
+}
+
+// ClaimOutboxEvents leases up to limit undelivered events. The lease pushes
+// available_at forward, so events of a relay that dies mid-batch are picked
+// up again once it runs out. SKIP LOCKED lets several instances relay at once.
+//
+// Only the oldest undelivered event of each user is claimed, so events of one
+// user are published in the order they happened: a later one waits while an
+// earlier one is leased or waiting for a retry, whichever relay holds it.
+func (r *OutboxRepository) ClaimOutboxEvents(limit int, lease time.Duration) ([]model.DomainEvent, error) {
+	query := `UPDATE outbox SET available_at = $1, attempts = attempts + 1 WHERE id IN (
+			SELECT id FROM outbox WHERE published_at IS NULL AND available_at <= $2
+				AND NOT EXISTS (SELECT 1 FROM outbox earlier WHERE earlier.user_id = outbox.user_id AND earlier.published_at IS NULL AND earlier.id < outbox.id)
+			ORDER BY id LIMIT $3 FOR UPDATE SKIP LOCKED
+		) RETURNING ` + outboxColumns
+	now := time.Now()
+	rows, err := r.db.Query(query, now.Add(lease), now, limit)
+	if err != nil {
+		r.logs.Error.Printf("Database error in ClaimOutboxEvents: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []model.DomainEvent{}
+	for rows.Next() {
+		event, err := scanDomainEvent(rows)
+		if err != nil {
+			r.logs.Error.Printf("Database error in ClaimOutboxEvents: %v", err)
+			return nil, err
+		}
+		events = append(events, *event)
+	}
+	return events, rows.Err()
+}
+
+func (r *OutboxRepository) MarkOutboxEventPublished(eventID int64) error {
+	_, err := r.db.Exec(`UPDATE outbox SET published_at = $1, last_error = NULL WHERE id = $2`, time.Now(), eventID)
+	if err != nil {
+		r.logs.Error.Printf("Database error in MarkOutboxEventPublished: %v", err)
+		return errors.New("database error: failed to update outbox event")
+	}
+	return nil
+}
+
+// RetryOutboxEvent records why delivery failed and when to try again.
+func (r *OutboxRepository) RetryOutboxEvent(eventID int64, message string, retryAt time.Time) error {
+	_, err := r.db.Exec(`UPDATE outbox SET last_error = $1, available_at = $2 WHERE id = $3`, message, retryAt, eventID)
+	if err != nil {
+		r.logs.Error.Printf("Database error in RetryOutboxEvent: %v", err)
+		return errors.New("database error: failed to update outbox event")
+	}
+	return nil
+}
+
+// DeletePublishedOutboxEvents removes delivered events published before the
+// given time and returns how many there were.
+func (r *OutboxRepository) DeletePublishedOutboxEvents(before time.Time) (int64, error) {
+	res, err := r.db.Exec(`DELETE FROM outbox WHERE published_at < $1`, before)
+	if err != nil {
+		r.logs.Error.Printf("Database error in DeletePublishedOutboxEvents: %v", err)
+		return 0, errors.New("database error: failed to delete outbox events")
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"time"
+)
+
+type PasskeyRepository struct {
+	db   *sql.DB
+	logs *logger.Logger
+}
+
+func NewPasskeyRepository(db *sql.DB, logs *logger.Logger) *PasskeyRepository {
+	return &PasskeyRepository{db: db, logs: logs}
+}
+
+// GetOrCreateHandle returns the WebAuthn user handle of the user, generating
+// it on first use with the given candidate.
+func (r *PasskeyRepository) GetOrCreateHandle(userID int, candidate []byte) ([]byte, error) {
+	query := `UPDATE users SET webauthn_handle = COALESCE(webauthn_handle, $1) WHERE id = $2 RETURNING webauthn_handle`
+
+	var handle []byte
+	if err := r.db.QueryRow(query, candidate, userID).Scan(&handle); err != nil {
+		r.logs.Error.Printf("Database error in GetOrCreateHandle: %v", err)
+		return nil, errors.New("database error: failed to get webauthn handle")
+	}
+	return handle, nil
+}
+
+func (r *PasskeyRepository) GetUserIDByHandle(handle []byte) (int, error) {
+	var userID int
+	err := r.db.QueryRow(`SELECT id FROM users WHERE webauthn_handle = $1`, handle).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		r.logs.Error.Printf("Database error in GetUserIDByHandle: %v", err)
+		return 0, err
+	}
+	return userID, nil
+}
+
+func (r *PasskeyRepository) GetPasskeys(userID int) ([]model.Passkey, error) {
+	query := `SELECT id, user_id, credential_id, name, data, sign_count, last_used_at, created_at FROM webauthn_credentials
+		WHERE user_id = $1 ORDER BY created_at`
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		r.logs.Error.Printf("Database error in GetPasskeys: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	passkeys := []model.Passkey{}
+	for rows.Next() {
+		var passkey model.Passkey
+		if err := rows.Scan(&passkey.ID, &passkey.UserID, &passkey.CredentialID, &passkey.Name, &passkey.Data, &passkey.SignCount,
+			&passkey.LastUsedAt, &passkey.CreatedAt); err != nil {
+			r.logs.Error.Printf("Database error in GetPasskeys: %v", err)
+			return nil, err
+		}
+		passkeys = append(passkeys, passkey)
+	}
+	return passkeys, rows.Err()
+}
+
+func (r *PasskeyRepository) CountPasskeys(userID int) (int, error) {
+	var count int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM webauthn_credentials WHERE user_id = $1`, userID).Scan(&count); err != nil {
+		r.logs.Error.Printf("Database error in CountPasskeys: %v", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+func (r *PasskeyRepository) InsertPasskey(passkey *model.Passkey) error {
+	query := `INSERT INTO webauthn_credentials (user_id, credential_id, name, data, sign_count, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+	passkey.CreatedAt = time.Now()
+	err := r.db.QueryRow(query, passkey.UserID, passkey.CredentialID, passkey.Name, passkey.Data, passkey.SignCount, passkey.CreatedAt).Scan(&passkey.ID)
+	if err != nil {
+		r.logs.Error.Printf("Database error in InsertPasskey: %v", err)
+		return errors.New("database error: failed to insert passkey")
+	}
+	return nil
+}
+
+// UpdateSignCount stores the counter of a successful assertion. The update
+// only goes through if the counter moved forward, so two concurrent logins
+// with a cloned authenticator can't both succeed. Authenticators that don't
+// implement counters always report 0.
+func (r *PasskeyRepository) UpdateSignCount(passkeyID int, signCount uint32) (bool, error) {
+	query := `UPDATE webauthn_credentials SET sign_count = $1, last_used_at = $2 WHERE id = $3 AND (sign_count < $1 OR $1 = 0)`
+	result, err := r.db.Exec(query, signCount, time.Now(), passkeyID)
+	if err != nil {
+		r.logs.Error.Printf("Database error in UpdateSignCount: %v", err)
+		return false, errors.New("database error: failed to update sign count")
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+func (r *PasskeyRepository) DeletePasskey(userID int, passkeyID int) error {
+	result, err := r.db.Exec(`DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2`, passkeyID, userID)
+	if err != nil {
+		r.logs.Error.Printf("Database error in DeletePasskey: %v", err)
+		return errors.New("database error: failed to delete passkey")
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errors.New("passkey not found")
+	}
+	return nil
+}
+
+// InsertCeremony stores the state of a started WebAuthn ceremony. userID is 0
+// for passwordless logins, where the user is only known at the end.
+func (r *PasskeyRepository) InsertCeremony(tokenHash string, userID int, ceremony string, data []byte, expiresAt time.Time) error {
+	if _, err := r.db.Exec(`DELETE FROM webauthn_sessions WHERE expires_at < $1`, time.Now()); err != nil {
+		r.logs.Error.Printf("Database error in InsertCeremony: %v", err)
+	}
+
+	query := `INSERT INTO webauthn_sessions (token_hash, user_id, ceremony, data, expires_at, created_at) VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6)`
+	_, err := r.db.Exec(query, tokenHash, userID, ceremony, data, expiresAt, time.Now())
+	if err != nil {
+		r.logs.Error.Printf("Database error in InsertCeremony: %v", err)
+		return errors.New("database error: failed to insert webauthn session")
+	}
+	return nil
+}
+
+// ConsumeCeremony removes a ceremony and returns its owner and state. It
+// returns nil data if the ceremony is unknown, expired or of another kind.
+func (r *PasskeyRepository) ConsumeCeremony(tokenHash string, ceremony string) (int, []byte, error) {
+	query := `DELETE FROM webauthn_sessions WHERE token_hash = $1 AND ceremony = $2 AND expires_at > $3 RETURNING COALESCE(user_id, 0), data`
+
+	var userID int
+	var data []byte
+	err := r.db.QueryRow(query, tokenHash, ceremony, time.Now()).Scan(&userID, &data)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil, nil
+		}
+		r.logs.Error.Printf("Database error in ConsumeCeremony: %v", err)
+		return 0, nil, err
+	}
+	return userID, data, nil
+}
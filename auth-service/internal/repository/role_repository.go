@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"time"
+)
+
+type RoleRepository struct {
+	db   *sql.DB
+	logs *logger.Logger
+}
+
+func NewRoleRepository(db *sql.DB, logs *logger.Logger) *RoleRepository {
+	return &RoleRepository{db: db, logs: logs}
+}
+
+func (r *RoleRepository) GetRoles() ([]model.Role, error) {
+	query := `SELECT r.id, r.name, p.name FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		LEFT JOIN permissions p ON p.id = rp.permission_id
+		ORDER BY r.id, p.name`
+	rows, err := r.db.Query(query)
+	if err != nil {
+		r.logs.Error.Printf("Database error in GetRoles: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []model.Role
+	for rows.Next() {
+		var id int
+		var name string
+		var permission sql.NullString
+		if err := rows.Scan(&id, &name, &permission); err != nil {
+			r.logs.Error.Printf("Database error in GetRoles: %v", err)
+			return nil, err
+		}
+		if len(roles) == 0 || roles[len(roles)-1].ID != id {
+			roles = append(roles, model.Role{ID: id, Name: name, Permissions: []string{}})
+		}
+		if permission.Valid {
+			last := &roles[len(roles)-1]
+			last.Permissions = append(last.Permissions, permission.String)
+		}
+	}
+	return roles, rows.Err()
+}
+
+func (r *RoleRepository) GetUserRoles(userID int) ([]string, error) {
+	query := `SELECT r.name FROM roles r INNER JOIN user_roles ur ON ur.role_id = r.id WHERE ur.user_id = $1 ORDER BY r.name`
+	return r.queryNames("GetUserRoles", query, userID)
+}
+
+func (r *RoleRepository) GetUserPermissions(userID int) ([]string, error) {
+	query := `SELECT DISTINCT p.name FROM permissions p
+		INNER JOIN role_permissions rp ON rp.permission_id = p.id
+		INNER JOIN user_roles ur ON ur.role_id = rp.role_id
+		WHERE ur.user_id = $1 ORDER BY p.name`
+	return r.queryNames("GetUserPermissions", query, userID)
+}
+
+func (r *RoleRepository) AssignRole(userID int, role string) error {
+	query := `INSERT INTO user_roles (user_id, role_id, created_at)
+		SELECT $1, id, $3 FROM roles WHERE name = $2
+		ON CONFLICT (user_id, role_id) DO NOTHING
+		RETURNING role_id`
+
+	var roleID int
+	err := r.db.QueryRow(query, userID, role, time.Now()).Scan(&roleID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Either the role doesn't exist or it is already assigned.
+			exists, err := r.roleExists(role)
+			if err != nil {
+				return errors.New("database error: failed to assign role")
+			}
+			if !exists {
+				return errors.New("role not found")
+			}
+			return nil
+		}
+		r.logs.Error.Printf("Database error in AssignRole: %v", err)
+		return errors.New("database error: failed to assign role")
+	}
+	r.logs.Info.Printf("Role %s assigned to user ID=%d", role, userID)
+	return nil
+}
+
+func (r *RoleRepository) RemoveRole(userID int, role string) error {
+	query := `DELETE FROM user_roles WHERE user_id = $1 AND role_id = (SELECT id FROM roles WHERE name = $2)`
+	res, err := r.db.Exec(query, userID, role)
+	if err != nil {
+		r.logs.Error.Printf("Database error in RemoveRole: %v", err)
+		return errors.New("database error: failed to remove role")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errors.New("role not assigned")
+	}
+	r.logs.Info.Printf("Role %s removed from user ID=%d", role, userID)
+	return nil
+}
+
+func (r *RoleRepository) roleExists(role string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM roles WHERE name = $1)`, role).Scan(&exists)
+	if err != nil {
+		r.logs.Error.Printf("Database error in roleExists: %v", err)
+		return false, err
+	}
+	return exists, nil
+}
+
+func (r *RoleRepository) queryNames(op string, query string, args ...any) ([]string, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		r.logs.Error.Printf("Database error in %s: %v", op, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			r.logs.Error.Printf("Database error in %s: %v", op, err)
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"time"
+)
+
+type SessionRepository struct {
+	db   *sql.DB
+	logs *logger.Logger
+}
+
+func NewSessionRepository(db *sql.DB, logs *logger.Logger) *SessionRepository {
+	return &SessionRepository{db: db, logs: logs}
+}
+
+func (r *SessionRepository) GetActiveSessions(userID int) ([]model.Session, error) {
+	query := `SELECT id, COALESCE(ip, ''), COALESCE(user_agent, ''), created_at, expires_at FROM refresh_tokens
+		WHERE user_id = $1 AND client_id IS NULL AND expires_at > NOW() ORDER BY created_at DESC`
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		r.logs.Error.Printf("Database error in GetActiveSessions: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []model.Session{}
+	for rows.Next() {
+		var session model.Session
+		if err := rows.Scan(&session.ID, &session.IP, &session.UserAgent, &session.CreatedAt, &session.ExpiresAt); err != nil {
+			r.logs.Error.Printf("Database error in GetActiveSessions: %v", err)
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *SessionRepository) InsertLoginEvent(userID int, client model.ClientInfo, success bool, reason string) error {
+	query := `INSERT INTO login_history (user_id, ip, user_agent, country, success, reason, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, NULLIF($6, ''), $7)`
+	_, err := r.db.Exec(query, userID, client.IP, client.UserAgent, client.Country, success, reason, time.Now())
+	if err != nil {
+		r.logs.Error.Printf("Database error in InsertLoginEvent: %v", err)
+		return errors.New("database error: failed to insert login event")
+	}
+	return nil
+}
+
+func (r *SessionRepository) GetLoginHistory(userID int, limit int) ([]model.LoginEvent, error) {
+	query := `SELECT id, COALESCE(ip, ''), COALESCE(user_agent, ''), COALESCE(country, ''), success, COALESCE(reason, ''), created_at FROM login_history
+		WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2`
+	rows, err := r.db.Query(query, userID, limit)
+	if err != nil {
+		r.logs.Error.Printf("Database error in GetLoginHistory: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []model.LoginEvent{}
+	for rows.Next() {
+		var event model.LoginEvent
+		if err := rows.Scan(&event.ID, &event.IP, &event.UserAgent, &event.Country, &event.Success, &event.Reason, &event.CreatedAt); err != nil {
+			r.logs.Error.Printf("Database error in GetLoginHistory: %v", err)
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// GetLastLoginAt returns when the user last signed in successfully, or nil if
+// there is no record of it.
+func (r *SessionRepository) GetLastLoginAt(userID int) (*time.Time, error) {
+	var lastLogin *time.Time
+	err := r.db.QueryRow(`SELECT MAX(created_at) FROM login_history WHERE user_id = $1 AND success`, userID).Scan(&lastLogin)
+	if err != nil {
+		r.logs.Error.Printf("Database error in GetLastLoginAt: %v", err)
+		return nil, err
+	}
+	return lastLogin, nil
+}
+
+// GetKnownClients returns the clients the user signed in from successfully
+// since the given time, together with the ones behind their active sessions.
+func (r *SessionRepository) GetKnownClients(userID int, since time.Time) ([]model.ClientInfo, error) {
+	query := `SELECT DISTINCT COALESCE(ip, ''), COALESCE(user_agent, ''), COALESCE(country, '') FROM login_history
+		WHERE user_id = $1 AND success AND created_at > $2
+		UNION
+		SELECT DISTINCT COALESCE(ip, ''), COALESCE(user_agent, ''), '' FROM refresh_tokens
+		WHERE user_id = $1 AND expires_at > NOW()`
+	rows, err := r.db.Query(query, userID, since)
+	if err != nil {
+		r.logs.Error.Printf("Database error in GetKnownClients: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []model.ClientInfo{}
+	for rows.Next() {
+		var client model.ClientInfo
+		if err := rows.Scan(&client.IP, &client.UserAgent, &client.Country); err != nil {
+			r.logs.Error.Printf("Database error in GetKnownClients: %v", err)
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	return clients, rows.Err()
+}
@@ -1,10 +1,13 @@
 package repository
 
 import (
-	"auth-service/internal/logger"
-	"auth-service/internal/model"
 	"database/sql"
 	"errors"
+	"fmt"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/lib/pq"
+	"strings"
 	"time"
 )
 
@@ -16,6 +19,19 @@ import (
 //	DeleteRefreshToken(token string) error
 //}
 
+const userColumns = `id, name, email, password, status, token_version, failed_login_attempts, locked_until, email_verified_at, deletion_scheduled_at, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// isUniqueViolation reports whether a statement failed on a unique index,
+// which for users means the email is taken.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
 type UserRepository struct {
 	db   *sql.DB
 	logs *logger.Logger
@@ -25,11 +41,10 @@ func NewUserRepository(db *sql.DB, logs *logger.Logger) *UserRepository {
 	return &UserRepository{db: db, logs: logs}
 }
 
+// GetUserByEmail ignores case, like the unique index on users.
 func (r *UserRepository) GetUserByEmail(email string) (*model.User, error) {
-	var user model.User
-
-	query := `SELECT id, name, email, password, created_at, updated_at  FROM users WHERE email = $1`
-	err := r.db.QueryRow(query, email).Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt)
+	query := `SELECT ` + userColumns + ` FROM users WHERE LOWER(email) = LOWER($1)`
+	user, err := scanUser(r.db.QueryRow(query, email))
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -38,44 +53,64 @@ func (r *UserRepository) GetUserByEmail(email string) (*model.User, error) {
 		r.logs.Error.Printf("Database error in GetUserEmail: %v", err)
 		return nil, err
 	}
-	return &user, nil
+	return user, nil
 }
 
 func (r *UserRepository) GetUserByID(id int) (*model.User, error) {
-	var user model.User
-
-	query := `SELECT id, name, email, password, created_at, updated_at  FROM users WHERE id = $1`
-	err := r.db.QueryRow(query, id).Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt)
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+	user, err := scanUser(r.db.QueryRow(query, id))
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
-		r.logs.Error.Printf("Database error in GetUserEmail: %v", err)
+		r.logs.Error.Printf("Database error in GetUserByID: %v", err)
 		return nil, err
 	}
-	return &user, nil
+	return user, nil
 }
 
-func (r *UserRepository) InsertUser(user model.User) (int, error) {
-	query := `INSERT INTO users (name, email, password, created_at, updated_at) VALUES ($1,$2,$3,$4,$4) RETURNING id`
-
-	err := r.db.QueryRow(query, user.Name, user.Email, user.Password, user.CreatedAt).Scan(&user.ID)
+// InsertUser stores the user and the event announcing it in one transaction.
+// The UserID of the event is taken from the new row. It fails with "email
+// already in use" if a concurrent registration took the address first.
+func (r *UserRepository) InsertUser(user model.User, event model.DomainEvent) (int, error) {
+	tx, err := r.db.Begin()
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			r.logs.Error.Printf("Database error in InsertUser: %v", err)
-			return -1, errors.New("database error: failed to insert user")
+		r.logs.Error.Printf("Database error in InsertUser: %v", err)
+		return -1, errors.New("database error: failed to insert user")
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO users (name, email, password, status, created_at, updated_at) VALUES ($1,$2,$3,$4,$5,$5) RETURNING id`
+	if err := tx.QueryRow(query, user.Name, user.Email, user.Password, user.Status, user.CreatedAt).Scan(&user.ID); err != nil {
+		if isUniqueViolation(err) {
+			return -1, errors.New("email already in use")
 		}
+		r.logs.Error.Printf("Database error in InsertUser: %v", err)
+		return -1, errors.New("database error: failed to insert user")
+	}
+	event.UserID = user.ID
+	if err := insertOutboxEvent(tx, event); err != nil {
+		r.logs.Error.Printf("Database error in InsertUser: %v", err)
+		return -1, errors.New("database error: failed to insert user")
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logs.Error.Printf("Database error in InsertUser: %v", err)
 		return -1, errors.New("database error: failed to insert user")
 	}
 	r.logs.Info.Printf("User inserted successfully: ID=%d, Email=%s", user.ID, user.Email)
 	return user.ID, nil
 }
 
-func (r *UserRepository) InsertRefreshToken(user *model.User, token string) error {
-	query := `INSERT INTO refresh_tokens (user_id, token, expires_at, created_at) VALUES ($1, $2, $3, $4);`
+func (r *UserRepository) InsertRefreshToken(user *model.User, token string, client model.ClientInfo, auth model.Authentication) error {
+	query := `INSERT INTO refresh_tokens (user_id, token, ip, user_agent, auth_time, amr, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`
 
-	_, err := r.db.Exec(query, user.ID, token, time.Now().Add(7*24*time.Hour), time.Now())
+	var authTime *time.Time
+	if !auth.Time.IsZero() {
+		authTime = &auth.Time
+	}
+	_, err := r.db.Exec(query, user.ID, token, client.IP, client.UserAgent, authTime, pq.Array(auth.Methods), time.Now().Add(7*24*time.Hour), time.Now())
 	if err != nil {
 		r.logs.Error.Printf("Database error in InsertRefreshToken: %v", err)
 		return errors.New("database error: failed to insert refresh token")
@@ -85,10 +120,9 @@ func (r *UserRepository) InsertRefreshToken(user *model.User, token string) erro
 }
 
 func (r *UserRepository) GetRefreshToken(token string) (*model.User, error) {
-	var user model.User
-	query := `SELECT u.id, u.name, u.email FROM users u INNER JOIN refresh_tokens r ON u.id = r.user_id WHERE r.token = $1 AND r.expires_at > NOW()`
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = (SELECT user_id FROM refresh_tokens WHERE token = $1 AND client_id IS NULL AND expires_at > NOW())`
 
-	err := r.db.QueryRow(query, token).Scan(&user.ID, &user.Name, &user.Email)
+	user, err := scanUser(r.db.QueryRow(query, token))
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -97,7 +131,28 @@ func (r *UserRepository) GetRefreshToken(token string) (*model.User, error) {
 		r.logs.Error.Printf("Database error in GetRefreshToken: %v", err)
 		return nil, err
 	}
-	return &user, nil
+	return user, nil
+}
+
+// GetRefreshTokenAuthentication returns how the session behind the token was
+// signed in. Sessions from before auth_time was recorded have a zero Time.
+func (r *UserRepository) GetRefreshTokenAuthentication(token string) (*model.Authentication, error) {
+	query := `SELECT auth_time, amr FROM refresh_tokens WHERE token = $1 AND client_id IS NULL`
+
+	var authTime sql.NullTime
+	auth := model.Authentication{Methods: []string{}}
+	err := r.db.QueryRow(query, token).Scan(&authTime, pq.Array(&auth.Methods))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		r.logs.Error.Printf("Database error in GetRefreshTokenAuthentication: %v", err)
+		return nil, err
+	}
+	if authTime.Valid {
+		auth.Time = authTime.Time
+	}
+	return &auth, nil
 }
 
 func (r *UserRepository) DeleteRefreshToken(token string) error {
@@ -111,23 +166,397 @@ func (r *UserRepository) DeleteRefreshToken(token string) error {
 	return nil
 }
 
-func (r *UserRepository) UpdateUser(userID int, newUserName string, newUserEmail string) (*model.UserInfo, error) {
-	query := `UPDATE user SET name $1, email $2, updated_at $3 WHERE id $4 RETURNING id, name, email, created_at, updated_at`
-	var userInfo model.UserInfo
-	err := r.db.QueryRow(query, newUserName, newUserEmail, time.Now(), userID).Scan(&userInfo)
+// UpdateUser applies the non-nil fields of update. When expectedUpdatedAt is
+// set the row is only changed if it still carries that timestamp; nil is
+// returned if nothing matched.
+func (r *UserRepository) UpdateUser(userID int, update model.UserUpdate, expectedUpdatedAt *time.Time) (*model.User, error) {
+	query := `UPDATE users SET name = COALESCE($1, name), updated_at = $2
+		WHERE id = $3 AND ($4::timestamp IS NULL OR updated_at = $4)
+		RETURNING ` + userColumns
+
+	var expected *time.Time
+	if expectedUpdatedAt != nil {
+		// timestamp columns drop the offset, and values are read back as UTC.
+		utc := expectedUpdatedAt.UTC()
+		expected = &utc
+	}
+
+	user, err := scanUser(r.db.QueryRow(query, update.Name, time.Now(), userID, expected))
 	if err != nil {
-		//r.logs.Error.Printf("Database error in UpdateUser: %v", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		r.logs.Error.Printf("Database error in UpdateUser: %v", err)
 		return nil, err
 	}
-	return &userInfo, nil
+	return user, nil
 }
 
-func (r *UserRepository) DeleteCurrentUser(userID int) error {
-	query := `DELETE FROM users WHERE id = $1`
-	_, err := r.db.Exec(query, userID)
+func (r *UserRepository) DeleteCurrentUser(userID int, event model.DomainEvent) error {
+	tx, err := r.db.Begin()
 	if err != nil {
 		r.logs.Error.Printf("Database error in DeleteUser: %v", err)
 		return errors.New("database error: failed to delete user")
 	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM users WHERE id = $1`, userID); err != nil {
+		r.logs.Error.Printf("Database error in DeleteUser: %v", err)
+		return errors.New("database error: failed to delete user")
+	}
+	if err := insertOutboxEvent(tx, event); err != nil {
+		r.logs.Error.Printf("Database error in DeleteUser: %v", err)
+		return errors.New("database error: failed to delete user")
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logs.Error.Printf("Database error in DeleteUser: %v", err)
+		return errors.New("database error: failed to delete user")
+	}
 	return nil
 }
+
+func (r *UserRepository) SoftDeleteUser(userID int, scheduledAt time.Time) error {
+	query := `UPDATE users SET status = $1, deletion_scheduled_at = $2, token_version = token_version + 1, updated_at = $3 WHERE id = $4`
+	_, err := r.db.Exec(query, model.UserStatusDeleted, scheduledAt, time.Now(), userID)
+	if err != nil {
+		r.logs.Error.Printf("Database error in SoftDeleteUser: %v", err)
+		return errors.New("database error: failed to delete user")
+	}
+	return nil
+}
+
+// RestoreUser cancels a scheduled deletion. It returns false if the grace
+// period is over or the account was not scheduled for deletion.
+func (r *UserRepository) RestoreUser(userID int) (bool, error) {
+	query := `UPDATE users SET status = CASE WHEN email_verified_at IS NULL THEN $1 ELSE $2 END,
+		deletion_scheduled_at = NULL, updated_at = $3
+		WHERE id = $4 AND status = $5 AND anonymized_at IS NULL AND deletion_scheduled_at > $3`
+	res, err := r.db.Exec(query, model.UserStatusPending, model.UserStatusActive, time.Now(), userID, model.UserStatusDeleted)
+	if err != nil {
+		r.logs.Error.Printf("Database error in RestoreUser: %v", err)
+		return false, errors.New("database error: failed to restore user")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.New("database error: failed to restore user")
+	}
+	return n > 0, nil
+}
+
+func (r *UserRepository) GetUsersDueForErasure(limit int) ([]int, error) {
+	query := `SELECT id FROM users WHERE status = $1 AND anonymized_at IS NULL AND deletion_scheduled_at <= $2 ORDER BY deletion_scheduled_at LIMIT $3`
+	rows, err := r.db.Query(query, model.UserStatusDeleted, time.Now(), limit)
+	if err != nil {
+		r.logs.Error.Printf("Database error in GetUsersDueForErasure: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			r.logs.Error.Printf("Database error in GetUsersDueForErasure: %v", err)
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// AnonymizeUser strips all personal data but keeps the row, so records in
+// other services that reference the user ID stay consistent.
+func (r *UserRepository) AnonymizeUser(userID int, event model.DomainEvent) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		r.logs.Error.Printf("Database error in AnonymizeUser: %v", err)
+		return errors.New("database error: failed to anonymize user")
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	statements := []struct {
+		query string
+		args  []any
+	}{
+		{`UPDATE users SET name = 'Deleted user', email = $1, password = '', email_verified_at = NULL, locked_until = NULL,
+			failed_login_attempts = 0, webauthn_handle = NULL, deletion_scheduled_at = NULL, anonymized_at = $2, updated_at = $2 WHERE id = $3`,
+			[]any{fmt.Sprintf("deleted-%d@anonymized.invalid", userID), now, userID}},
+		{`DELETE FROM refresh_tokens WHERE user_id = $1`, []any{userID}},
+		{`DELETE FROM user_tokens WHERE user_id = $1`, []any{userID}},
+		{`DELETE FROM user_roles WHERE user_id = $1`, []any{userID}},
+		{`DELETE FROM login_history WHERE user_id = $1`, []any{userID}},
+		{`DELETE FROM export_jobs WHERE user_id = $1`, []any{userID}},
+		{`DELETE FROM totp_credentials WHERE user_id = $1`, []any{userID}},
+		{`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, []any{userID}},
+		{`DELETE FROM webauthn_credentials WHERE user_id = $1`, []any{userID}},
+		{`DELETE FROM webauthn_sessions WHERE user_id = $1`, []any{userID}},
+		{`DELETE FROM oauth_authorization_codes WHERE user_id = $1`, []any{userID}},
+		{`DELETE FROM oauth_consents WHERE user_id = $1`, []any{userID}},
+		{`DELETE FROM user_identities WHERE user_id = $1`, []any{userID}},
+		{`DELETE FROM social_login_states WHERE user_id = $1`, []any{userID}},
+		{`DELETE FROM api_keys WHERE user_id = $1`, []any{userID}},
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement.query, statement.args...); err != nil {
+			r.logs.Error.Printf("Database error in AnonymizeUser: %v", err)
+			return errors.New("database error: failed to anonymize user")
+		}
+	}
+	if err := insertOutboxEvent(tx, event); err != nil {
+		r.logs.Error.Printf("Database error in AnonymizeUser: %v", err)
+		return errors.New("database error: failed to anonymize user")
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logs.Error.Printf("Database error in AnonymizeUser: %v", err)
+		return errors.New("database error: failed to anonymize user")
+	}
+	return nil
+}
+
+// likeEscaper makes wildcards in a search term match literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (r *UserRepository) ListUsers(filter model.UserFilter) ([]model.User, int, error) {
+	var conditions []string
+	var args []any
+
+	if filter.Email != "" {
+		args = append(args, "%"+likeEscaper.Replace(filter.Email)+"%")
+		conditions = append(conditions, fmt.Sprintf(`email ILIKE $%d ESCAPE '\'`, len(args)))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	}
+	if filter.CreatedAfter != nil {
+		args = append(args, *filter.CreatedAfter)
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+	if filter.CreatedBefore != nil {
+		args = append(args, *filter.CreatedBefore)
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM users`+where, args...).Scan(&total); err != nil {
+		r.logs.Error.Printf("Database error in ListUsers: %v", err)
+		return nil, 0, err
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	query := fmt.Sprintf(`SELECT `+userColumns+` FROM users%s ORDER BY id LIMIT $%d OFFSET $%d`, where, len(args)-1, len(args))
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		r.logs.Error.Printf("Database error in ListUsers: %v", err)
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []model.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			r.logs.Error.Printf("Database error in ListUsers: %v", err)
+			return nil, 0, err
+		}
+		users = append(users, *user)
+	}
+	return users, total, rows.Err()
+}
+
+// UpdateUserStatus also bumps the token version so that access tokens issued
+// before the change stop being accepted.
+func (r *UserRepository) UpdateUserStatus(userID int, status string) error {
+	query := `UPDATE users SET status = $1, token_version = token_version + 1, failed_login_attempts = 0, locked_until = NULL,
+		deletion_scheduled_at = CASE WHEN $1 = 'deleted' THEN deletion_scheduled_at END, updated_at = $2 WHERE id = $3`
+	_, err := r.db.Exec(query, status, time.Now(), userID)
+	if err != nil {
+		r.logs.Error.Printf("Database error in UpdateUserStatus: %v", err)
+		return errors.New("database error: failed to update user status")
+	}
+	return nil
+}
+
+func (r *UserRepository) EmailExists(email string, excludeUserID int) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(email) = LOWER($1) AND id <> $2)`
+
+	var exists bool
+	if err := r.db.QueryRow(query, email, excludeUserID).Scan(&exists); err != nil {
+		r.logs.Error.Printf("Database error in EmailExists: %v", err)
+		return false, err
+	}
+	return exists, nil
+}
+
+// UpdateEmail returns false if another user already owns the address,
+// ignoring case. The NOT EXISTS check covers the usual case; the unique index
+// catches a concurrent change to the same address. The event is written in
+// the same transaction, only when the email changed.
+func (r *UserRepository) UpdateEmail(userID int, email string, event model.DomainEvent) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		r.logs.Error.Printf("Database error in UpdateEmail: %v", err)
+		return false, errors.New("database error: failed to update email")
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE users SET email = $1, email_verified_at = $2, updated_at = $2
+		WHERE id = $3 AND NOT EXISTS (SELECT 1 FROM users WHERE LOWER(email) = LOWER($1) AND id <> $3)`
+	res, err := tx.Exec(query, email, time.Now(), userID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return false, nil
+		}
+		r.logs.Error.Printf("Database error in UpdateEmail: %v", err)
+		return false, errors.New("database error: failed to update email")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.New("database error: failed to update email")
+	}
+	if n == 0 {
+		return false, nil
+	}
+	if err := insertOutboxEvent(tx, event); err != nil {
+		r.logs.Error.Printf("Database error in UpdateEmail: %v", err)
+		return false, errors.New("database error: failed to update email")
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logs.Error.Printf("Database error in UpdateEmail: %v", err)
+		return false, errors.New("database error: failed to update email")
+	}
+	return true, nil
+}
+
+func (r *UserRepository) MarkEmailVerified(userID int) error {
+	query := `UPDATE users SET email_verified_at = $1, status = CASE WHEN status = $2 THEN $3 ELSE status END, updated_at = $1 WHERE id = $4`
+	_, err := r.db.Exec(query, time.Now(), model.UserStatusPending, model.UserStatusActive, userID)
+	if err != nil {
+		r.logs.Error.Printf("Database error in MarkEmailVerified: %v", err)
+		return errors.New("database error: failed to verify email")
+	}
+	return nil
+}
+
+func (r *UserRepository) IncrementTokenVersion(userID int) error {
+	query := `UPDATE users SET token_version = token_version + 1 WHERE id = $1`
+	_, err := r.db.Exec(query, userID)
+	if err != nil {
+		r.logs.Error.Printf("Database error in IncrementTokenVersion: %v", err)
+		return errors.New("database error: failed to update token version")
+	}
+	return nil
+}
+
+// RecordFailedLogin counts a failed login in a single statement, so parallel
+// attempts can't lose increments and a status an admin set in the meantime is
+// left alone. Accounts in a lock are skipped. An active account, or one whose
+// lock has run out, is locked once maxAttempts is reached (0 disables
+// locking), for lockDuration doubled with every further failure and capped at
+// maxLockDuration (0 for no cap). It returns the new count and the end of the
+// lock this failure started, or nil.
+func (r *UserRepository) RecordFailedLogin(userID int, maxAttempts int, lockDuration time.Duration, maxLockDuration time.Duration) (int, *time.Time, error) {
+	query := `UPDATE users SET failed_login_attempts = failed_login_attempts + 1,
+			status = CASE WHEN status <> $8 AND failed_login_attempts + 1 >= $2 THEN $3 ELSE status END,
+			locked_until = CASE WHEN status <> $8 AND failed_login_attempts + 1 >= $2
+				THEN $4::timestamp + make_interval(secs => LEAST($5::float8 * POWER(2, LEAST(failed_login_attempts + 1 - $2, 30)), $6::float8))
+				ELSE locked_until END
+		WHERE id = $7 AND (status IN ($1, $8) OR (status = $3 AND (locked_until IS NULL OR locked_until <= $4::timestamp)))
+		RETURNING failed_login_attempts, status, locked_until`
+
+	var threshold, maxSeconds any
+	if maxAttempts > 0 {
+		threshold = maxAttempts
+	}
+	if maxLockDuration > 0 {
+		maxSeconds = maxLockDuration.Seconds()
+	}
+
+	var attempts int
+	var status string
+	var lockedUntil sql.NullTime
+	err := r.db.QueryRow(query, model.UserStatusActive, threshold, model.UserStatusLocked, time.Now(), lockDuration.Seconds(), maxSeconds,
+		userID, model.UserStatusPending).Scan(&attempts, &status, &lockedUntil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil, nil
+		}
+		r.logs.Error.Printf("Database error in RecordFailedLogin: %v", err)
+		return 0, nil, errors.New("database error: failed to record failed login")
+	}
+	if status != model.UserStatusLocked || !lockedUntil.Valid {
+		return attempts, nil, nil
+	}
+	return attempts, &lockedUntil.Time, nil
+}
+
+// ExpireLock lifts an expired lock but keeps the failed attempt counter, so
+// the next failure locks the account again for longer.
+func (r *UserRepository) ExpireLock(userID int) error {
+	query := `UPDATE users SET locked_until = NULL, status = $1 WHERE id = $2 AND status = $3`
+	_, err := r.db.Exec(query, model.UserStatusActive, userID, model.UserStatusLocked)
+	if err != nil {
+		r.logs.Error.Printf("Database error in ExpireLock: %v", err)
+		return errors.New("database error: failed to expire lock")
+	}
+	return nil
+}
+
+func (r *UserRepository) ResetFailedLogins(userID int) error {
+	query := `UPDATE users SET failed_login_attempts = 0, locked_until = NULL, status = CASE WHEN status = $1 THEN $2 ELSE status END WHERE id = $3`
+	_, err := r.db.Exec(query, model.UserStatusLocked, model.UserStatusActive, userID)
+	if err != nil {
+		r.logs.Error.Printf("Database error in ResetFailedLogins: %v", err)
+		return errors.New("database error: failed to reset failed logins")
+	}
+	return nil
+}
+
+func (r *UserRepository) UpdatePassword(userID int, passwordHash string) error {
+	query := `UPDATE users SET password = $1, updated_at = $2 WHERE id = $3`
+	_, err := r.db.Exec(query, passwordHash, time.Now(), userID)
+	if err != nil {
+		r.logs.Error.Printf("Database error in UpdatePassword: %v", err)
+		return errors.New("database error: failed to update password")
+	}
+	return nil
+}
+
+func (r *UserRepository) DeleteUserRefreshTokens(userID int) error {
+	query := `DELETE FROM refresh_tokens WHERE user_id = $1`
+	_, err := r.db.Exec(query, userID)
+	if err != nil {
+		r.logs.Error.Printf("Database error in DeleteUserRefreshTokens: %v", err)
+		return errors.New("database error: failed to delete refresh tokens")
+	}
+	return nil
+}
+
+func scanUser(row rowScanner) (*model.User, error) {
+	var user model.User
+	var lockedUntil, emailVerifiedAt, deletionScheduledAt sql.NullTime
+	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Status, &user.TokenVersion,
+		&user.FailedLoginAttempts, &lockedUntil, &emailVerifiedAt, &deletionScheduledAt, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if lockedUntil.Valid {
+		user.LockedUntil = &lockedUntil.Time
+	}
+	if emailVerifiedAt.Valid {
+		user.EmailVerifiedAt = &emailVerifiedAt.Time
+	}
+	if deletionScheduledAt.Valid {
+		user.DeletionScheduledAt = &deletionScheduledAt.Time
+	}
+	return &user, nil
+}
@@ -0,0 +1,223 @@
+package repository
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/finance-app/finance-app/auth-service/internal/testdb"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMain runs the tests in UTC like the servers: the timestamp columns keep
+// the wall-clock time they are given and read it back as UTC.
+func TestMain(m *testing.M) {
+	time.Local = time.UTC
+	os.Exit(m.Run())
+}
+
+func newTestUserRepository(t *testing.T) *UserRepository {
+	t.Helper()
+	return NewUserRepository(testdb.Open(t), testdb.Logger())
+}
+
+func testEvent(eventType string) model.DomainEvent {
+	key := make([]byte, 16)
+	rand.Read(key)
+	return model.DomainEvent{IdempotencyKey: hex.EncodeToString(key), Type: eventType, Payload: map[string]string{}, OccurredAt: time.Now()}
+}
+
+func insertTestUser(t *testing.T, r *UserRepository, name string, email string) *model.User {
+	t.Helper()
+	user := model.User{Name: name, Email: email, Password: "hash", Status: model.UserStatusActive, CreatedAt: time.Now()}
+	id, err := r.InsertUser(user, testEvent(model.EventUserRegistered))
+	if err != nil {
+		t.Fatalf("InsertUser(%s): %v", email, err)
+	}
+	stored, err := r.GetUserByID(id)
+	if err != nil || stored == nil {
+		t.Fatalf("GetUserByID(%d) = %v, %v", id, stored, err)
+	}
+	return stored
+}
+
+func TestUpdateUser(t *testing.T) {
+	r := newTestUserRepository(t)
+	user := insertTestUser(t, r, "Alice", "alice@example.com")
+
+	t.Run("only supplied fields change", func(t *testing.T) {
+		updated, err := r.UpdateUser(user.ID, model.UserUpdate{}, nil)
+		if err != nil || updated == nil {
+			t.Fatalf("UpdateUser = %v, %v", updated, err)
+		}
+		if updated.Name != "Alice" || updated.Email != "alice@example.com" {
+			t.Fatalf("empty update changed the user: %+v", updated)
+		}
+	})
+
+	t.Run("matching updated_at", func(t *testing.T) {
+		current, _ := r.GetUserByID(user.ID)
+		name := "Alice Liddell"
+		updated, err := r.UpdateUser(user.ID, model.UserUpdate{Name: &name}, &current.UpdatedAt)
+		if err != nil || updated == nil {
+			t.Fatalf("UpdateUser = %v, %v", updated, err)
+		}
+		if updated.Name != name {
+			t.Fatalf("name = %q, want %q", updated.Name, name)
+		}
+		if !updated.UpdatedAt.After(current.UpdatedAt) {
+			t.Fatalf("updated_at did not move: %v -> %v", current.UpdatedAt, updated.UpdatedAt)
+		}
+	})
+
+	t.Run("stale updated_at", func(t *testing.T) {
+		stale := user.UpdatedAt
+		name := "Mallory"
+		updated, err := r.UpdateUser(user.ID, model.UserUpdate{Name: &name}, &stale)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated != nil {
+			t.Fatalf("UpdateUser with a stale updated_at = %+v, want nil", updated)
+		}
+		current, _ := r.GetUserByID(user.ID)
+		if current.Name == name {
+			t.Fatal("stale update was applied")
+		}
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		name := "Nobody"
+		updated, err := r.UpdateUser(user.ID+1000, model.UserUpdate{Name: &name}, nil)
+		if err != nil || updated != nil {
+			t.Fatalf("UpdateUser = %v, %v, want nil, nil", updated, err)
+		}
+	})
+}
+
+func TestEmailIgnoresCase(t *testing.T) {
+	r := newTestUserRepository(t)
+	alice := insertTestUser(t, r, "Alice", "alice@example.com")
+	bob := insertTestUser(t, r, "Bob", "bob@example.com")
+
+	found, err := r.GetUserByEmail("ALICE@Example.com")
+	if err != nil || found == nil || found.ID != alice.ID {
+		t.Fatalf("GetUserByEmail = %v, %v, want user %d", found, err, alice.ID)
+	}
+
+	_, err = r.InsertUser(model.User{Name: "Copy", Email: "Alice@Example.COM", Password: "hash", Status: model.UserStatusActive, CreatedAt: time.Now()},
+		testEvent(model.EventUserRegistered))
+	if err == nil || err.Error() != "email already in use" {
+		t.Fatalf("InsertUser with a differently cased email: %v, want email already in use", err)
+	}
+
+	exists, err := r.EmailExists("BOB@example.com", alice.ID)
+	if err != nil || !exists {
+		t.Fatalf("EmailExists = %v, %v, want true", exists, err)
+	}
+	exists, err = r.EmailExists("BOB@example.com", bob.ID)
+	if err != nil || exists {
+		t.Fatalf("EmailExists excluding the owner = %v, %v, want false", exists, err)
+	}
+
+	updated, err := r.UpdateEmail(bob.ID, "ALICE@example.com", testEvent(model.EventUserEmailChanged))
+	if err != nil || updated {
+		t.Fatalf("UpdateEmail to a taken address = %v, %v, want false, nil", updated, err)
+	}
+}
+
+func TestListUsersEscapesWildcards(t *testing.T) {
+	r := newTestUserRepository(t)
+	insertTestUser(t, r, "Underscore", "a_b@example.com")
+	insertTestUser(t, r, "Letter", "axb@example.com")
+	insertTestUser(t, r, "Percent", "100%@example.com")
+
+	tests := []struct {
+		search string
+		want   []string
+	}{
+		{"a_b", []string{"a_b@example.com"}},
+		{"%", []string{"100%@example.com"}},
+		{"AXB", []string{"axb@example.com"}},
+		{`\`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.search, func(t *testing.T) {
+			users, total, err := r.ListUsers(model.UserFilter{Email: tt.search, Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != len(tt.want) || len(users) != len(tt.want) {
+				t.Fatalf("got %d users (total %d), want %v", len(users), total, tt.want)
+			}
+			for i, email := range tt.want {
+				if users[i].Email != email {
+					t.Fatalf("user %d = %s, want %s", i, users[i].Email, email)
+				}
+			}
+		})
+	}
+}
+
+func TestRecordFailedLogin(t *testing.T) {
+	t.Run("concurrent attempts all count", func(t *testing.T) {
+		r := newTestUserRepository(t)
+		user := insertTestUser(t, r, "Alice", "alice@example.com")
+
+		const attempts = 20
+		var wg sync.WaitGroup
+		for range attempts {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, _, err := r.RecordFailedLogin(user.ID, 0, time.Minute, time.Hour); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		stored, _ := r.GetUserByID(user.ID)
+		if stored.FailedLoginAttempts != attempts {
+			t.Fatalf("failed attempts = %d, want %d", stored.FailedLoginAttempts, attempts)
+		}
+		if stored.Status != model.UserStatusActive {
+			t.Fatalf("status = %s, want active without a threshold", stored.Status)
+		}
+	})
+
+	t.Run("lock doubles up to the cap", func(t *testing.T) {
+		r := newTestUserRepository(t)
+		user := insertTestUser(t, r, "Bob", "bob@example.com")
+
+		want := []time.Duration{0, 0, time.Minute, 2 * time.Minute, 3 * time.Minute}
+		for i, lock := range want {
+			start := time.Now()
+			attempts, lockedUntil, err := r.RecordFailedLogin(user.ID, 3, time.Minute, 3*time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if attempts != i+1 {
+				t.Fatalf("attempt %d counted as %d", i+1, attempts)
+			}
+			if lock == 0 {
+				if lockedUntil != nil {
+					t.Fatalf("attempt %d locked the account until %v", i+1, lockedUntil)
+				}
+				continue
+			}
+			if lockedUntil == nil {
+				t.Fatalf("attempt %d did not lock the account", i+1)
+			}
+			if got := lockedUntil.Sub(start); got < lock-time.Second || got > lock+time.Second {
+				t.Fatalf("attempt %d locked for %v, want %v", i+1, got, lock)
+			}
+			// Only attempts after the lock ran out count, so expire it.
+			if err := r.ExpireLock(user.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"time"
+)
+
+type UserTokenRepository struct {
+	db   *sql.DB
+	logs *logger.Logger
+}
+
+func NewUserTokenRepository(db *sql.DB, logs *logger.Logger) *UserTokenRepository {
+	return &UserTokenRepository{db: db, logs: logs}
+}
+
+func (r *UserTokenRepository) InsertToken(userID int, purpose string, tokenHash string, expiresAt time.Time) error {
+	return r.InsertTokenWithPayload(userID, purpose, tokenHash, "", expiresAt)
+}
+
+func (r *UserTokenRepository) InsertTokenWithPayload(userID int, purpose string, tokenHash string, payload string, expiresAt time.Time) error {
+	query := `INSERT INTO user_tokens (user_id, purpose, token_hash, payload, expires_at, created_at) VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6)`
+	_, err := r.db.Exec(query, userID, purpose, tokenHash, payload, expiresAt, time.Now())
+	if err != nil {
+		r.logs.Error.Printf("Database error in InsertToken: %v", err)
+		return errors.New("database error: failed to insert token")
+	}
+	return nil
+}
+
+// ConsumeToken marks a valid token as used and returns its owner. It returns
+// 0 if the token is unknown, expired or has been used already.
+func (r *UserTokenRepository) ConsumeToken(purpose string, tokenHash string) (int, error) {
+	userID, _, err := r.ConsumeTokenWithPayload(purpose, tokenHash)
+	return userID, err
+}
+
+func (r *UserTokenRepository) ConsumeTokenWithPayload(purpose string, tokenHash string) (int, string, error) {
+	query := `UPDATE user_tokens SET used_at = $1 WHERE token_hash = $2 AND purpose = $3 AND used_at IS NULL AND expires_at > $1 RETURNING user_id, COALESCE(payload, '')`
+
+	var userID int
+	var payload string
+	err := r.db.QueryRow(query, time.Now(), tokenHash, purpose).Scan(&userID, &payload)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, "", nil
+		}
+		r.logs.Error.Printf("Database error in ConsumeToken: %v", err)
+		return 0, "", err
+	}
+	return userID, payload, nil
+}
+
+func (r *UserTokenRepository) InvalidateTokens(userID int, purpose string) error {
+	query := `UPDATE user_tokens SET used_at = $1 WHERE user_id = $2 AND purpose = $3 AND used_at IS NULL`
+	_, err := r.db.Exec(query, time.Now(), userID, purpose)
+	if err != nil {
+		r.logs.Error.Printf("Database error in InvalidateTokens: %v", err)
+		return errors.New("database error: failed to invalidate tokens")
+	}
+	return nil
+}
+
+func (r *UserTokenRepository) GetLastTokenTime(userID int, purpose string) (*time.Time, error) {
+	query := `SELECT MAX(created_at) FROM user_tokens WHERE user_id = $1 AND purpose = $2`
+
+	var createdAt sql.NullTime
+	if err := r.db.QueryRow(query, userID, purpose).Scan(&createdAt); err != nil {
+		r.logs.Error.Printf("Database error in GetLastTokenTime: %v", err)
+		return nil, err
+	}
+	if !createdAt.Valid {
+		return nil, nil
+	}
+	return &createdAt.Time, nil
+}
@@ -2,45 +2,241 @@ package service
 
 import (
 	"errors"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
 	"github.com/golang-jwt/jwt/v5"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// AccessTokenTTL is the lifetime of every access token the service issues.
+const AccessTokenTTL = 30 * time.Minute
+
+// AccessTokenType is the typ header of access tokens (RFC 9068). ID tokens
+// are signed with the same key, so it keeps them from being used instead.
+const AccessTokenType = "at+jwt"
+
+// JWTService signs access tokens with the OpenID Connect key so that other
+// services verify them against the JWKS. JWTSecret only signs the MFA
+// challenge, which never leaves auth-service.
 type JWTService struct {
 	JWTSecret string
+	signer    *IDTokenSigner
+	audience  string
+}
+
+// AccessClaims describes a user access token. ClientID is set for tokens
+// issued to an OAuth client on the user's behalf; their Permissions are the
+// granted scopes and they never carry roles. APIKeyID is set when the request
+// was authenticated with a personal API key instead of a token. Service is
+// set on client_credentials tokens of service accounts. AuthTime and AMR tell
+// when and how the user last proved who they are; ExpiresAt, when set before
+// signing, shortens the token's lifetime.
+type AccessClaims struct {
+	UserID        int
+	TokenVersion  int
+	EmailVerified bool
+	Roles         []string
+	Permissions   []string
+	ClientID      string
+	APIKeyID      int
+	Service       string
+	AuthTime      time.Time
+	AMR           []string
+	ExpiresAt     time.Time
 }
 
-func NewJWTService(secret string) *JWTService {
-	return &JWTService{JWTSecret: secret}
+func NewJWTService(secret string, signer *IDTokenSigner, audience string) *JWTService {
+	return &JWTService{JWTSecret: secret, signer: signer, audience: audience}
+}
+
+func (c *AccessClaims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
 }
 
-func (s *JWTService) GenerateAccessToken(userID int) (string, error) {
+func (c *AccessClaims) HasPermission(permission string) bool {
+	for _, p := range c.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthenticatedWithin reports whether the user signed in or reauthenticated
+// no longer than maxAge ago.
+func (c *AccessClaims) AuthenticatedWithin(maxAge time.Duration) bool {
+	return !c.AuthTime.IsZero() && time.Since(c.AuthTime) <= maxAge
+}
+
+// HasSecondFactor reports whether a one-time code or passkey was part of the
+// authentication.
+func (c *AccessClaims) HasSecondFactor() bool {
+	for _, method := range c.AMR {
+		if method == model.AMROTP || method == model.AMRWebAuthn || method == model.AMRMFA {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *JWTService) GenerateAccessToken(accessClaims AccessClaims) (string, error) {
 	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(30 * time.Minute).Unix(),
-		"issuer":  "auth-service",
+		"sub":            strconv.Itoa(accessClaims.UserID),
+		"user_id":        accessClaims.UserID,
+		"ver":            accessClaims.TokenVersion,
+		"email_verified": accessClaims.EmailVerified,
+		"roles":          accessClaims.Roles,
+		"scope":          strings.Join(accessClaims.Permissions, " "),
+		"exp":            time.Now().Add(AccessTokenTTL).Unix(),
+	}
+	if !accessClaims.ExpiresAt.IsZero() {
+		claims["exp"] = accessClaims.ExpiresAt.Unix()
+	}
+	if accessClaims.ClientID != "" {
+		claims["client_id"] = accessClaims.ClientID
+	}
+	if !accessClaims.AuthTime.IsZero() {
+		claims["auth_time"] = accessClaims.AuthTime.Unix()
+	}
+	if len(accessClaims.AMR) > 0 {
+		claims["amr"] = accessClaims.AMR
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
+	return s.sign(claims)
+}
 
-	return token.SignedString([]byte(s.JWTSecret))
+func (s *JWTService) ValidateAccessToken(tokenString string) (*AccessClaims, error) {
+	claims, err := s.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, errors.New("invalid claims")
+	}
+
+	accessClaims := &AccessClaims{UserID: int(userID), Roles: []string{}, Permissions: []string{}, AMR: []string{}}
+	if version, ok := claims["ver"].(float64); ok {
+		accessClaims.TokenVersion = int(version)
+	}
+	if verified, ok := claims["email_verified"].(bool); ok {
+		accessClaims.EmailVerified = verified
+	}
+	if roles, ok := claims["roles"].([]interface{}); ok {
+		for _, role := range roles {
+			if name, ok := role.(string); ok {
+				accessClaims.Roles = append(accessClaims.Roles, name)
+			}
+		}
+	}
+	if scope, ok := claims["scope"].(string); ok && scope != "" {
+		accessClaims.Permissions = strings.Fields(scope)
+	}
+	if clientID, ok := claims["client_id"].(string); ok {
+		accessClaims.ClientID = clientID
+	}
+	if authTime, ok := claims["auth_time"].(float64); ok {
+		accessClaims.AuthTime = time.Unix(int64(authTime), 0)
+	}
+	if methods, ok := claims["amr"].([]interface{}); ok {
+		for _, method := range methods {
+			if name, ok := method.(string); ok {
+				accessClaims.AMR = append(accessClaims.AMR, name)
+			}
+		}
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		accessClaims.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+	return accessClaims, nil
+}
+
+// ValidateClientAccessToken accepts only client_credentials tokens, the ones
+// ValidateAccessToken rejects for lack of a user. UserID is left at zero.
+func (s *JWTService) ValidateClientAccessToken(tokenString string) (*AccessClaims, error) {
+	claims, err := s.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	clientID, ok := claims["client_id"].(string)
+	if _, hasUser := claims["user_id"]; !ok || clientID == "" || hasUser {
+		return nil, errors.New("invalid claims")
+	}
+
+	accessClaims := &AccessClaims{ClientID: clientID, Roles: []string{}, Permissions: []string{}}
+	if scope, ok := claims["scope"].(string); ok && scope != "" {
+		accessClaims.Permissions = strings.Fields(scope)
+	}
+	if service, ok := claims["service"].(string); ok {
+		accessClaims.Service = service
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		accessClaims.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+	return accessClaims, nil
+}
+
+// GenerateClientAccessToken issues a client_credentials token. It has no
+// user_id claim, so it is never accepted where a user is expected.
+func (s *JWTService) GenerateClientAccessToken(clientID string, scopes []string) (string, error) {
+	claims := jwt.MapClaims{
+		"sub":       clientID,
+		"client_id": clientID,
+		"scope":     strings.Join(scopes, " "),
+		"exp":       time.Now().Add(AccessTokenTTL).Unix(),
+	}
+	return s.sign(claims)
+}
+
+// GenerateServiceAccessToken issues a client_credentials token to a service
+// account. azp and service name the caller, so receiving services can tell
+// which service they are talking to without a lookup.
+func (s *JWTService) GenerateServiceAccessToken(clientID string, service string, scopes []string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub":       clientID,
+		"client_id": clientID,
+		"azp":       clientID,
+		"service":   service,
+		"scope":     strings.Join(scopes, " "),
+		"iat":       now.Unix(),
+		"exp":       now.Add(ttl).Unix(),
+	}
+	return s.sign(claims)
 }
 
-func (s *JWTService) ValidateAccessToken(tokenString string) (int, error) {
+// sign adds the issuer and audience every access token carries.
+func (s *JWTService) sign(claims jwt.MapClaims) (string, error) {
+	claims["iss"] = s.signer.Issuer()
+	claims["aud"] = s.audience
+	if _, ok := claims["iat"]; !ok {
+		claims["iat"] = time.Now().Unix()
+	}
+	return s.signer.sign(claims, AccessTokenType)
+}
+
+// parse checks the signature, type, issuer, audience and expiry of an access
+// token and returns its claims.
+func (s *JWTService) parse(tokenString string) (jwt.MapClaims, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("invalid token signing method")
+		if token.Header["typ"] != AccessTokenType {
+			return nil, errors.New("invalid token type")
 		}
-		return []byte(s.JWTSecret), nil
-	})
-
+		return s.signer.PublicKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}), jwt.WithIssuer(s.signer.Issuer()),
+		jwt.WithAudience(s.audience), jwt.WithExpirationRequired())
 	if err != nil || !token.Valid {
-		return 0, errors.New("invalid token")
+		return nil, errors.New("invalid token")
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return 0, errors.New("invalid claims")
+		return nil, errors.New("invalid claims")
 	}
-	userID := int(claims["user_id"].(float64))
-	return userID, nil
+	return claims, nil
 }
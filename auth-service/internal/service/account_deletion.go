@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/mailer"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/finance-app/finance-app/auth-service/internal/repository"
+	"time"
+)
+
+const (
+	ErasureModeAnonymize = "anonymize"
+	ErasureModePurge     = "purge"
+)
+
+// DeleteCurrentUser only schedules the deletion. The account is blocked and
+// signed out right away, and can be restored with the emailed link until the
+// grace period ends. Accounts without a password need no password here.
+func (s *UserService) DeleteCurrentUser(userID int, password string, client model.ClientInfo) (*time.Time, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+	if err := s.checkCurrentPassword(user, password, client); err != nil {
+		return nil, err
+	}
+
+	scheduledAt := time.Now().Add(s.config.DeletionGracePeriod)
+	if err := s.repo.SoftDeleteUser(userID, scheduledAt); err != nil {
+		return nil, errors.New("database error: could not delete user")
+	}
+	if err := s.revokeAllSessions(userID); err != nil {
+		return nil, err
+	}
+
+	token := GenerateRefreshToken()
+	if err := s.tokenRepo.InsertToken(userID, model.TokenPurposeAccountRestore, HashToken(token), scheduledAt); err != nil {
+		s.logs.Error.Printf("Failed to create restore token for user ID=%d: %v", userID, err)
+	} else {
+		err = s.mailer.Send(mailer.Message{
+			To:      user.Email,
+			Subject: "Your account is scheduled for deletion",
+			Body: fmt.Sprintf("Hi %s,\n\nYour account will be permanently erased on %s.\nIf you change your mind before then, restore it here:\n\n%s/restore-account?token=%s",
+				user.Name, scheduledAt.Format(time.RFC1123), s.config.AppBaseURL, token),
+		})
+		if err != nil {
+			s.logs.Error.Printf("Failed to send deletion notice to user ID=%d: %v", userID, err)
+		}
+	}
+
+	s.audit.UserEvent(model.AuditDeletionScheduled, userID, client, map[string]string{"scheduled_at": scheduledAt.UTC().Format(time.RFC3339)})
+	s.logs.Info.Printf("User ID=%d scheduled for deletion at %s", userID, scheduledAt.Format(time.RFC3339))
+	return &scheduledAt, nil
+}
+
+func (s *UserService) RestoreAccount(token string, client model.ClientInfo) error {
+	if token == "" {
+		return errors.New("invalid restore token")
+	}
+
+	userID, err := s.tokenRepo.ConsumeToken(model.TokenPurposeAccountRestore, HashToken(token))
+	if err != nil {
+		return errors.New("database error")
+	}
+	if userID == 0 {
+		return errors.New("invalid restore token")
+	}
+
+	restored, err := s.repo.RestoreUser(userID)
+	if err != nil {
+		return errors.New("database error")
+	}
+	if !restored {
+		return errors.New("invalid restore token")
+	}
+	s.tokenState.Invalidate(userID)
+	s.audit.UserEvent(model.AuditAccountRestored, userID, client, nil)
+	s.logs.Info.Printf("Deletion cancelled for user ID=%d", userID)
+	return nil
+}
+
+// AccountErasureJob erases accounts whose deletion grace period has ended.
+// Audit events are kept, as auditors need to see that the erasure happened,
+// but their client details are redacted.
+type AccountErasureJob struct {
+	repo      *repository.UserRepository
+	audit     *AuditLog
+	logs      *logger.Logger
+	mode      string
+	interval  time.Duration
+	batchSize int
+}
+
+func NewAccountErasureJob(repo *repository.UserRepository, audit *AuditLog, logs *logger.Logger, mode string, interval time.Duration) *AccountErasureJob {
+	return &AccountErasureJob{
+		repo:      repo,
+		audit:     audit,
+		logs:      logs,
+		mode:      mode,
+		interval:  interval,
+		batchSize: 100,
+	}
+}
+
+func (j *AccountErasureJob) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		j.RunOnce()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (j *AccountErasureJob) RunOnce() {
+	userIDs, err := j.repo.GetUsersDueForErasure(j.batchSize)
+	if err != nil {
+		j.logs.Error.Printf("Erasure job failed to load users: %v", err)
+		return
+	}
+
+	for _, userID := range userIDs {
+		// Redact first: a failure leaves the account due, so the next run
+		// retries both.
+		if err := j.audit.Redact(userID); err != nil {
+			j.logs.Error.Printf("Erasure job failed to redact audit events of user ID=%d: %v", userID, err)
+			continue
+		}
+		event := newDomainEvent(model.EventUserDeleted, userID, map[string]string{"mode": j.mode})
+		if j.mode == ErasureModePurge {
+			err = j.repo.DeleteCurrentUser(userID, event)
+		} else {
+			err = j.repo.AnonymizeUser(userID, event)
+		}
+		if err != nil {
+			j.logs.Error.Printf("Erasure job failed for user ID=%d: %v", userID, err)
+			continue
+		}
+		j.audit.SystemEvent(model.AuditAccountErased, userID, map[string]string{"mode": j.mode})
+		j.logs.Info.Printf("Erased personal data of user ID=%d (%s)", userID, j.mode)
+	}
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"testing"
+)
+
+// TestCurrentPasswordGuessesAreCounted covers the account changes that ask for
+// the password again: wrong guesses lock the account like failed logins.
+func TestCurrentPasswordGuessesAreCounted(t *testing.T) {
+	tests := []struct {
+		name   string
+		action func(s *UserService, userID int, password string) error
+	}{
+		{"delete account", func(s *UserService, userID int, password string) error {
+			_, err := s.DeleteCurrentUser(userID, password, model.ClientInfo{})
+			return err
+		}},
+		{"change email", func(s *UserService, userID int, password string) error {
+			return s.RequestEmailChange(userID, model.ChangeEmail{NewEmail: "new@example.com", Password: password})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestUserService(t)
+			user := createTestUser(t, s, "known@example.com", testPassword)
+
+			for i := 0; i < s.config.MaxFailedLoginAttempts; i++ {
+				if err := tt.action(s, user.ID, "wrong password"); err == nil || err.Error() != "wrong user password" {
+					t.Fatalf("attempt %d: err = %v, want wrong user password", i+1, err)
+				}
+			}
+			if err := tt.action(s, user.ID, testPassword); err == nil || err.Error() != "account locked" {
+				t.Fatalf("right password on a locked account: err = %v, want account locked", err)
+			}
+		})
+	}
+}
+
+func TestDeleteAccountWithoutPassword(t *testing.T) {
+	s := newTestUserService(t)
+	user := createTestUser(t, s, "social@example.com", testPassword)
+	if err := s.repo.UpdatePassword(user.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.DeleteCurrentUser(user.ID, "", model.ClientInfo{}); err != nil {
+		t.Fatalf("DeleteCurrentUser without a password: %v", err)
+	}
+}
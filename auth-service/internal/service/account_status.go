@@ -0,0 +1,129 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/finance-app/finance-app/auth-service/internal/notifier"
+	"time"
+)
+
+func isLocked(user *model.User) bool {
+	return user.Status == model.UserStatusLocked && user.LockedUntil != nil && time.Now().Before(*user.LockedUntil)
+}
+
+// recordUnknownLogin records a login for an address without an account, or
+// with a deleted one.
+func (s *UserService) recordUnknownLogin(email string, user *model.User, client model.ClientInfo) {
+	if user == nil {
+		s.logs.Info.Printf("Failed login attempt: email not found (%s)", email)
+		s.audit.AnonymousEvent(model.AuditLoginFailed, 0, client, map[string]string{"email_hash": s.audit.Pseudonym(email), "reason": "user not found"})
+		return
+	}
+	s.logs.Info.Printf("Failed login attempt: account deleted (ID=%d)", user.ID)
+	s.audit.AnonymousEvent(model.AuditLoginFailed, user.ID, client, map[string]string{"reason": "account deleted"})
+}
+
+// checkLock rejects logins while a lock is in effect. An expired lock is
+// lifted lazily here, so no background job is needed to unlock accounts. The
+// failed attempt counter survives the unlock and only a successful login
+// resets it.
+func (s *UserService) checkLock(user *model.User) error {
+	if user.Status != model.UserStatusLocked {
+		return nil
+	}
+	if isLocked(user) {
+		s.logs.Info.Printf("Login attempt for locked user ID=%d", user.ID)
+		return errors.New("account locked")
+	}
+	if err := s.repo.ExpireLock(user.ID); err != nil {
+		return errors.New("database error")
+	}
+	user.Status = model.UserStatusActive
+	user.LockedUntil = nil
+	return nil
+}
+
+// recordFailedLogin locks the account once MaxFailedLoginAttempts is reached.
+// Every further failure after a lock has expired locks it again for twice as
+// long, up to MaxAccountLockDuration.
+func (s *UserService) recordFailedLogin(user *model.User, client model.ClientInfo) {
+	attempts, lockedUntil, err := s.repo.RecordFailedLogin(user.ID, s.config.MaxFailedLoginAttempts,
+		s.config.AccountLockDuration, s.config.MaxAccountLockDuration)
+	if err != nil {
+		s.logs.Error.Printf("Failed to record failed login for user ID=%d: %v", user.ID, err)
+		return
+	}
+	if lockedUntil != nil {
+		s.logs.Info.Printf("User ID=%d locked until %s after %d failed logins", user.ID, lockedUntil.Format(time.RFC3339), attempts)
+		s.notify(user, notifier.Event{
+			Type:    notifier.EventAccountLocked,
+			Subject: "Your account was temporarily locked",
+			Text: fmt.Sprintf("After %d failed sign-in attempts your account was locked until %s. You can sign in again after that, or reset your password to regain access right away.",
+				attempts, lockedUntil.Format(time.RFC1123)),
+			Client:     client,
+			OccurredAt: time.Now(),
+		})
+	}
+}
+
+// checkCurrentPassword guards account changes that ask for the password. It is
+// as good a target for guessing as the login form, so wrong guesses count
+// towards the same lock. Accounts created through a provider have no password
+// and rely on the step-up of the route alone.
+func (s *UserService) checkCurrentPassword(user *model.User, password string, client model.ClientInfo) error {
+	if err := s.checkLock(user); err != nil {
+		return err
+	}
+	if user.Password == "" {
+		return nil
+	}
+	if !CheckPasswordHash(password, user.Password) {
+		s.recordFailedLogin(user, client)
+		s.recordLoginEvent(user.ID, client, false, "wrong user password")
+		return errors.New("wrong user password")
+	}
+	if user.FailedLoginAttempts > 0 {
+		if err := s.repo.ResetFailedLogins(user.ID); err != nil {
+			s.logs.Error.Printf("Failed to reset login attempts for user ID=%d: %v", user.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *UserService) checkLoginStatus(user *model.User) error {
+	switch user.Status {
+	case model.UserStatusActive:
+		return nil
+	case model.UserStatusPending:
+		if s.config.UnverifiedUserPolicy == UnverifiedPolicyLimited {
+			return nil
+		}
+		return errors.New("account not verified")
+	case model.UserStatusDisabled:
+		return errors.New("account disabled")
+	case model.UserStatusDeleted:
+		return errors.New("user not found")
+	default:
+		return errors.New("account locked")
+	}
+}
+
+// checkSessionStatus decides whether an existing session may be refreshed.
+// Locked accounts keep their sessions: the lock only guards against password
+// guessing.
+func (s *UserService) checkSessionStatus(user *model.User) error {
+	switch user.Status {
+	case model.UserStatusActive, model.UserStatusLocked:
+		return nil
+	case model.UserStatusPending:
+		if s.config.UnverifiedUserPolicy == UnverifiedPolicyLimited {
+			return nil
+		}
+		return errors.New("account not verified")
+	case model.UserStatusDisabled:
+		return errors.New("account disabled")
+	default:
+		return errors.New("refresh token not found")
+	}
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"errors"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/finance-app/finance-app/auth-service/internal/repository"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type AdminService struct {
+	userRepo    *repository.UserRepository
+	roleRepo    *repository.RoleRepository
+	userService *UserService
+	tokenState  *TokenStateCache
+	audit       *AuditLog
+	logs        *logger.Logger
+}
+
+func NewAdminService(userRepo *repository.UserRepository, roleRepo *repository.RoleRepository, userService *UserService,
+	tokenState *TokenStateCache, audit *AuditLog, logs *logger.Logger) *AdminService {
+	return &AdminService{
+		userRepo:    userRepo,
+		roleRepo:    roleRepo,
+		userService: userService,
+		tokenState:  tokenState,
+		audit:       audit,
+		logs:        logs,
+	}
+}
+
+func (s *AdminService) ListUsers(filter model.UserFilter, page int, pageSize int) (*model.UserList, error) {
+	page, pageSize = normalizePage(page, pageSize)
+	filter.Limit = pageSize
+	filter.Offset = (page - 1) * pageSize
+
+	users, total, err := s.userRepo.ListUsers(filter)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+
+	list := &model.UserList{Users: []model.UserInfo{}, Total: total, Page: page, PageSize: pageSize}
+	for _, user := range users {
+		list.Users = append(list.Users, user.ToInfo())
+	}
+	return list, nil
+}
+
+func (s *AdminService) GetUser(userID int) (*model.AdminUserInfo, error) {
+	user, err := s.getUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := s.roleRepo.GetUserRoles(userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	return &model.AdminUserInfo{UserInfo: user.ToInfo(), Roles: roles}, nil
+}
+
+func (s *AdminService) DisableUser(adminID int, userID int, client model.ClientInfo) error {
+	if adminID == userID {
+		return errors.New("cannot modify own account")
+	}
+	if err := s.changeStatus(userID, model.UserStatusDisabled); err != nil {
+		return err
+	}
+	if err := s.userRepo.DeleteUserRefreshTokens(userID); err != nil {
+		return errors.New("database error")
+	}
+	s.audit.AdminEvent(model.AuditUserDisabled, adminID, userID, client, nil)
+	s.logs.Info.Printf("Admin ID=%d disabled user ID=%d", adminID, userID)
+	return nil
+}
+
+func (s *AdminService) EnableUser(adminID int, userID int, client model.ClientInfo) error {
+	if err := s.changeStatus(userID, model.UserStatusActive); err != nil {
+		return err
+	}
+	s.audit.AdminEvent(model.AuditUserEnabled, adminID, userID, client, nil)
+	s.logs.Info.Printf("Admin ID=%d enabled user ID=%d", adminID, userID)
+	return nil
+}
+
+func (s *AdminService) RevokeSessions(adminID int, userID int, client model.ClientInfo) error {
+	if _, err := s.getUser(userID); err != nil {
+		return err
+	}
+	if err := s.userService.revokeAllSessions(userID); err != nil {
+		return err
+	}
+	s.audit.AdminEvent(model.AuditSessionsRevoked, adminID, userID, client, nil)
+	s.logs.Info.Printf("Admin ID=%d revoked all sessions of user ID=%d", adminID, userID)
+	return nil
+}
+
+// ResetPassword locks the user out of the current password and sessions and
+// emails them a reset link, so the operator never learns the new password.
+func (s *AdminService) ResetPassword(adminID int, userID int, client model.ClientInfo) error {
+	user, err := s.getUser(userID)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := HashPassword(GenerateRefreshToken()[:maxPasswordBytes/2])
+	if err != nil {
+		return errors.New("failed to hash password")
+	}
+	if err := s.userRepo.UpdatePassword(userID, hashedPassword); err != nil {
+		return errors.New("database error")
+	}
+	if err := s.userService.revokeAllSessions(userID); err != nil {
+		return err
+	}
+	if err := s.userService.SendPasswordReset(user); err != nil {
+		s.logs.Error.Printf("Failed to send password reset email to user ID=%d: %v", userID, err)
+		return errors.New("failed to send email")
+	}
+	s.audit.AdminEvent(model.AuditPasswordResetForced, adminID, userID, client, nil)
+	s.logs.Info.Printf("Admin ID=%d triggered password reset of user ID=%d", adminID, userID)
+	return nil
+}
+
+func (s *AdminService) DeleteUser(adminID int, userID int, client model.ClientInfo) error {
+	if adminID == userID {
+		return errors.New("cannot modify own account")
+	}
+	if _, err := s.getUser(userID); err != nil {
+		return err
+	}
+	if err := s.audit.Redact(userID); err != nil {
+		return err
+	}
+	event := newDomainEvent(model.EventUserDeleted, userID, map[string]string{"mode": ErasureModePurge})
+	if err := s.userRepo.DeleteCurrentUser(userID, event); err != nil {
+		return errors.New("database error")
+	}
+	s.tokenState.Invalidate(userID)
+	s.audit.AdminEvent(model.AuditUserDeleted, adminID, userID, client, nil)
+	s.logs.Info.Printf("Admin ID=%d deleted user ID=%d", adminID, userID)
+	return nil
+}
+
+func (s *AdminService) changeStatus(userID int, status string) error {
+	user, err := s.getUser(userID)
+	if err != nil {
+		return err
+	}
+	if !model.CanTransitionStatus(user.Status, status) ||
+		(user.Status == model.UserStatusDeleted && user.DeletionScheduledAt == nil) {
+		return errors.New("invalid status transition")
+	}
+	if err := s.userRepo.UpdateUserStatus(userID, status); err != nil {
+		return errors.New("database error")
+	}
+	s.tokenState.Invalidate(userID)
+	return nil
+}
+
+func (s *AdminService) getUser(userID int) (*model.User, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+	return user, nil
+}
+
+func normalizePage(page int, pageSize int) (int, int) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	return page, pageSize
+}
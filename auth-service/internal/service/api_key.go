@@ -0,0 +1,224 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/finance-app/finance-app/auth-service/internal/notifier"
+	"github.com/finance-app/finance-app/auth-service/internal/repository"
+	"slices"
+	"strings"
+	"time"
+)
+
+const maxAPIKeyNameLength = 100
+
+type APIKeyServiceConfig struct {
+	MaxKeysPerUser int
+	// MaxLifetime caps the expiry of new keys and is the default when none is
+	// given. Zero allows keys that never expire.
+	MaxLifetime time.Duration
+}
+
+type APIKeyService struct {
+	repo     *repository.APIKeyRepository
+	userRepo *repository.UserRepository
+	roleRepo *repository.RoleRepository
+	notifier notifier.Notifier
+	logs     *logger.Logger
+	config   APIKeyServiceConfig
+}
+
+func NewAPIKeyService(repo *repository.APIKeyRepository, userRepo *repository.UserRepository, roleRepo *repository.RoleRepository,
+	notifier notifier.Notifier, logs *logger.Logger, config APIKeyServiceConfig) *APIKeyService {
+	return &APIKeyService{
+		repo:     repo,
+		userRepo: userRepo,
+		roleRepo: roleRepo,
+		notifier: notifier,
+		logs:     logs,
+		config:   config,
+	}
+}
+
+// CreateAPIKey returns the key in clear text this one time. Scopes are limited
+// to permissions the user holds.
+func (s *APIKeyService) CreateAPIKey(userID int, request model.CreateAPIKey) (*model.CreatedAPIKey, error) {
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" || len(request.Name) > maxAPIKeyNameLength {
+		return nil, errors.New("invalid name")
+	}
+	if len(request.Scopes) == 0 {
+		return nil, errors.New("invalid scope")
+	}
+	permissions, err := s.roleRepo.GetUserPermissions(userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	scopes := []string{}
+	for _, scope := range request.Scopes {
+		if !slices.Contains(permissions, scope) {
+			return nil, errors.New("invalid scope")
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	now := time.Now()
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(now) {
+		return nil, errors.New("invalid expiry")
+	}
+	if s.config.MaxLifetime > 0 {
+		latest := now.Add(s.config.MaxLifetime)
+		if request.ExpiresAt == nil {
+			request.ExpiresAt = &latest
+		} else if request.ExpiresAt.After(latest) {
+			return nil, errors.New("invalid expiry")
+		}
+	}
+
+	count, err := s.repo.CountActiveAPIKeys(userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if count >= s.config.MaxKeysPerUser {
+		return nil, errors.New("too many api keys")
+	}
+
+	prefix, rawKey, err := generateAPIKey()
+	if err != nil {
+		return nil, errors.New("failed to generate api key")
+	}
+	key := model.APIKey{
+		UserID:    userID,
+		Name:      request.Name,
+		Prefix:    prefix,
+		KeyHash:   HashToken(rawKey),
+		Scopes:    scopes,
+		ExpiresAt: request.ExpiresAt,
+	}
+	if err := s.repo.InsertAPIKey(&key); err != nil {
+		return nil, errors.New("database error")
+	}
+
+	s.logs.Info.Printf("User ID=%d created API key %s", userID, prefix)
+	if user, err := s.userRepo.GetUserByID(userID); err == nil && user != nil {
+		event := notifier.Event{
+			Type:       notifier.EventAPIKeyCreated,
+			Subject:    "A new API key was created",
+			Text:       fmt.Sprintf("The API key \"%s\" (%s) was created for your account with access to: %s.", key.Name, prefix, strings.Join(scopes, ", ")),
+			OccurredAt: now,
+		}
+		if err := s.notifier.Notify(user, event); err != nil {
+			s.logs.Error.Printf("Failed to send %s notice to user ID=%d: %v", event.Type, userID, err)
+		}
+	}
+	return &model.CreatedAPIKey{APIKey: key, Key: rawKey}, nil
+}
+
+func (s *APIKeyService) ListAPIKeys(userID int) ([]model.APIKey, error) {
+	keys, err := s.repo.ListAPIKeys(userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	return keys, nil
+}
+
+func (s *APIKeyService) RevokeAPIKey(userID int, keyID int) error {
+	revoked, err := s.repo.RevokeAPIKey(userID, keyID)
+	if err != nil {
+		return errors.New("database error")
+	}
+	if !revoked {
+		return errors.New("api key not found")
+	}
+	s.logs.Info.Printf("User ID=%d revoked API key ID=%d", userID, keyID)
+	return nil
+}
+
+// Authenticate turns a key into the same claims an access token would carry,
+// so it passes through the usual token state and permission checks. Scopes
+// the user has lost since the key was created are dropped.
+func (s *APIKeyService) Authenticate(rawKey string) (*AccessClaims, error) {
+	claims, err := s.Inspect(rawKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.TouchAPIKey(claims.APIKeyID); err != nil {
+		s.logs.Error.Printf("Failed to record use of API key ID=%d: %v", claims.APIKeyID, err)
+	}
+	return claims, nil
+}
+
+// Inspect resolves a key like Authenticate but without recording a use, for
+// when somebody other than the key holder looks at it.
+func (s *APIKeyService) Inspect(rawKey string) (*AccessClaims, error) {
+	key, err := s.lookup(rawKey)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.userRepo.GetUserByID(key.UserID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if user == nil {
+		return nil, errors.New("invalid api key")
+	}
+	permissions, err := s.roleRepo.GetUserPermissions(user.ID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	granted := []string{}
+	for _, scope := range key.Scopes {
+		if slices.Contains(permissions, scope) {
+			granted = append(granted, scope)
+		}
+	}
+	claims := &AccessClaims{
+		UserID:        user.ID,
+		TokenVersion:  user.TokenVersion,
+		EmailVerified: user.EmailVerifiedAt != nil,
+		Roles:         []string{},
+		Permissions:   granted,
+		APIKeyID:      key.ID,
+	}
+	if key.ExpiresAt != nil {
+		claims.ExpiresAt = *key.ExpiresAt
+	}
+	return claims, nil
+}
+
+func (s *APIKeyService) lookup(rawKey string) (*model.APIKey, error) {
+	rest, ok := strings.CutPrefix(rawKey, model.APIKeyPrefix)
+	if !ok {
+		return nil, errors.New("invalid api key")
+	}
+	id, _, ok := strings.Cut(rest, "_")
+	if !ok || id == "" {
+		return nil, errors.New("invalid api key")
+	}
+	key, err := s.repo.GetActiveAPIKey(model.APIKeyPrefix + id)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if key == nil || subtle.ConstantTimeCompare([]byte(HashToken(rawKey)), []byte(key.KeyHash)) != 1 {
+		return nil, errors.New("invalid api key")
+	}
+	return key, nil
+}
+
+// generateAPIKey returns keys like fin_1a2b3c4d5e6f_<64 hex chars>. The part
+// up to the second underscore is the public prefix shown in listings.
+func generateAPIKey() (string, string, error) {
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", err
+	}
+	prefix := model.APIKeyPrefix + hex.EncodeToString(id)
+	return prefix, prefix + "_" + GenerateRefreshToken(), nil
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/finance-app/finance-app/auth-service/internal/repository"
+)
+
+const auditVerifyBatchSize = 1000
+
+// AuditLog records who did what to which account. Recording is best effort
+// like the login history: the action has already happened, so a failed write
+// is logged instead of failing the request.
+//
+// Personal data stays out of the hash chain: the client IP and user agent are
+// chained as keyed hashes and can be redacted when the account is erased, and
+// details name accounts by ID or Pseudonym, never by email.
+type AuditLog struct {
+	repo    *repository.AuditRepository
+	hashKey []byte
+	logs    *logger.Logger
+}
+
+func NewAuditLog(repo *repository.AuditRepository, hashKey string, logs *logger.Logger) *AuditLog {
+	return &AuditLog{repo: repo, hashKey: []byte(hashKey), logs: logs}
+}
+
+// Pseudonym returns a keyed hash of value. Equal values map to equal
+// pseudonyms, so events can be correlated, but without the key the value
+// can't be guessed back from a short input like an IP address.
+func (a *AuditLog) Pseudonym(value string) string {
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, a.hashKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Redact erases the client details recorded for the user's events. Unlike
+// recording, it reports failures, as erasure must not silently leave them.
+func (a *AuditLog) Redact(userID int) error {
+	if err := a.repo.RedactAuditEvents(userID); err != nil {
+		return errors.New("database error")
+	}
+	return nil
+}
+
+// UserEvent records something users did to their own account.
+func (a *AuditLog) UserEvent(eventType string, userID int, client model.ClientInfo, details map[string]string) {
+	a.record(eventType, model.AuditActorUser, userID, userID, client, details)
+}
+
+// AdminEvent records an administrator acting on another account.
+func (a *AuditLog) AdminEvent(eventType string, adminID int, userID int, client model.ClientInfo, details map[string]string) {
+	a.record(eventType, model.AuditActorAdmin, adminID, userID, client, details)
+}
+
+// AnonymousEvent records a request that did not prove who sent it. targetID
+// is 0 when no account matched.
+func (a *AuditLog) AnonymousEvent(eventType string, targetID int, client model.ClientInfo, details map[string]string) {
+	a.record(eventType, model.AuditActorAnonymous, 0, targetID, client, details)
+}
+
+// SystemEvent records what background jobs do to an account.
+func (a *AuditLog) SystemEvent(eventType string, userID int, details map[string]string) {
+	a.record(eventType, model.AuditActorSystem, 0, userID, model.ClientInfo{}, details)
+}
+
+func (a *AuditLog) record(eventType string, actorType string, actorID int, targetID int, client model.ClientInfo, details map[string]string) {
+	event := model.AuditEvent{
+		Type:          eventType,
+		ActorType:     actorType,
+		IP:            client.IP,
+		UserAgent:     client.UserAgent,
+		IPHash:        a.Pseudonym(client.IP),
+		UserAgentHash: a.Pseudonym(client.UserAgent),
+		RequestID:     client.RequestID,
+		Details:       details,
+	}
+	if actorID != 0 {
+		event.ActorID = &actorID
+	}
+	if targetID != 0 {
+		event.TargetID = &targetID
+	}
+	if err := a.repo.InsertAuditEvent(&event); err != nil {
+		a.logs.Error.Printf("Failed to record audit event %s for user ID=%d: %v", eventType, targetID, err)
+	}
+}
+
+// ListActivity returns the events concerning the user's own account.
+func (a *AuditLog) ListActivity(userID int, page int, pageSize int) (*model.ActivityList, error) {
+	page, pageSize = normalizePage(page, pageSize)
+	events, total, err := a.repo.ListAuditEvents(model.AuditFilter{TargetID: &userID, Limit: pageSize, Offset: (page - 1) * pageSize})
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+
+	list := &model.ActivityList{Events: []model.ActivityEvent{}, Total: total, Page: page, PageSize: pageSize}
+	for _, event := range events {
+		list.Events = append(list.Events, event.ToActivity())
+	}
+	return list, nil
+}
+
+func (a *AuditLog) ListEvents(filter model.AuditFilter, page int, pageSize int) (*model.AuditEventList, error) {
+	page, pageSize = normalizePage(page, pageSize)
+	filter.Limit = pageSize
+	filter.Offset = (page - 1) * pageSize
+
+	events, total, err := a.repo.ListAuditEvents(filter)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	return &model.AuditEventList{Events: events, Total: total, Page: page, PageSize: pageSize}, nil
+}
+
+// VerifyChain recomputes every hash from the first event on and reports the
+// first row that doesn't match, either because it was changed or because the
+// row before it was.
+func (a *AuditLog) VerifyChain() (*model.AuditVerification, error) {
+	result := &model.AuditVerification{Valid: true}
+	var afterID int64
+	for {
+		events, err := a.repo.GetAuditEventsAfter(afterID, auditVerifyBatchSize)
+		if err != nil {
+			return nil, errors.New("database error")
+		}
+		for _, event := range events {
+			if event.PrevHash != result.LastHash || event.ChainHash() != event.Hash {
+				result.Valid = false
+				result.BrokenAtID = event.ID
+				a.logs.Error.Printf("Audit chain broken at event ID=%d", event.ID)
+				return result, nil
+			}
+			result.EventsChecked++
+			result.LastHash = event.Hash
+			afterID = event.ID
+		}
+		if len(events) < auditVerifyBatchSize {
+			return result, nil
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"time"
+)
+
+// newDomainEvent prepares an event for the outbox. The idempotency key is a
+// random UUID, so it stays the same however often the event is delivered.
+func newDomainEvent(eventType string, userID int, payload map[string]string) model.DomainEvent {
+	return model.DomainEvent{
+		IdempotencyKey: newUUID(),
+		Type:           eventType,
+		UserID:         userID,
+		Payload:        payload,
+		OccurredAt:     time.Now(),
+	}
+}
+
+// newUUID returns a version 4 UUID.
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/finance-app/finance-app/auth-service/internal/mailer"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// RequestEmailChange doesn't touch the account yet. The new address gets a
+// confirmation link and the old one a notice with a link to cancel or revert
+// the change.
+func (s *UserService) RequestEmailChange(userID int, request model.ChangeEmail) error {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return errors.New("database error")
+	}
+	if user == nil {
+		return errors.New("user not found")
+	}
+	if err := s.checkCurrentPassword(user, request.Password, request.Client); err != nil {
+		return err
+	}
+
+	newEmail, err := normalizeEmail(request.NewEmail)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(newEmail, user.Email) {
+		return errors.New("email unchanged")
+	}
+
+	exists, err := s.repo.EmailExists(newEmail, userID)
+	if err != nil {
+		return errors.New("database error")
+	}
+	if exists {
+		return errors.New("email already in use")
+	}
+
+	if err := s.tokenRepo.InvalidateTokens(userID, model.TokenPurposeEmailChange); err != nil {
+		return errors.New("database error")
+	}
+
+	confirmToken := GenerateRefreshToken()
+	confirmExpiresAt := time.Now().Add(s.config.EmailChangeTTL)
+	if err := s.tokenRepo.InsertTokenWithPayload(userID, model.TokenPurposeEmailChange, HashToken(confirmToken), newEmail, confirmExpiresAt); err != nil {
+		return errors.New("database error")
+	}
+
+	undoToken := GenerateRefreshToken()
+	undoExpiresAt := time.Now().Add(s.config.EmailChangeUndoTTL)
+	if err := s.tokenRepo.InsertTokenWithPayload(userID, model.TokenPurposeEmailChangeUndo, HashToken(undoToken), user.Email, undoExpiresAt); err != nil {
+		return errors.New("database error")
+	}
+
+	err = s.mailer.Send(mailer.Message{
+		To:      newEmail,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm that you want to use this address for your account:\n\n%s/confirm-email-change?token=%s\n\nThe link expires at %s.",
+			user.Name, s.config.AppBaseURL, confirmToken, confirmExpiresAt.Format(time.RFC1123)),
+	})
+	if err != nil {
+		s.logs.Error.Printf("Failed to send email change confirmation for user ID=%d: %v", userID, err)
+		return errors.New("failed to send email")
+	}
+
+	err = s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your email address is about to change",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to change the email address of your account to %s.\nIf this wasn't you, cancel the change and sign out all sessions here:\n\n%s/undo-email-change?token=%s\n\nThe link stays valid until %s.",
+			user.Name, newEmail, s.config.AppBaseURL, undoToken, undoExpiresAt.Format(time.RFC1123)),
+	})
+	if err != nil {
+		s.logs.Error.Printf("Failed to send email change notice for user ID=%d: %v", userID, err)
+	}
+
+	s.audit.UserEvent(model.AuditEmailChangeRequested, userID, request.Client, nil)
+	s.logs.Info.Printf("Email change requested for user ID=%d", userID)
+	return nil
+}
+
+func (s *UserService) ConfirmEmailChange(token string, client model.ClientInfo) error {
+	if token == "" {
+		return errors.New("invalid email change token")
+	}
+
+	userID, newEmail, err := s.tokenRepo.ConsumeTokenWithPayload(model.TokenPurposeEmailChange, HashToken(token))
+	if err != nil {
+		return errors.New("database error")
+	}
+	if userID == 0 || newEmail == "" {
+		return errors.New("invalid email change token")
+	}
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return errors.New("database error")
+	}
+	if user == nil {
+		return errors.New("invalid email change token")
+	}
+
+	event := newDomainEvent(model.EventUserEmailChanged, userID, map[string]string{"email": newEmail, "previous_email": user.Email})
+	updated, err := s.repo.UpdateEmail(userID, newEmail, event)
+	if err != nil {
+		return errors.New("database error")
+	}
+	if !updated {
+		return errors.New("email already in use")
+	}
+
+	s.audit.UserEvent(model.AuditEmailChanged, userID, client, nil)
+	s.logs.Info.Printf("Email changed for user ID=%d", userID)
+	return nil
+}
+
+// UndoEmailChange cancels a pending change or reverts a confirmed one, and
+// treats the request as a sign of compromise by ending every session.
+func (s *UserService) UndoEmailChange(token string, client model.ClientInfo) error {
+	if token == "" {
+		return errors.New("invalid email change token")
+	}
+
+	userID, oldEmail, err := s.tokenRepo.ConsumeTokenWithPayload(model.TokenPurposeEmailChangeUndo, HashToken(token))
+	if err != nil {
+		return errors.New("database error")
+	}
+	if userID == 0 || oldEmail == "" {
+		return errors.New("invalid email change token")
+	}
+
+	if err := s.tokenRepo.InvalidateTokens(userID, model.TokenPurposeEmailChange); err != nil {
+		return errors.New("database error")
+	}
+
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return errors.New("database error")
+	}
+	if user == nil {
+		return errors.New("invalid email change token")
+	}
+	if user.Email != oldEmail {
+		event := newDomainEvent(model.EventUserEmailChanged, userID, map[string]string{"email": oldEmail, "previous_email": user.Email})
+		updated, err := s.repo.UpdateEmail(userID, oldEmail, event)
+		if err != nil {
+			return errors.New("database error")
+		}
+		if !updated {
+			return errors.New("email already in use")
+		}
+	}
+
+	if err := s.revokeAllSessions(userID); err != nil {
+		return err
+	}
+	s.audit.UserEvent(model.AuditEmailChangeUndone, userID, client, nil)
+	s.logs.Info.Printf("Email change undone for user ID=%d", userID)
+	return nil
+}
+
+// normalizeEmail lowercases the address. Lookups ignore case anyway; this
+// only keeps the stored form consistent with social sign-ups.
+func normalizeEmail(email string) (string, error) {
+	address, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil || address.Name != "" {
+		return "", errors.New("invalid email")
+	}
+	return strings.ToLower(address.Address), nil
+}
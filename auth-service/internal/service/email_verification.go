@@ -0,0 +1,74 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/finance-app/finance-app/auth-service/internal/mailer"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"time"
+)
+
+func (s *UserService) VerifyEmail(token string) error {
+	if token == "" {
+		return errors.New("invalid verification token")
+	}
+
+	userID, err := s.tokenRepo.ConsumeToken(model.TokenPurposeEmailVerification, HashToken(token))
+	if err != nil {
+		return errors.New("database error")
+	}
+	if userID == 0 {
+		return errors.New("invalid verification token")
+	}
+
+	if err := s.repo.MarkEmailVerified(userID); err != nil {
+		return errors.New("database error")
+	}
+	s.logs.Info.Printf("Email verified for user ID=%d", userID)
+	return nil
+}
+
+// ResendVerificationEmail never reports whether the address is registered or
+// already verified; callers always get the same answer.
+func (s *UserService) ResendVerificationEmail(email string) error {
+	user, err := s.repo.GetUserByEmail(email)
+	if err != nil {
+		return errors.New("database error")
+	}
+	if user == nil || user.EmailVerifiedAt != nil || user.Status != model.UserStatusPending {
+		return nil
+	}
+
+	lastSent, err := s.tokenRepo.GetLastTokenTime(user.ID, model.TokenPurposeEmailVerification)
+	if err != nil {
+		return errors.New("database error")
+	}
+	if lastSent != nil && time.Since(*lastSent) < s.config.VerificationResendInterval {
+		s.logs.Info.Printf("Verification email throttled for user ID=%d", user.ID)
+		return nil
+	}
+
+	if err := s.tokenRepo.InvalidateTokens(user.ID, model.TokenPurposeEmailVerification); err != nil {
+		return errors.New("database error")
+	}
+	if err := s.sendVerificationEmail(user); err != nil {
+		s.logs.Error.Printf("Failed to send verification email to user ID=%d: %v", user.ID, err)
+		return errors.New("failed to send email")
+	}
+	return nil
+}
+
+func (s *UserService) sendVerificationEmail(user *model.User) error {
+	token := GenerateRefreshToken()
+	expiresAt := time.Now().Add(s.config.EmailVerificationTTL)
+	if err := s.tokenRepo.InsertToken(user.ID, model.TokenPurposeEmailVerification, HashToken(token), expiresAt); err != nil {
+		return err
+	}
+
+	return s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s/verify-email?token=%s\n\nThe link expires at %s.",
+			user.Name, s.config.AppBaseURL, token, expiresAt.Format(time.RFC1123)),
+	})
+}
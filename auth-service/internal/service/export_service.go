@@ -0,0 +1,289 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/mailer"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/finance-app/finance-app/auth-service/internal/repository"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	exportLoginHistoryLimit = 1000
+	exportActivityLimit     = 1000
+)
+
+type ExportServiceConfig struct {
+	AppBaseURL   string
+	Dir          string
+	LinkTTL      time.Duration
+	PollInterval time.Duration
+}
+
+type ExportService struct {
+	userRepo    *repository.UserRepository
+	roleRepo    *repository.RoleRepository
+	sessionRepo *repository.SessionRepository
+	exportRepo  *repository.ExportRepository
+	auditRepo   *repository.AuditRepository
+	mailer      mailer.Mailer
+	logs        *logger.Logger
+	config      ExportServiceConfig
+	wake        chan struct{}
+}
+
+func NewExportService(userRepo *repository.UserRepository, roleRepo *repository.RoleRepository, sessionRepo *repository.SessionRepository,
+	exportRepo *repository.ExportRepository, auditRepo *repository.AuditRepository, mailer mailer.Mailer, logs *logger.Logger, config ExportServiceConfig) *ExportService {
+	return &ExportService{
+		userRepo:    userRepo,
+		roleRepo:    roleRepo,
+		sessionRepo: sessionRepo,
+		exportRepo:  exportRepo,
+		auditRepo:   auditRepo,
+		mailer:      mailer,
+		logs:        logs,
+		config:      config,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// BuildExport collects everything stored about the user. The password hash
+// is never part of it.
+func (s *ExportService) BuildExport(userID int) (*model.UserDataExport, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+
+	roles, err := s.roleRepo.GetUserRoles(userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	sessions, err := s.sessionRepo.GetActiveSessions(userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	loginHistory, err := s.sessionRepo.GetLoginHistory(userID, exportLoginHistoryLimit)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	events, _, err := s.auditRepo.ListAuditEvents(model.AuditFilter{TargetID: &userID, Limit: exportActivityLimit})
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	activity := []model.ActivityEvent{}
+	for _, event := range events {
+		activity = append(activity, event.ToActivity())
+	}
+
+	return &model.UserDataExport{
+		GeneratedAt:  time.Now(),
+		Profile:      user.ToInfo(),
+		Roles:        roles,
+		Sessions:     sessions,
+		LoginHistory: loginHistory,
+		Activity:     activity,
+	}, nil
+}
+
+func (s *ExportService) RequestExport(userID int, format string) (*model.ExportJob, error) {
+	if format != model.ExportFormatJSON && format != model.ExportFormatZip {
+		return nil, errors.New("invalid export format")
+	}
+
+	job, err := s.exportRepo.InsertJob(userID, format)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	s.logs.Info.Printf("Data export job ID=%d requested by user ID=%d", job.ID, userID)
+	return job, nil
+}
+
+func (s *ExportService) GetExportJob(userID int, jobID int) (*model.ExportJob, error) {
+	job, err := s.exportRepo.GetJob(jobID, userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if job == nil {
+		return nil, errors.New("export not found")
+	}
+	return job, nil
+}
+
+// GetDownload resolves the token from the emailed link to a ready export.
+func (s *ExportService) GetDownload(token string) (*model.ExportJob, error) {
+	job, err := s.exportRepo.GetJobByDownloadToken(HashToken(token))
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if job == nil {
+		return nil, errors.New("export not found")
+	}
+	return job, nil
+}
+
+func (s *ExportService) GetUserDownload(userID int, jobID int) (*model.ExportJob, error) {
+	job, err := s.GetExportJob(userID, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != model.ExportStatusReady || job.ExpiresAt == nil || time.Now().After(*job.ExpiresAt) {
+		return nil, errors.New("export not ready")
+	}
+	return job, nil
+}
+
+// Run processes pending export jobs and removes expired bundles. It wakes up
+// on every new request and otherwise polls, so jobs left over by another
+// instance are picked up as well.
+func (s *ExportService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.processPendingJobs()
+		s.removeExpiredExports()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+func (s *ExportService) processPendingJobs() {
+	for {
+		job, err := s.exportRepo.ClaimPendingJob()
+		if err != nil || job == nil {
+			return
+		}
+		if err := s.processJob(job); err != nil {
+			s.logs.Error.Printf("Data export job ID=%d failed: %v", job.ID, err)
+			if err := s.exportRepo.FailJob(job.ID, err.Error()); err != nil {
+				s.logs.Error.Printf("Failed to mark export job ID=%d as failed: %v", job.ID, err)
+			}
+		}
+	}
+}
+
+func (s *ExportService) processJob(job *model.ExportJob) error {
+	export, err := s.BuildExport(job.UserID)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.config.Dir, 0o700); err != nil {
+		return fmt.Errorf("create export directory: %w", err)
+	}
+	path := filepath.Join(s.config.Dir, fmt.Sprintf("export-%d-%s.%s", job.ID, GenerateRefreshToken()[:16], job.Format))
+	if job.Format == model.ExportFormatZip {
+		err = writeExportZip(path, export)
+	} else {
+		err = writeExportJSON(path, export)
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	token := GenerateRefreshToken()
+	expiresAt := time.Now().Add(s.config.LinkTTL)
+	if err := s.exportRepo.CompleteJob(job.ID, path, HashToken(token), expiresAt); err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	err = s.mailer.Send(mailer.Message{
+		To:      export.Profile.Email,
+		Subject: "Your data export is ready",
+		Body: fmt.Sprintf("Hi %s,\n\nThe export of your personal data is ready. Download it here:\n\n%s/api/v1/auth/exports/download?token=%s\n\nThe link expires at %s.",
+			export.Profile.Name, s.config.AppBaseURL, token, expiresAt.Format(time.RFC1123)),
+	})
+	if err != nil {
+		s.logs.Error.Printf("Failed to send export link for job ID=%d: %v", job.ID, err)
+	}
+	s.logs.Info.Printf("Data export job ID=%d ready", job.ID)
+	return nil
+}
+
+func (s *ExportService) removeExpiredExports() {
+	paths, err := s.exportRepo.ExpireJobs()
+	if err != nil {
+		return
+	}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			s.logs.Error.Printf("Failed to remove expired export %s: %v", path, err)
+		}
+	}
+}
+
+func writeExportJSON(path string, export *model.UserDataExport) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("create export file: %w", err)
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(export); err != nil {
+		return fmt.Errorf("write export file: %w", err)
+	}
+	return file.Close()
+}
+
+func writeExportZip(path string, export *model.UserDataExport) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("create export file: %w", err)
+	}
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+	sections := []struct {
+		name string
+		data any
+	}{
+		{"export.json", export},
+		{"profile.json", export.Profile},
+		{"roles.json", export.Roles},
+		{"sessions.json", export.Sessions},
+		{"login_history.json", export.LoginHistory},
+	}
+	for _, section := range sections {
+		entry, err := archive.Create(section.name)
+		if err != nil {
+			return fmt.Errorf("write export archive: %w", err)
+		}
+		encoder := json.NewEncoder(entry)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(section.data); err != nil {
+			return fmt.Errorf("write export archive: %w", err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("write export archive: %w", err)
+	}
+	return file.Close()
+}
@@ -1,7 +1,15 @@
 package service
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"golang.org/x/crypto/bcrypt"
+	"sync"
+)
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
 )
 
 func HashPassword(password string) (string, error) {
@@ -13,3 +21,20 @@ func CheckPasswordHash(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+// SimulatePasswordCheck burns the same bcrypt work as CheckPasswordHash for
+// callers that have no real hash to compare against, so response times don't
+// tell whether an account exists.
+func SimulatePasswordCheck(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte(GenerateRefreshToken()), bcrypt.DefaultCost)
+	})
+	bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
+
+// HashToken is used for single-use tokens that are stored at rest. They are
+// random and high-entropy, so a fast digest is enough.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
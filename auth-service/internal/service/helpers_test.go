@@ -0,0 +1,85 @@
+package service
+
+import (
+	"github.com/finance-app/finance-app/auth-service/internal/mailer"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/finance-app/finance-app/auth-service/internal/notifier"
+	"github.com/finance-app/finance-app/auth-service/internal/repository"
+	"github.com/finance-app/finance-app/auth-service/internal/testdb"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestMain runs the tests in UTC like the servers: the timestamp columns keep
+// the wall-clock time they are given and read it back as UTC.
+func TestMain(m *testing.M) {
+	time.Local = time.UTC
+	os.Exit(m.Run())
+}
+
+var testUserServiceConfig = UserServiceConfig{
+	AppBaseURL:             "http://localhost:8081",
+	MaxFailedLoginAttempts: 5,
+	AccountLockDuration:    15 * time.Minute,
+	MaxAccountLockDuration: 24 * time.Hour,
+	LoginAlertLookback:     90 * 24 * time.Hour,
+	UnverifiedUserPolicy:   UnverifiedPolicyBlock,
+	PasswordPolicy:         PasswordPolicy{MinLength: 8},
+	TOTPIssuer:             "Finance App",
+	MFAChallengeTTL:        5 * time.Minute,
+	MFAEncryptionKey:       "test-mfa-encryption-key",
+	PasskeyCeremonyTTL:     5 * time.Minute,
+	SocialStateTTL:         10 * time.Minute,
+	MagicLinkTTL:           15 * time.Minute,
+	StepUpTokenTTL:         5 * time.Minute,
+}
+
+// newTestUserService wires a UserService to a fresh test database the way
+// main does.
+func newTestUserService(t *testing.T, socialProviders ...*SocialProvider) *UserService {
+	t.Helper()
+	db := testdb.Open(t)
+	logs := testdb.Logger()
+	mail := mailer.NewLogMailer(logs, "")
+	userRepo := repository.NewUserRepository(db, logs)
+	return NewUserService(userRepo, repository.NewRoleRepository(db, logs), repository.NewUserTokenRepository(db, logs),
+		repository.NewSessionRepository(db, logs), repository.NewMFARepository(db, logs), repository.NewPasskeyRepository(db, logs),
+		repository.NewIdentityRepository(db, logs), mail, notifier.NewEmailNotifier(mail), logs, newTestJWTService(t),
+		NewTokenStateCache(userRepo, time.Second), NewAuditLog(repository.NewAuditRepository(db, logs), "test-audit-key", logs), newTestWebAuthn(t),
+		socialProviders, testUserServiceConfig)
+}
+
+// newTestJWTService signs with a throwaway key, as main does without
+// OIDC_SIGNING_KEY_FILE.
+func newTestJWTService(t *testing.T) *JWTService {
+	t.Helper()
+	signer, err := NewIDTokenSigner(nil, "http://auth.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewJWTService("test-jwt-secret", signer, "finance-api")
+}
+
+// createTestUser adds an active user with a verified email.
+func createTestUser(t *testing.T, s *UserService, email string, password string) *model.User {
+	t.Helper()
+	hash, err := HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	user := model.User{Name: "Test User", Email: email, Password: hash, Status: model.UserStatusActive, CreatedAt: now}
+	id, err := s.repo.InsertUser(user, newDomainEvent(model.EventUserRegistered, 0, map[string]string{"email": email, "name": user.Name, "method": "password"}))
+	if err != nil {
+		t.Fatalf("InsertUser: %v", err)
+	}
+	if err := s.repo.MarkEmailVerified(id); err != nil {
+		t.Fatalf("MarkEmailVerified: %v", err)
+	}
+	created, err := s.repo.GetUserByID(id)
+	if err != nil || created == nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	return created
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"strconv"
+	"time"
+)
+
+// IDTokenTTL is the lifetime of OpenID Connect ID tokens.
+const IDTokenTTL = 10 * time.Minute
+
+// IDTokenSigner holds the RS256 key behind ID tokens and access tokens, so
+// relying parties and other finance services can verify both against the
+// published JWKS instead of sharing a secret.
+type IDTokenSigner struct {
+	key    *rsa.PrivateKey
+	keyID  string
+	issuer string
+}
+
+type IDTokenClaims struct {
+	UserID        int
+	ClientID      string
+	Nonce         string
+	AuthTime      *time.Time
+	Name          string
+	Email         string
+	EmailVerified *bool
+}
+
+// NewIDTokenSigner loads a PEM encoded RSA key (PKCS#1 or PKCS#8). Without a
+// key it generates one, which only suits a single instance that may
+// invalidate every token on restart.
+func NewIDTokenSigner(pemKey []byte, issuer string) (*IDTokenSigner, error) {
+	var key *rsa.PrivateKey
+	if len(pemKey) == 0 {
+		generated, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		key = generated
+	} else {
+		block, _ := pem.Decode(pemKey)
+		if block == nil {
+			return nil, errors.New("invalid PEM key")
+		}
+		if parsed, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+			key = parsed
+		} else {
+			parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			rsaKey, ok := parsed.(*rsa.PrivateKey)
+			if !ok {
+				return nil, errors.New("signing key is not an RSA key")
+			}
+			key = rsaKey
+		}
+	}
+
+	sum := sha256.Sum256(x509.MarshalPKCS1PublicKey(&key.PublicKey))
+	return &IDTokenSigner{
+		key:    key,
+		keyID:  base64.RawURLEncoding.EncodeToString(sum[:12]),
+		issuer: issuer,
+	}, nil
+}
+
+func (s *IDTokenSigner) Issuer() string {
+	return s.issuer
+}
+
+// PublicKey lets auth-service verify its own tokens without fetching the JWKS.
+func (s *IDTokenSigner) PublicKey() crypto.PublicKey {
+	return &s.key.PublicKey
+}
+
+func (s *IDTokenSigner) Sign(idClaims IDTokenClaims) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss": s.issuer,
+		"sub": strconv.Itoa(idClaims.UserID),
+		"aud": idClaims.ClientID,
+		"iat": now.Unix(),
+		"exp": now.Add(IDTokenTTL).Unix(),
+	}
+	if idClaims.Nonce != "" {
+		claims["nonce"] = idClaims.Nonce
+	}
+	if idClaims.AuthTime != nil {
+		claims["auth_time"] = idClaims.AuthTime.Unix()
+	}
+	if idClaims.Name != "" {
+		claims["name"] = idClaims.Name
+	}
+	if idClaims.Email != "" {
+		claims["email"] = idClaims.Email
+	}
+	if idClaims.EmailVerified != nil {
+		claims["email_verified"] = *idClaims.EmailVerified
+	}
+
+	return s.sign(claims, "JWT")
+}
+
+// sign sets typ so that one kind of token can't be passed off as another.
+func (s *IDTokenSigner) sign(claims jwt.MapClaims, typ string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.keyID
+	token.Header["typ"] = typ
+	return token.SignedString(s.key)
+}
+
+func (s *IDTokenSigner) JWKS() model.JSONWebKeySet {
+	return model.JSONWebKeySet{Keys: []model.JSONWebKey{{
+		KeyType:   "RSA",
+		Use:       "sig",
+		Algorithm: "RS256",
+		KeyID:     s.keyID,
+		Modulus:   base64.RawURLEncoding.EncodeToString(s.key.PublicKey.N.Bytes()),
+		Exponent:  base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.PublicKey.E)).Bytes()),
+	}}}
+}
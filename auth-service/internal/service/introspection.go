@@ -0,0 +1,234 @@
+package service
+
+import (
+	"errors"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// introspectionSweepSize is the cache size above which expired entries are
+// dropped on insert.
+const introspectionSweepSize = 10000
+
+type introspectionEntry struct {
+	result    model.TokenIntrospection
+	client    *model.OAuthClient
+	expiresAt time.Time
+}
+
+// introspectionCache keeps answers for a few seconds, keyed by token hash.
+// Resource servers tend to introspect the same token on every request, and a
+// revocation showing up a few seconds late is the accepted trade-off. Client
+// credentials are cached the same way so bcrypt doesn't run on every call.
+type introspectionCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]introspectionEntry
+}
+
+func newIntrospectionCache(ttl time.Duration) *introspectionCache {
+	return &introspectionCache{ttl: ttl, entries: make(map[string]introspectionEntry)}
+}
+
+func (c *introspectionCache) get(key string) (introspectionEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return introspectionEntry{}, false
+	}
+	return entry, true
+}
+
+// put caches the entry, never beyond the expiry of the token itself.
+func (c *introspectionCache) put(key string, entry introspectionEntry, tokenExpiresAt time.Time) {
+	if c.ttl <= 0 {
+		return
+	}
+	entry.expiresAt = time.Now().Add(c.ttl)
+	if !tokenExpiresAt.IsZero() && tokenExpiresAt.Before(entry.expiresAt) {
+		entry.expiresAt = tokenExpiresAt
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= introspectionSweepSize {
+		now := time.Now()
+		for k, e := range c.entries {
+			if now.After(e.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[key] = entry
+}
+
+// Introspect implements RFC 7662 for confidential clients. A client only
+// learns about tokens issued to itself, unless it is a resource server
+// holding the tokens:introspect scope, which sees every access token and API
+// key. Refresh tokens are only ever visible to the client they were issued to.
+// Looking a token up doesn't count as using it.
+func (s *OAuthService) Introspect(clientID string, clientSecret string, token string, tokenTypeHint string) (*model.TokenIntrospection, error) {
+	client, err := s.authenticateCachedClient(clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return nil, errors.New("invalid_request")
+	}
+
+	key := "token:" + HashToken(token)
+	entry, ok := s.introspections.get(key)
+	if !ok {
+		result, tokenExpiresAt, err := s.introspect(token, tokenTypeHint)
+		if err != nil {
+			return nil, err
+		}
+		entry = introspectionEntry{result: *result}
+		s.introspections.put(key, entry, tokenExpiresAt)
+	}
+
+	result := entry.result
+	if !result.Active || result.ClientID == client.ClientID {
+		return &result, nil
+	}
+	if result.TokenType != "refresh_token" && slices.Contains(client.Scopes, model.ScopeTokensIntrospect) {
+		return &result, nil
+	}
+	return &model.TokenIntrospection{Active: false}, nil
+}
+
+func (s *OAuthService) introspect(token string, tokenTypeHint string) (*model.TokenIntrospection, time.Time, error) {
+	if strings.HasPrefix(token, model.APIKeyPrefix) {
+		return s.introspectAPIKey(token)
+	}
+	if tokenTypeHint == "refresh_token" {
+		if result, expiresAt, err := s.introspectRefreshToken(token); err != nil || result.Active {
+			return result, expiresAt, err
+		}
+		return s.introspectAccessToken(token)
+	}
+	if result, expiresAt, err := s.introspectAccessToken(token); err != nil || result.Active {
+		return result, expiresAt, err
+	}
+	return s.introspectRefreshToken(token)
+}
+
+func (s *OAuthService) introspectAccessToken(token string) (*model.TokenIntrospection, time.Time, error) {
+	inactive := &model.TokenIntrospection{Active: false}
+	claims, err := s.jwtService.ValidateAccessToken(token)
+	if err == nil {
+		if err := s.tokenState.ValidateClaims(claims); err != nil {
+			if err.Error() == "database error" {
+				return nil, time.Time{}, err
+			}
+			return inactive, time.Time{}, nil
+		}
+	} else {
+		claims, err = s.jwtService.ValidateClientAccessToken(token)
+		if err != nil {
+			return inactive, time.Time{}, nil
+		}
+	}
+
+	if claims.ClientID != "" {
+		client, err := s.repo.GetClient(claims.ClientID)
+		if err != nil {
+			return nil, time.Time{}, errors.New("database error")
+		}
+		if client == nil {
+			return inactive, time.Time{}, nil
+		}
+	}
+
+	result := &model.TokenIntrospection{
+		Active:    true,
+		Scope:     strings.Join(claims.Permissions, " "),
+		ClientID:  claims.ClientID,
+		ExpiresAt: claims.ExpiresAt.Unix(),
+		TokenType: "access_token",
+		Service:   claims.Service,
+	}
+	if claims.UserID != 0 {
+		result.Subject = strconv.Itoa(claims.UserID)
+	}
+	return result, claims.ExpiresAt, nil
+}
+
+func (s *OAuthService) introspectRefreshToken(token string) (*model.TokenIntrospection, time.Time, error) {
+	inactive := &model.TokenIntrospection{Active: false}
+	info, err := s.repo.GetRefreshTokenInfo(token)
+	if err != nil {
+		return nil, time.Time{}, errors.New("database error")
+	}
+	if info == nil {
+		return inactive, time.Time{}, nil
+	}
+	state, err := s.tokenState.get(info.UserID)
+	if err != nil {
+		if err.Error() == "database error" {
+			return nil, time.Time{}, err
+		}
+		return inactive, time.Time{}, nil
+	}
+	if state.status == model.UserStatusDisabled || state.status == model.UserStatusDeleted {
+		return inactive, time.Time{}, nil
+	}
+
+	return &model.TokenIntrospection{
+		Active:    true,
+		Scope:     info.Scope,
+		ClientID:  info.ClientID,
+		Subject:   strconv.Itoa(info.UserID),
+		ExpiresAt: info.ExpiresAt.Unix(),
+		TokenType: "refresh_token",
+	}, info.ExpiresAt, nil
+}
+
+func (s *OAuthService) introspectAPIKey(token string) (*model.TokenIntrospection, time.Time, error) {
+	inactive := &model.TokenIntrospection{Active: false}
+	claims, err := s.apiKeys.Inspect(token)
+	if err == nil {
+		err = s.tokenState.ValidateClaims(claims)
+	}
+	if err != nil {
+		if err.Error() == "database error" {
+			return nil, time.Time{}, err
+		}
+		return inactive, time.Time{}, nil
+	}
+
+	result := &model.TokenIntrospection{
+		Active:    true,
+		Scope:     strings.Join(claims.Permissions, " "),
+		Subject:   strconv.Itoa(claims.UserID),
+		TokenType: "api_key",
+	}
+	if !claims.ExpiresAt.IsZero() {
+		result.ExpiresAt = claims.ExpiresAt.Unix()
+	}
+	return result, claims.ExpiresAt, nil
+}
+
+// authenticateCachedClient only admits clients with a secret; a public client
+// has no secret that would prove it is a resource server.
+func (s *OAuthService) authenticateCachedClient(clientID string, clientSecret string) (*model.OAuthClient, error) {
+	key := "client:" + HashToken(clientID+"\x00"+clientSecret)
+	if entry, ok := s.introspections.get(key); ok {
+		return entry.client, nil
+	}
+
+	client, err := s.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if client.Type == model.OAuthClientPublic {
+		return nil, errors.New("invalid_client")
+	}
+	s.introspections.put(key, introspectionEntry{client: client}, time.Time{})
+	return client, nil
+}
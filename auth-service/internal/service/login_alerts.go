@@ -0,0 +1,79 @@
+package service
+
+import (
+	"fmt"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/finance-app/finance-app/auth-service/internal/notifier"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// detectClientChanges compares a login with the user's recent successful
+// logins and active sessions. It returns what is new about the client: its
+// country, its network or its device. The first login of an account has
+// nothing to compare against and never counts as new.
+func (s *UserService) detectClientChanges(userID int, client model.ClientInfo) []string {
+	known, err := s.sessionRepo.GetKnownClients(userID, time.Now().Add(-s.config.LoginAlertLookback))
+	if err != nil {
+		s.logs.Error.Printf("Failed to load known clients for user ID=%d: %v", userID, err)
+		return nil
+	}
+	if len(known) == 0 {
+		return nil
+	}
+
+	network := ipRange(client.IP)
+	knownCountry, knownNetwork, knownDevice := false, false, false
+	countryTracked := false
+	for _, previous := range known {
+		if previous.Country != "" {
+			countryTracked = true
+			knownCountry = knownCountry || previous.Country == client.Country
+		}
+		knownNetwork = knownNetwork || (network != "" && ipRange(previous.IP) == network)
+		knownDevice = knownDevice || previous.UserAgent == client.UserAgent
+	}
+
+	var changes []string
+	if client.Country != "" && countryTracked && !knownCountry {
+		changes = append(changes, "country")
+	}
+	if network != "" && !knownNetwork {
+		changes = append(changes, "network")
+	}
+	if !knownDevice {
+		changes = append(changes, "device")
+	}
+	return changes
+}
+
+func (s *UserService) notifyNewLogin(user *model.User, client model.ClientInfo, changes []string) {
+	s.logs.Info.Printf("Login from new %s for user ID=%d", strings.Join(changes, ", "), user.ID)
+	s.notify(user, notifier.Event{
+		Type:       notifier.EventNewLogin,
+		Subject:    "New sign-in to your account",
+		Text:       fmt.Sprintf("Your account was just signed in to from a new %s.", strings.Join(changes, " and ")),
+		Client:     client,
+		OccurredAt: time.Now(),
+	})
+}
+
+// ipRange groups addresses by network so that a new DHCP lease from the same
+// provider is not reported: /24 for IPv4 and /48 for IPv6.
+func ipRange(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return prefix.String()
+}
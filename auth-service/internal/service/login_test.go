@@ -0,0 +1,123 @@
+package service
+
+import (
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"golang.org/x/crypto/bcrypt"
+	"sort"
+	"testing"
+	"time"
+)
+
+const testPassword = "correct horse battery"
+
+func TestSimulatePasswordCheckCostsLikeARealHash(t *testing.T) {
+	SimulatePasswordCheck("warm up")
+	hash, err := HashPassword(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	realCost, _ := bcrypt.Cost([]byte(hash))
+	dummyCost, _ := bcrypt.Cost(dummyHash)
+	if realCost != dummyCost {
+		t.Errorf("dummy hash cost = %d, real hash cost = %d", dummyCost, realCost)
+	}
+}
+
+func TestLoginFailuresLookAlike(t *testing.T) {
+	s := newTestUserService(t)
+	createTestUser(t, s, "known@example.com", testPassword)
+	locked := createTestUser(t, s, "locked@example.com", testPassword)
+	if _, until, err := s.repo.RecordFailedLogin(locked.ID, 1, time.Hour, 0); err != nil || until == nil {
+		t.Fatalf("lock account: until = %v, err = %v", until, err)
+	}
+	deleted := createTestUser(t, s, "deleted@example.com", testPassword)
+	if err := s.repo.UpdateUserStatus(deleted.ID, model.UserStatusDeleted); err != nil {
+		t.Fatal(err)
+	}
+
+	attempts := map[string]model.Login{
+		"unknown email":          {Email: "nobody@example.com", Password: testPassword},
+		"wrong password":         {Email: "known@example.com", Password: "wrong password"},
+		"locked, right password": {Email: "locked@example.com", Password: testPassword},
+		"locked, wrong password": {Email: "locked@example.com", Password: "wrong password"},
+		"deleted account":        {Email: "deleted@example.com", Password: testPassword},
+	}
+	for name, login := range attempts {
+		tokens, challenge, err := s.LoginUser(login)
+		if tokens != nil || challenge != nil || err == nil || err.Error() != "wrong user password" {
+			t.Errorf("%s: got tokens=%v challenge=%v err=%v, want wrong user password", name, tokens, challenge, err)
+		}
+	}
+}
+
+// TestLoginTimingParity compares the median time of a failed login for an
+// unknown address with the other ways a login fails before the password is
+// verified. bcrypt dominates, so the medians should be close; the bound is
+// loose enough not to flake on a busy machine.
+func TestLoginTimingParity(t *testing.T) {
+	if testing.Short() {
+		t.Skip("timing test")
+	}
+	s := newTestUserService(t)
+	createTestUser(t, s, "known@example.com", testPassword)
+	locked := createTestUser(t, s, "locked@example.com", testPassword)
+	if _, _, err := s.repo.RecordFailedLogin(locked.ID, 1, time.Hour, 0); err != nil {
+		t.Fatal(err)
+	}
+	// Keep the known account below the lock threshold for the whole run.
+	s.config.MaxFailedLoginAttempts = 0
+
+	median := func(login model.Login) time.Duration {
+		const runs = 15
+		durations := make([]time.Duration, 0, runs)
+		for i := 0; i < runs; i++ {
+			start := time.Now()
+			s.LoginUser(login)
+			durations = append(durations, time.Since(start))
+		}
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		return durations[runs/2]
+	}
+
+	unknown := median(model.Login{Email: "nobody@example.com", Password: testPassword})
+	for name, login := range map[string]model.Login{
+		"wrong password": {Email: "known@example.com", Password: "wrong password"},
+		"locked account": {Email: "locked@example.com", Password: testPassword},
+	} {
+		got := median(login)
+		if diff := got - unknown; diff > unknown/4 || -diff > unknown/4 {
+			t.Errorf("%s: median %v, unknown email: median %v", name, got, unknown)
+		}
+	}
+}
+
+func TestLoginFailuresAreCounted(t *testing.T) {
+	s := newTestUserService(t)
+	user := createTestUser(t, s, "known@example.com", testPassword)
+
+	for i := 0; i < s.config.MaxFailedLoginAttempts; i++ {
+		s.LoginUser(model.Login{Email: user.Email, Password: "wrong password"})
+	}
+
+	// The failures are recorded in the background.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		current, err := s.repo.GetUserByID(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if current.Status == model.UserStatusLocked {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("account not locked after %d failures: status %s, %d attempts",
+				s.config.MaxFailedLoginAttempts, current.Status, current.FailedLoginAttempts)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	_, _, err := s.LoginUser(model.Login{Email: user.Email, Password: testPassword})
+	if err == nil || err.Error() != "wrong user password" {
+		t.Errorf("locked account with the right password: err = %v, want wrong user password", err)
+	}
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/finance-app/finance-app/auth-service/internal/mailer"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"time"
+)
+
+// RequestMagicLink emails a single-use sign-in link and returns the nonce the
+// caller must keep in a cookie on the requesting browser. A nonce is returned
+// for unknown addresses too, so the answer doesn't reveal who has an account.
+func (s *UserService) RequestMagicLink(email string) (string, error) {
+	nonce := GenerateRefreshToken()
+	user, err := s.repo.GetUserByEmail(email)
+	if err != nil {
+		return "", errors.New("database error")
+	}
+	if user == nil || user.Status == model.UserStatusDeleted || user.Status == model.UserStatusDisabled {
+		s.logs.Info.Printf("Magic link requested for unknown or inactive account")
+		return nonce, nil
+	}
+
+	if err := s.tokenRepo.InvalidateTokens(user.ID, model.TokenPurposeMagicLink); err != nil {
+		return "", errors.New("database error")
+	}
+	token := GenerateRefreshToken()
+	expiresAt := time.Now().Add(s.config.MagicLinkTTL)
+	if err := s.tokenRepo.InsertTokenWithPayload(user.ID, model.TokenPurposeMagicLink, HashToken(token), HashToken(nonce), expiresAt); err != nil {
+		return "", errors.New("database error")
+	}
+
+	err = s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your sign-in link",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen the link below in the same browser you asked for it from to sign in:\n\n%s/magic-link?token=%s\n\nThe link works once and expires at %s. If you didn't ask for this, you can ignore this email.",
+			user.Name, s.config.AppBaseURL, token, expiresAt.Format(time.RFC1123)),
+	})
+	if err != nil {
+		s.logs.Error.Printf("Failed to send magic link to user ID=%d: %v", user.ID, err)
+		return "", errors.New("failed to send email")
+	}
+	return nonce, nil
+}
+
+// ConsumeMagicLink signs in with a link from RequestMagicLink. The link is used
+// up even when it is opened in another browser, so a forwarded link is of no
+// use to anyone. Opening the link proves control of the address, so it also
+// verifies it. A second factor is still asked for when enabled.
+func (s *UserService) ConsumeMagicLink(request model.MagicLinkLogin) (*model.Tokens, *model.MFAChallenge, error) {
+	if request.Token == "" || request.Nonce == "" {
+		return nil, nil, errors.New("invalid magic link")
+	}
+	userID, nonceHash, err := s.tokenRepo.ConsumeTokenWithPayload(model.TokenPurposeMagicLink, HashToken(request.Token))
+	if err != nil {
+		return nil, nil, errors.New("database error")
+	}
+	if userID == 0 {
+		return nil, nil, errors.New("invalid magic link")
+	}
+	if subtle.ConstantTimeCompare([]byte(nonceHash), []byte(HashToken(request.Nonce))) != 1 {
+		s.logs.Info.Printf("Magic link of user ID=%d opened in another browser", userID)
+		s.recordLoginEvent(userID, request.Client, false, "magic link nonce mismatch")
+		return nil, nil, errors.New("invalid magic link")
+	}
+
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, nil, errors.New("database error")
+	}
+	if user == nil || user.Status == model.UserStatusDeleted {
+		return nil, nil, errors.New("user not found")
+	}
+	if user.EmailVerifiedAt == nil {
+		if err := s.repo.MarkEmailVerified(user.ID); err != nil {
+			return nil, nil, errors.New("database error")
+		}
+		if user, err = s.repo.GetUserByID(userID); err != nil || user == nil {
+			return nil, nil, errors.New("database error")
+		}
+	}
+
+	if err := s.checkLock(user); err != nil {
+		s.recordLoginEvent(user.ID, request.Client, false, err.Error())
+		return nil, nil, err
+	}
+	if err := s.checkLoginStatus(user); err != nil {
+		s.recordLoginEvent(user.ID, request.Client, false, err.Error())
+		return nil, nil, err
+	}
+
+	methods, err := s.mfaMethods(user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(methods) > 0 {
+		challenge, err := s.mfaChallenge(user, methods, model.AMREmail)
+		if err != nil {
+			return nil, nil, err
+		}
+		s.logs.Info.Printf("Second factor required for user ID=%d after magic link sign-in", user.ID)
+		return nil, challenge, nil
+	}
+
+	tokens, err := s.completeLogin(user, request.Client, []string{model.AMREmail})
+	if err != nil {
+		return nil, nil, err
+	}
+	return tokens, nil, nil
+}
@@ -0,0 +1,369 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/finance-app/finance-app/auth-service/internal/notifier"
+	"github.com/finance-app/finance-app/auth-service/internal/totp"
+	"github.com/skip2/go-qrcode"
+	"strings"
+	"time"
+)
+
+const recoveryCodeCount = 10
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func (s *UserService) GetMFAStatus(userID int) (*model.MFAStatus, error) {
+	methods, err := s.mfaMethods(userID)
+	if err != nil {
+		return nil, err
+	}
+	remaining, err := s.mfaRepo.CountRecoveryCodes(userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	return &model.MFAStatus{Enabled: len(methods) > 0, Methods: methods, RecoveryCodesRemaining: remaining}, nil
+}
+
+// HasSecondFactor reports whether the user has a confirmed authenticator app
+// or a passkey.
+func (s *UserService) HasSecondFactor(userID int) (bool, error) {
+	methods, err := s.mfaMethods(userID)
+	if err != nil {
+		return false, err
+	}
+	return len(methods) > 0, nil
+}
+
+// EnrollTOTP creates a new secret. It only becomes active once ConfirmTOTP
+// has seen a valid code, so an abandoned enrollment never locks anybody out.
+func (s *UserService) EnrollTOTP(userID int) (*model.TOTPEnrollment, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, errors.New("failed to generate secret")
+	}
+	sealed, err := s.secrets.Seal(secret)
+	if err != nil {
+		return nil, errors.New("failed to generate secret")
+	}
+	if err := s.mfaRepo.SaveTOTPSecret(userID, sealed); err != nil {
+		if err.Error() == "mfa already enabled" {
+			return nil, err
+		}
+		return nil, errors.New("database error")
+	}
+
+	uri := totp.ProvisioningURI(s.config.TOTPIssuer, user.Email, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return nil, errors.New("failed to generate qr code")
+	}
+	s.logs.Info.Printf("TOTP enrollment started for user ID=%d", userID)
+	return &model.TOTPEnrollment{
+		Secret:          secret,
+		ProvisioningURI: uri,
+		QRCode:          "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	}, nil
+}
+
+func (s *UserService) ConfirmTOTP(userID int, code string) (*model.RecoveryCodes, error) {
+	credential, err := s.mfaRepo.GetTOTPCredential(userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if credential == nil {
+		return nil, errors.New("mfa not enrolled")
+	}
+	if credential.ConfirmedAt != nil {
+		return nil, errors.New("mfa already enabled")
+	}
+
+	secret, err := s.secrets.Open(credential.Secret)
+	if err != nil {
+		s.logs.Error.Printf("Failed to open TOTP secret for user ID=%d: %v", userID, err)
+		return nil, errors.New("database error")
+	}
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return nil, errors.New("invalid mfa code")
+	}
+
+	codes, hashes, err := s.generateRecoveryCodes()
+	if err != nil {
+		return nil, errors.New("failed to generate recovery codes")
+	}
+	if err := s.mfaRepo.ConfirmTOTP(userID, step, hashes); err != nil {
+		if err.Error() == "mfa already enabled" {
+			return nil, err
+		}
+		return nil, errors.New("database error")
+	}
+
+	s.notifyMFAChange(userID, "Two-factor authentication was enabled",
+		"Two-factor authentication is now required to sign in to your account.")
+	s.logs.Info.Printf("TOTP enabled for user ID=%d", userID)
+	return &model.RecoveryCodes{Codes: codes}, nil
+}
+
+// DisableMFA turns off the authenticator app. It asks for the password and a
+// second factor, so a stolen access token is not enough. Wrong guesses count
+// towards the login lock, and a wrong password gets the same answer as a
+// wrong code so that the endpoint can't be used to test passwords. Passkeys
+// are removed one by one with DeletePasskey.
+func (s *UserService) DisableMFA(userID int, request model.DisableMFA) error {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return errors.New("database error")
+	}
+	if user == nil {
+		return errors.New("user not found")
+	}
+	if err := s.checkLock(user); err != nil {
+		return err
+	}
+	if !CheckPasswordHash(request.Password, user.Password) {
+		s.recordFailedLogin(user, request.Client)
+		s.recordLoginEvent(user.ID, request.Client, false, "wrong user password")
+		return errors.New("wrong credentials")
+	}
+	if err := s.verifyMFAChange(user, request.Code, request.RecoveryCode, request.Client); err != nil {
+		if err.Error() == "invalid mfa code" {
+			return errors.New("wrong credentials")
+		}
+		return err
+	}
+
+	if err := s.mfaRepo.DeleteTOTP(userID); err != nil {
+		return errors.New("database error")
+	}
+	if err := s.dropUnusedRecoveryCodes(userID); err != nil {
+		return err
+	}
+	s.notifyMFAChange(userID, "Two-factor authentication was disabled",
+		"Codes from your authenticator app are no longer accepted when signing in to your account.")
+	s.logs.Info.Printf("TOTP disabled for user ID=%d", userID)
+	return nil
+}
+
+// RegenerateRecoveryCodes invalidates all previous codes. Wrong codes count
+// towards the login lock.
+func (s *UserService) RegenerateRecoveryCodes(userID int, request model.MFACode) (*model.RecoveryCodes, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+	if err := s.checkLock(user); err != nil {
+		return nil, err
+	}
+	if err := s.verifyMFAChange(user, request.Code, request.RecoveryCode, request.Client); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := s.generateRecoveryCodes()
+	if err != nil {
+		return nil, errors.New("failed to generate recovery codes")
+	}
+	if err := s.mfaRepo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, errors.New("database error")
+	}
+	s.notifyMFAChange(userID, "New recovery codes were generated",
+		"New two-factor recovery codes were generated for your account. The previous codes no longer work.")
+	s.logs.Info.Printf("Recovery codes regenerated for user ID=%d", userID)
+	return &model.RecoveryCodes{Codes: codes}, nil
+}
+
+// CompleteMFALogin finishes a login that LoginUser answered with a challenge.
+// Wrong codes count as failed logins, so guessing runs into the same lockout
+// as guessing passwords.
+func (s *UserService) CompleteMFALogin(request model.MFALogin) (*model.Tokens, error) {
+	userID, version, amr, err := s.jwtService.ValidateMFAToken(request.MFAToken)
+	if err != nil {
+		return nil, errors.New("invalid mfa token")
+	}
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if user == nil || user.TokenVersion != version {
+		return nil, errors.New("invalid mfa token")
+	}
+
+	if err := s.checkLock(user); err != nil {
+		s.recordLoginEvent(user.ID, request.Client, false, err.Error())
+		return nil, err
+	}
+	if err := s.checkLoginStatus(user); err != nil {
+		s.recordLoginEvent(user.ID, request.Client, false, err.Error())
+		return nil, err
+	}
+
+	if len(request.Credential) > 0 {
+		err = s.verifyPasskeyAssertion(user, request.CeremonyID, request.Credential)
+		amr = append(amr, model.AMRWebAuthn)
+	} else {
+		err = s.verifySecondFactor(user.ID, request.Code, request.RecoveryCode)
+		amr = append(amr, model.AMROTP)
+	}
+	if err != nil {
+		if err.Error() == "invalid mfa code" {
+			s.recordFailedLogin(user, request.Client)
+			s.recordLoginEvent(user.ID, request.Client, false, err.Error())
+		}
+		return nil, err
+	}
+
+	if user.FailedLoginAttempts > 0 {
+		if err := s.repo.ResetFailedLogins(user.ID); err != nil {
+			s.logs.Error.Printf("Failed to reset login attempts for user ID=%d: %v", user.ID, err)
+		}
+	}
+	return s.completeLogin(user, request.Client, append(amr, model.AMRMFA))
+}
+
+// mfaChallenge hands out the MFA token; firstFactor is the amr of the step the
+// user already passed.
+func (s *UserService) mfaChallenge(user *model.User, methods []string, firstFactor string) (*model.MFAChallenge, error) {
+	token, err := s.jwtService.GenerateMFAToken(user.ID, user.TokenVersion, []string{firstFactor}, s.config.MFAChallengeTTL)
+	if err != nil {
+		return nil, errors.New("failed to generate mfa token")
+	}
+	return &model.MFAChallenge{
+		MFARequired: true,
+		MFAToken:    token,
+		Methods:     methods,
+		ExpiresIn:   int(s.config.MFAChallengeTTL.Seconds()),
+	}, nil
+}
+
+// mfaMethods lists the confirmed second factors of the user. An empty list
+// means the password alone is enough.
+func (s *UserService) mfaMethods(userID int) ([]string, error) {
+	methods := []string{}
+	credential, err := s.mfaRepo.GetTOTPCredential(userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if credential != nil && credential.ConfirmedAt != nil {
+		methods = append(methods, model.MFAMethodTOTP)
+	}
+	passkeys, err := s.passkeyRepo.CountPasskeys(userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if passkeys > 0 {
+		methods = append(methods, model.MFAMethodWebAuthn)
+	}
+	return methods, nil
+}
+
+// verifyMFAChange checks the second factor that guards changes to it. Wrong
+// codes are failed logins, so a stolen access token doesn't allow guessing
+// them; a right one clears earlier failures.
+func (s *UserService) verifyMFAChange(user *model.User, code string, recoveryCode string, client model.ClientInfo) error {
+	if err := s.verifySecondFactor(user.ID, code, recoveryCode); err != nil {
+		if err.Error() == "invalid mfa code" {
+			s.recordFailedLogin(user, client)
+			s.recordLoginEvent(user.ID, client, false, err.Error())
+		}
+		return err
+	}
+	if user.FailedLoginAttempts > 0 {
+		if err := s.repo.ResetFailedLogins(user.ID); err != nil {
+			s.logs.Error.Printf("Failed to reset login attempts for user ID=%d: %v", user.ID, err)
+		}
+	}
+	return nil
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused recovery
+// code. A TOTP code is only accepted once.
+func (s *UserService) verifySecondFactor(userID int, code string, recoveryCode string) error {
+	if recoveryCode != "" {
+		ok, err := s.mfaRepo.ConsumeRecoveryCode(userID, s.secrets.Hash(normalizeRecoveryCode(recoveryCode)))
+		if err != nil {
+			return errors.New("database error")
+		}
+		if !ok {
+			return errors.New("invalid mfa code")
+		}
+		s.logs.Info.Printf("Recovery code used by user ID=%d", userID)
+		return nil
+	}
+
+	credential, err := s.mfaRepo.GetTOTPCredential(userID)
+	if err != nil {
+		return errors.New("database error")
+	}
+	if credential == nil || credential.ConfirmedAt == nil {
+		return errors.New("mfa not enabled")
+	}
+	secret, err := s.secrets.Open(credential.Secret)
+	if err != nil {
+		s.logs.Error.Printf("Failed to open TOTP secret for user ID=%d: %v", userID, err)
+		return errors.New("database error")
+	}
+	step, ok := totp.Validate(secret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return errors.New("invalid mfa code")
+	}
+	fresh, err := s.mfaRepo.UseTOTPStep(userID, step)
+	if err != nil {
+		return errors.New("database error")
+	}
+	if !fresh {
+		return errors.New("invalid mfa code")
+	}
+	return nil
+}
+
+func (s *UserService) notifyMFAChange(userID int, subject string, text string) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil || user == nil {
+		return
+	}
+	s.notify(user, notifier.Event{
+		Type:       notifier.EventMFAChanged,
+		Subject:    subject,
+		Text:       fmt.Sprintf("%s This happened at %s.", text, time.Now().Format(time.RFC1123)),
+		OccurredAt: time.Now(),
+	})
+}
+
+// generateRecoveryCodes returns the codes to show to the user once and the
+// hashes to store. Each code carries 50 random bits, few enough to try them
+// all against a plain digest, hence the keyed hash.
+func (s *UserService) generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(raw))[:10]
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, s.secrets.Hash(code))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"time"
+)
+
+// GenerateMFAToken signs the challenge handed out between the first and the
+// second factor. It carries no user_id claim, so it can never pass as an
+// access token. amr records how the first factor was passed.
+func (s *JWTService) GenerateMFAToken(userID int, tokenVersion int, amr []string, ttl time.Duration) (string, error) {
+	claims := jwt.MapClaims{
+		"mfa_user_id": userID,
+		"ver":         tokenVersion,
+		"amr":         amr,
+		"purpose":     "mfa",
+		"exp":         time.Now().Add(ttl).Unix(),
+		"issuer":      "auth-service",
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
+
+	return token.SignedString([]byte(s.JWTSecret))
+}
+
+func (s *JWTService) ValidateMFAToken(tokenString string) (int, int, []string, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("invalid token signing method")
+		}
+		return []byte(s.JWTSecret), nil
+	})
+	if err != nil || !token.Valid {
+		return 0, 0, nil, errors.New("invalid token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != "mfa" {
+		return 0, 0, nil, errors.New("invalid claims")
+	}
+	userID, ok := claims["mfa_user_id"].(float64)
+	if !ok {
+		return 0, 0, nil, errors.New("invalid claims")
+	}
+	version, _ := claims["ver"].(float64)
+	amr := []string{}
+	if methods, ok := claims["amr"].([]interface{}); ok {
+		for _, method := range methods {
+			if name, ok := method.(string); ok {
+				amr = append(amr, name)
+			}
+		}
+	}
+	return int(userID), int(version), amr, nil
+}
@@ -1,8 +1,9 @@
 package mock
 
 import (
-	"auth-service/internal/model"
 	"errors"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"strings"
 )
 
 type MockUserService struct {
@@ -13,25 +14,25 @@ func NewMockUserService() *MockUserService {
 	return &MockUserService{users: make(map[string]model.User)}
 }
 
-func (m *MockUserService) RegisterUser(user model.User) (*model.User, error) {
-	if _, exists := m.users[user.Email]; exists {
+func (m *MockUserService) RegisterUser(user model.User, _ model.ClientInfo) (*model.User, error) {
+	key := strings.ToLower(user.Email)
+	if _, exists := m.users[key]; exists {
 		return nil, errors.New("user already exists")
 	}
 	user.ID = len(m.users) + 1
-	m.users[user.Email] = user
+	m.users[key] = user
 	return &user, nil
 }
 
-func (m *MockUserService) LoginUser(loginInfo model.Login) (*model.Tokens, error) {
-	user, exists := m.users[loginInfo.Email]
-	if !exists {
-		return nil, errors.New("user not found")
-	}
-	if user.Password != loginInfo.Password {
-		return nil, errors.New("wrong user password")
+// LoginUser fails the same way for unknown emails and wrong passwords, like
+// the real service.
+func (m *MockUserService) LoginUser(loginInfo model.Login) (*model.Tokens, *model.MFAChallenge, error) {
+	user, exists := m.users[strings.ToLower(loginInfo.Email)]
+	if !exists || user.Password != loginInfo.Password {
+		return nil, nil, errors.New("wrong user password")
 	}
 	return &model.Tokens{
 		AccessToken:  "mock_access_token",
 		RefreshToken: "mock_refresh_token",
-	}, nil
+	}, nil, nil
 }
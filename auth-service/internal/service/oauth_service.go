@@ -0,0 +1,647 @@
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/finance-app/finance-app/auth-service/internal/repository"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors returned to OAuth clients carry the RFC 6749 error code as their
+// message. "invalid client" and "invalid redirect uri" are the exception:
+// they must not be sent to the redirect URI and are shown to the user instead.
+
+const maxOAuthClientNameLength = 255
+
+var serviceNamePattern = regexp.MustCompile(`^[a-z][a-z0-9-]{1,62}$`)
+
+type OAuthServiceConfig struct {
+	ConsentURL      string
+	CodeTTL         time.Duration
+	RefreshTokenTTL time.Duration
+	// IntrospectionCacheTTL bounds how long introspection answers are reused.
+	IntrospectionCacheTTL time.Duration
+	// ServiceTokenTTL is the lifetime of service account tokens. They can't
+	// be revoked, so it is kept short.
+	ServiceTokenTTL time.Duration
+}
+
+type OAuthService struct {
+	repo           *repository.OAuthRepository
+	userRepo       *repository.UserRepository
+	roleRepo       *repository.RoleRepository
+	sessionRepo    *repository.SessionRepository
+	jwtService     *JWTService
+	idTokens       *IDTokenSigner
+	tokenState     *TokenStateCache
+	apiKeys        *APIKeyService
+	introspections *introspectionCache
+	logs           *logger.Logger
+	config         OAuthServiceConfig
+}
+
+func NewOAuthService(repo *repository.OAuthRepository, userRepo *repository.UserRepository, roleRepo *repository.RoleRepository,
+	sessionRepo *repository.SessionRepository, jwtService *JWTService, idTokens *IDTokenSigner, tokenState *TokenStateCache,
+	apiKeys *APIKeyService, logs *logger.Logger, config OAuthServiceConfig) *OAuthService {
+	return &OAuthService{
+		repo:           repo,
+		userRepo:       userRepo,
+		roleRepo:       roleRepo,
+		sessionRepo:    sessionRepo,
+		jwtService:     jwtService,
+		idTokens:       idTokens,
+		tokenState:     tokenState,
+		apiKeys:        apiKeys,
+		introspections: newIntrospectionCache(config.IntrospectionCacheTTL),
+		logs:           logs,
+		config:         config,
+	}
+}
+
+func (s *OAuthService) RegisterClient(adminID int, request model.RegisterOAuthClient) (*model.RegisteredOAuthClient, error) {
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" || len(request.Name) > maxOAuthClientNameLength {
+		return nil, errors.New("invalid client metadata: name is required")
+	}
+	if request.Type == model.OAuthClientService {
+		return s.registerServiceAccount(adminID, request)
+	}
+	if request.Type != model.OAuthClientConfidential && request.Type != model.OAuthClientPublic {
+		return nil, errors.New("invalid client metadata: type must be confidential, public or service")
+	}
+	if len(request.GrantTypes) == 0 {
+		request.GrantTypes = []string{model.GrantAuthorizationCode, model.GrantRefreshToken}
+	}
+	for _, grantType := range request.GrantTypes {
+		switch grantType {
+		case model.GrantAuthorizationCode, model.GrantRefreshToken:
+		case model.GrantClientCredentials:
+			if request.Type == model.OAuthClientPublic {
+				return nil, errors.New("invalid client metadata: public clients can't use client_credentials")
+			}
+		default:
+			return nil, errors.New("invalid client metadata: unsupported grant type " + grantType)
+		}
+	}
+	if slices.Contains(request.GrantTypes, model.GrantAuthorizationCode) && len(request.RedirectURIs) == 0 {
+		return nil, errors.New("invalid client metadata: redirect_uris are required")
+	}
+	for _, redirectURI := range request.RedirectURIs {
+		if !validRedirectURI(redirectURI) {
+			return nil, errors.New("invalid client metadata: invalid redirect uri " + redirectURI)
+		}
+	}
+	if len(request.Scopes) == 0 {
+		return nil, errors.New("invalid client metadata: scopes are required")
+	}
+	for _, scope := range request.Scopes {
+		if _, ok := model.OAuthScopes[scope]; !ok {
+			return nil, errors.New("invalid client metadata: unknown scope " + scope)
+		}
+	}
+
+	return s.insertClient(adminID, model.OAuthClient{
+		Name:         request.Name,
+		Type:         request.Type,
+		RedirectURIs: request.RedirectURIs,
+		GrantTypes:   request.GrantTypes,
+		Scopes:       request.Scopes,
+	})
+}
+
+// registerServiceAccount creates a client for another finance service. Its
+// name ends up in every token as the service claim, so it must be a simple
+// identifier and unique among active service accounts.
+func (s *OAuthService) registerServiceAccount(adminID int, request model.RegisterOAuthClient) (*model.RegisteredOAuthClient, error) {
+	if !serviceNamePattern.MatchString(request.Name) {
+		return nil, errors.New("invalid client metadata: service name must be lowercase letters, digits and dashes")
+	}
+	if len(request.RedirectURIs) > 0 {
+		return nil, errors.New("invalid client metadata: service accounts have no redirect_uris")
+	}
+	for _, grantType := range request.GrantTypes {
+		if grantType != model.GrantClientCredentials {
+			return nil, errors.New("invalid client metadata: service accounts only use client_credentials")
+		}
+	}
+	if len(request.Scopes) == 0 {
+		return nil, errors.New("invalid client metadata: scopes are required")
+	}
+	for _, scope := range request.Scopes {
+		if _, ok := model.ServiceScopes[scope]; !ok {
+			return nil, errors.New("invalid client metadata: unknown scope " + scope)
+		}
+	}
+	existing, err := s.repo.GetServiceAccount(request.Name)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if existing != nil {
+		return nil, errors.New("invalid client metadata: service name is already in use")
+	}
+
+	return s.insertClient(adminID, model.OAuthClient{
+		Name:         request.Name,
+		Type:         model.OAuthClientService,
+		RedirectURIs: []string{},
+		GrantTypes:   []string{model.GrantClientCredentials},
+		Scopes:       request.Scopes,
+	})
+}
+
+func (s *OAuthService) insertClient(adminID int, client model.OAuthClient) (*model.RegisteredOAuthClient, error) {
+	client.ClientID = GenerateRefreshToken()[:32]
+	client.CreatedBy = &adminID
+	var secret string
+	if client.Type != model.OAuthClientPublic {
+		secret = GenerateRefreshToken()
+		hash, err := HashPassword(secret)
+		if err != nil {
+			return nil, errors.New("failed to hash client secret")
+		}
+		client.ClientSecretHash = hash
+	}
+	if err := s.repo.InsertClient(&client); err != nil {
+		return nil, errors.New("database error")
+	}
+
+	s.logs.Info.Printf("OAuth client %s (%s) registered by admin ID=%d", client.ClientID, client.Name, adminID)
+	return &model.RegisteredOAuthClient{OAuthClient: client, ClientSecret: secret}, nil
+}
+
+func (s *OAuthService) ListClients() ([]model.OAuthClient, error) {
+	clients, err := s.repo.ListClients()
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	return clients, nil
+}
+
+func (s *OAuthService) RevokeClient(adminID int, clientID string) error {
+	if err := s.repo.RevokeClient(clientID); err != nil {
+		if err.Error() == "client not found" {
+			return err
+		}
+		return errors.New("database error")
+	}
+	s.logs.Info.Printf("OAuth client %s revoked by admin ID=%d", clientID, adminID)
+	return nil
+}
+
+// ValidateAuthorizationRequest checks the parameters of /oauth/authorize.
+// PKCE with S256 is mandatory for every client, as OAuth 2.1 requires. When
+// the client has a single redirect URI it may be omitted from the request.
+func (s *OAuthService) ValidateAuthorizationRequest(request *model.AuthorizationRequest) (*model.OAuthClient, []string, error) {
+	client, err := s.repo.GetClient(request.ClientID)
+	if err != nil {
+		return nil, nil, errors.New("database error")
+	}
+	if client == nil {
+		return nil, nil, errors.New("invalid client")
+	}
+	if request.RedirectURI == "" && len(client.RedirectURIs) == 1 {
+		request.RedirectURI = client.RedirectURIs[0]
+	}
+	if !slices.Contains(client.RedirectURIs, request.RedirectURI) {
+		return nil, nil, errors.New("invalid redirect uri")
+	}
+
+	if request.ResponseType != "code" {
+		return nil, nil, errors.New("unsupported_response_type")
+	}
+	if !slices.Contains(client.GrantTypes, model.GrantAuthorizationCode) {
+		return nil, nil, errors.New("unauthorized_client")
+	}
+	if request.CodeChallenge == "" || request.CodeChallengeMethod != "S256" {
+		return nil, nil, errors.New("invalid_request")
+	}
+	scopes, err := parseScopes(request.Scope, client.Scopes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, scopes, nil
+}
+
+func (s *OAuthService) GetConsentPrompt(userID int, request model.AuthorizationRequest) (*model.ConsentPrompt, error) {
+	client, scopes, err := s.ValidateAuthorizationRequest(&request)
+	if err != nil {
+		return nil, err
+	}
+	granted, err := s.repo.GetConsent(userID, client.ID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+
+	prompt := &model.ConsentPrompt{ClientID: client.ClientID, ClientName: client.Name, AlreadyGranted: true}
+	for _, scope := range scopes {
+		prompt.Scopes = append(prompt.Scopes, model.ScopeInfo{Name: scope, Description: model.OAuthScopes[scope]})
+		if !slices.Contains(granted, scope) {
+			prompt.AlreadyGranted = false
+		}
+	}
+	return prompt, nil
+}
+
+// DecideConsent records the user's answer and returns where to send the
+// browser: back to the client with either a code or access_denied. authTime
+// comes from the user's access token and becomes the ID token's auth_time.
+func (s *OAuthService) DecideConsent(userID int, authTime time.Time, decision model.ConsentDecision) (*model.ConsentResult, error) {
+	request := decision.AuthorizationRequest
+	client, scopes, err := s.ValidateAuthorizationRequest(&request)
+	if err != nil {
+		if err.Error() == "invalid client" || err.Error() == "invalid redirect uri" || err.Error() == "database error" {
+			return nil, err
+		}
+		return &model.ConsentResult{RedirectTo: AuthorizationErrorRedirect(request, err.Error())}, nil
+	}
+	if !decision.Approved {
+		s.logs.Info.Printf("User ID=%d denied consent to OAuth client %s", userID, client.ClientID)
+		return &model.ConsentResult{RedirectTo: AuthorizationErrorRedirect(request, "access_denied")}, nil
+	}
+
+	granted, err := s.repo.GetConsent(userID, client.ID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+	if err := s.repo.SaveConsent(userID, client.ID, granted); err != nil {
+		return nil, errors.New("database error")
+	}
+
+	// Sessions signed in before auth_time was recorded fall back to the
+	// last successful login.
+	var codeAuthTime *time.Time
+	if !authTime.IsZero() {
+		codeAuthTime = &authTime
+	} else if slices.Contains(scopes, model.ScopeOpenID) {
+		codeAuthTime, err = s.sessionRepo.GetLastLoginAt(userID)
+		if err != nil {
+			return nil, errors.New("database error")
+		}
+	}
+
+	code := GenerateRefreshToken()
+	err = s.repo.InsertAuthorizationCode(HashToken(code), model.AuthorizationCode{
+		ClientID:      client.ID,
+		UserID:        userID,
+		RedirectURI:   request.RedirectURI,
+		Scope:         strings.Join(scopes, " "),
+		CodeChallenge: request.CodeChallenge,
+		Nonce:         request.Nonce,
+		AuthTime:      codeAuthTime,
+		ExpiresAt:     time.Now().Add(s.config.CodeTTL),
+	})
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+
+	s.logs.Info.Printf("User ID=%d authorized OAuth client %s for scope %q", userID, client.ClientID, strings.Join(scopes, " "))
+	return &model.ConsentResult{RedirectTo: redirectWithParams(request.RedirectURI, url.Values{"code": {code}, "state": {request.State}})}, nil
+}
+
+// ConsentRedirect sends the browser from /oauth/authorize to the consent
+// screen, where the user signs in and decides.
+func (s *OAuthService) ConsentRedirect(rawQuery string) string {
+	return s.config.ConsentURL + "?" + rawQuery
+}
+
+func (s *OAuthService) Token(request model.TokenRequest) (*model.OAuthTokens, error) {
+	client, err := s.authenticateClient(request.ClientID, request.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	switch request.GrantType {
+	case model.GrantAuthorizationCode, model.GrantRefreshToken, model.GrantClientCredentials:
+	default:
+		return nil, errors.New("unsupported_grant_type")
+	}
+	if !slices.Contains(client.GrantTypes, request.GrantType) {
+		return nil, errors.New("unauthorized_client")
+	}
+
+	switch request.GrantType {
+	case model.GrantAuthorizationCode:
+		return s.exchangeAuthorizationCode(client, request)
+	case model.GrantRefreshToken:
+		return s.refresh(client, request)
+	default:
+		return s.clientCredentials(client, request)
+	}
+}
+
+// Revoke implements RFC 7009 for refresh tokens. Unknown tokens are not an
+// error. Access tokens are self-contained and simply run out.
+func (s *OAuthService) Revoke(clientID string, clientSecret string, token string) error {
+	client, err := s.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		return errors.New("invalid_request")
+	}
+	if err := s.repo.DeleteRefreshToken(token, client.ID); err != nil {
+		return errors.New("database error")
+	}
+	return nil
+}
+
+func (s *OAuthService) exchangeAuthorizationCode(client *model.OAuthClient, request model.TokenRequest) (*model.OAuthTokens, error) {
+	if request.Code == "" || request.CodeVerifier == "" {
+		return nil, errors.New("invalid_request")
+	}
+	code, err := s.repo.ConsumeAuthorizationCode(HashToken(request.Code), client.ID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if code == nil || code.RedirectURI != request.RedirectURI || !verifyCodeChallenge(request.CodeVerifier, code.CodeChallenge) {
+		return nil, errors.New("invalid_grant")
+	}
+	return s.issueUserTokens(client, code.UserID, model.OAuthGrant{Scope: code.Scope, AuthTime: code.AuthTime}, code.Nonce)
+}
+
+func (s *OAuthService) refresh(client *model.OAuthClient, request model.TokenRequest) (*model.OAuthTokens, error) {
+	if request.RefreshToken == "" {
+		return nil, errors.New("invalid_request")
+	}
+	grant, err := s.repo.ConsumeRefreshToken(request.RefreshToken, client.ID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if grant == nil {
+		return nil, errors.New("invalid_grant")
+	}
+
+	if request.Scope != "" {
+		narrowed, err := parseScopes(request.Scope, strings.Fields(grant.Scope))
+		if err != nil {
+			return nil, err
+		}
+		grant.Scope = strings.Join(narrowed, " ")
+	}
+	return s.issueUserTokens(client, grant.UserID, *grant, "")
+}
+
+func (s *OAuthService) clientCredentials(client *model.OAuthClient, request model.TokenRequest) (*model.OAuthTokens, error) {
+	scopes := client.Scopes
+	if request.Scope != "" {
+		requested, err := parseScopes(request.Scope, client.Scopes)
+		if err != nil {
+			return nil, err
+		}
+		scopes = requested
+	}
+
+	ttl := AccessTokenTTL
+	var accessToken string
+	var err error
+	if client.Type == model.OAuthClientService {
+		ttl = s.config.ServiceTokenTTL
+		accessToken, err = s.jwtService.GenerateServiceAccessToken(client.ClientID, client.Name, scopes, ttl)
+	} else {
+		accessToken, err = s.jwtService.GenerateClientAccessToken(client.ClientID, scopes)
+	}
+	if err != nil {
+		return nil, errors.New("error in access token generation")
+	}
+	return &model.OAuthTokens{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(ttl.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
+
+// issueUserTokens narrows permission scopes down to what the user holds right
+// now, so a grant never outlives a role change. An ID token is added when the
+// grant includes openid; the nonce is only known on the code exchange.
+func (s *OAuthService) issueUserTokens(client *model.OAuthClient, userID int, grant model.OAuthGrant, nonce string) (*model.OAuthTokens, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if user == nil || user.Status != model.UserStatusActive {
+		return nil, errors.New("invalid_grant")
+	}
+	permissions, err := s.roleRepo.GetUserPermissions(userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+
+	granted := []string{}
+	for _, scope := range strings.Fields(grant.Scope) {
+		switch scope {
+		case model.ScopeOpenID, model.ScopeProfile, model.ScopeEmail, model.ScopeOfflineAccess:
+			granted = append(granted, scope)
+		default:
+			if slices.Contains(permissions, scope) {
+				granted = append(granted, scope)
+			}
+		}
+	}
+
+	claims := AccessClaims{
+		UserID:        user.ID,
+		TokenVersion:  user.TokenVersion,
+		EmailVerified: user.EmailVerifiedAt != nil,
+		Permissions:   granted,
+		ClientID:      client.ClientID,
+	}
+	if grant.AuthTime != nil {
+		claims.AuthTime = *grant.AuthTime
+	}
+	accessToken, err := s.jwtService.GenerateAccessToken(claims)
+	if err != nil {
+		return nil, errors.New("error in access token generation")
+	}
+	tokens := &model.OAuthTokens{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(AccessTokenTTL.Seconds()),
+		Scope:       strings.Join(granted, " "),
+	}
+
+	if slices.Contains(granted, model.ScopeOpenID) {
+		idClaims := IDTokenClaims{UserID: user.ID, ClientID: client.ClientID, Nonce: nonce, AuthTime: grant.AuthTime}
+		userInfo := openIDClaims(user, granted)
+		idClaims.Name, idClaims.Email, idClaims.EmailVerified = userInfo.Name, userInfo.Email, userInfo.EmailVerified
+		tokens.IDToken, err = s.idTokens.Sign(idClaims)
+		if err != nil {
+			s.logs.Error.Printf("Failed to sign ID token: %v", err)
+			return nil, errors.New("error in id token generation")
+		}
+	}
+
+	if slices.Contains(client.GrantTypes, model.GrantRefreshToken) {
+		tokens.RefreshToken = GenerateRefreshToken()
+		if err := s.repo.InsertRefreshToken(user.ID, client.ID, tokens.RefreshToken, model.OAuthGrant{Scope: tokens.Scope, AuthTime: grant.AuthTime},
+			time.Now().Add(s.config.RefreshTokenTTL)); err != nil {
+			return nil, errors.New("database error")
+		}
+	}
+	return tokens, nil
+}
+
+// Discovery describes the provider for OpenID Connect client libraries.
+func (s *OAuthService) Discovery() model.OIDCConfiguration {
+	issuer := s.idTokens.Issuer()
+	scopes := make([]string, 0, len(model.OAuthScopes))
+	for scope := range model.OAuthScopes {
+		scopes = append(scopes, scope)
+	}
+	slices.Sort(scopes)
+
+	return model.OIDCConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserInfoEndpoint:                  issuer + "/userinfo",
+		RevocationEndpoint:                issuer + "/oauth/revoke",
+		IntrospectionEndpoint:             issuer + "/oauth/introspect",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		ScopesSupported:                   scopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{model.GrantAuthorizationCode, model.GrantRefreshToken, model.GrantClientCredentials},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "name", "email", "email_verified"},
+	}
+}
+
+func (s *OAuthService) JWKS() model.JSONWebKeySet {
+	return s.idTokens.JWKS()
+}
+
+// UserInfo answers /userinfo for a token issued to a client with the openid
+// scope.
+func (s *OAuthService) UserInfo(claims *AccessClaims) (*model.OIDCUserInfo, error) {
+	if !claims.HasPermission(model.ScopeOpenID) {
+		return nil, errors.New("insufficient_scope")
+	}
+	user, err := s.userRepo.GetUserByID(claims.UserID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if user == nil {
+		return nil, errors.New("invalid_token")
+	}
+	userInfo := openIDClaims(user, claims.Permissions)
+	return &userInfo, nil
+}
+
+// openIDClaims returns the standard claims the scopes allow the client to see.
+func openIDClaims(user *model.User, scopes []string) model.OIDCUserInfo {
+	userInfo := model.OIDCUserInfo{Subject: strconv.Itoa(user.ID)}
+	if slices.Contains(scopes, model.ScopeProfile) {
+		userInfo.Name = user.Name
+	}
+	if slices.Contains(scopes, model.ScopeEmail) {
+		verified := user.EmailVerifiedAt != nil
+		userInfo.Email = user.Email
+		userInfo.EmailVerified = &verified
+	}
+	return userInfo
+}
+
+// authenticateClient checks the secret of confidential clients. Public
+// clients are identified by client_id alone and rely on PKCE.
+func (s *OAuthService) authenticateClient(clientID string, clientSecret string) (*model.OAuthClient, error) {
+	if clientID == "" {
+		return nil, errors.New("invalid_client")
+	}
+	client, err := s.repo.GetClient(clientID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if client == nil {
+		SimulatePasswordCheck(clientSecret)
+		return nil, errors.New("invalid_client")
+	}
+	if client.Type != model.OAuthClientPublic && !CheckPasswordHash(clientSecret, client.ClientSecretHash) {
+		s.logs.Info.Printf("Failed authentication of OAuth client %s", clientID)
+		return nil, errors.New("invalid_client")
+	}
+	return client, nil
+}
+
+// AuthorizationErrorRedirect builds the redirect that reports an error of the
+// authorization request back to the client.
+func AuthorizationErrorRedirect(request model.AuthorizationRequest, code string) string {
+	params := url.Values{"error": {code}}
+	if request.State != "" {
+		params.Set("state", request.State)
+	}
+	return redirectWithParams(request.RedirectURI, params)
+}
+
+func redirectWithParams(redirectURI string, params url.Values) string {
+	if params.Get("state") == "" {
+		params.Del("state")
+	}
+	separator := "?"
+	if strings.Contains(redirectURI, "?") {
+		separator = "&"
+	}
+	return redirectURI + separator + params.Encode()
+}
+
+// parseScopes splits a scope parameter and rejects anything outside allowed.
+func parseScopes(scope string, allowed []string) ([]string, error) {
+	scopes := []string{}
+	for _, name := range strings.Fields(scope) {
+		if !slices.Contains(allowed, name) {
+			return nil, errors.New("invalid_scope")
+		}
+		if !slices.Contains(scopes, name) {
+			scopes = append(scopes, name)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, errors.New("invalid_scope")
+	}
+	return scopes, nil
+}
+
+func verifyCodeChallenge(verifier string, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// validRedirectURI accepts https URLs, http on loopback for native apps and
+// private-use schemes such as com.example.app:/callback. Fragments are not
+// allowed.
+func validRedirectURI(raw string) bool {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Scheme == "" || parsed.Fragment != "" {
+		return false
+	}
+	switch parsed.Scheme {
+	case "https":
+		return parsed.Host != ""
+	case "http":
+		host := parsed.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	case "javascript", "data", "file":
+		return false
+	default:
+		return strings.Contains(parsed.Scheme, ".")
+	}
+}
@@ -0,0 +1,431 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/finance-app/finance-app/auth-service/internal/mailer"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/finance-app/finance-app/auth-service/internal/notifier"
+	"github.com/finance-app/finance-app/auth-service/internal/repository"
+	"github.com/finance-app/finance-app/auth-service/internal/testdb"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRedirectURI = "https://client.example.com/callback"
+
+// oauthTestEnv is a provider with one user and one confidential client. The
+// discovery document and JWKS are served over HTTP, so relying party
+// libraries can check the tokens the way they would in production.
+type oauthTestEnv struct {
+	service *OAuthService
+	server  *httptest.Server
+	user    *model.User
+	client  *model.RegisteredOAuthClient
+}
+
+func newOAuthTestEnv(t *testing.T) *oauthTestEnv {
+	t.Helper()
+	db := testdb.Open(t)
+	logs := testdb.Logger()
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	signer, err := NewIDTokenSigner(nil, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userRepo := repository.NewUserRepository(db, logs)
+	roleRepo := repository.NewRoleRepository(db, logs)
+	apiKeys := NewAPIKeyService(repository.NewAPIKeyRepository(db, logs), userRepo, roleRepo, notifier.NewEmailNotifier(mailer.NewLogMailer(logs, "")),
+		logs, APIKeyServiceConfig{MaxKeysPerUser: 20, MaxLifetime: 24 * time.Hour})
+	s := NewOAuthService(repository.NewOAuthRepository(db, logs), userRepo, roleRepo, repository.NewSessionRepository(db, logs),
+		NewJWTService("test-jwt-secret", signer, "finance-api"), signer, NewTokenStateCache(userRepo, time.Second), apiKeys, logs, OAuthServiceConfig{
+			ConsentURL:            server.URL + "/oauth/consent",
+			CodeTTL:               time.Minute,
+			RefreshTokenTTL:       time.Hour,
+			IntrospectionCacheTTL: time.Second,
+			ServiceTokenTTL:       5 * time.Minute,
+		})
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.Discovery())
+	})
+	mux.HandleFunc("/.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.JWKS())
+	})
+
+	id, err := userRepo.InsertUser(model.User{Name: "Alice", Email: "alice@example.com", Password: "hash", Status: model.UserStatusActive, CreatedAt: time.Now()},
+		newDomainEvent(model.EventUserRegistered, 0, map[string]string{"email": "alice@example.com"}))
+	if err != nil {
+		t.Fatalf("InsertUser: %v", err)
+	}
+	if err := userRepo.MarkEmailVerified(id); err != nil {
+		t.Fatal(err)
+	}
+	user, err := userRepo.GetUserByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := s.RegisterClient(user.ID, model.RegisterOAuthClient{
+		Name:         "Budget App",
+		Type:         model.OAuthClientConfidential,
+		RedirectURIs: []string{testRedirectURI},
+		Scopes:       []string{model.ScopeOpenID, model.ScopeProfile, model.ScopeEmail, model.ScopeOfflineAccess},
+	})
+	if err != nil {
+		t.Fatalf("RegisterClient: %v", err)
+	}
+	return &oauthTestEnv{service: s, server: server, user: user, client: client}
+}
+
+func (e *oauthTestEnv) authorizationRequest(scope string, verifier string) model.AuthorizationRequest {
+	return model.AuthorizationRequest{
+		ResponseType:        "code",
+		ClientID:            e.client.ClientID,
+		RedirectURI:         testRedirectURI,
+		Scope:               scope,
+		State:               "af0ifjsldkj",
+		CodeChallenge:       oauth2.S256ChallengeFromVerifier(verifier),
+		CodeChallengeMethod: "S256",
+		Nonce:               "n-0S6_WzA2Mj",
+	}
+}
+
+// authorize approves the request on the consent screen and returns the code
+// the client receives, after checking the redirect it comes with.
+func (e *oauthTestEnv) authorize(t *testing.T, request model.AuthorizationRequest, authTime time.Time) string {
+	t.Helper()
+	result, err := e.service.DecideConsent(e.user.ID, authTime, model.ConsentDecision{AuthorizationRequest: request, Approved: true})
+	if err != nil {
+		t.Fatalf("DecideConsent: %v", err)
+	}
+	redirect, err := url.Parse(result.RedirectTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base := redirect.Scheme + "://" + redirect.Host + redirect.Path; base != testRedirectURI {
+		t.Fatalf("redirected to %s, want %s", base, testRedirectURI)
+	}
+	if state := redirect.Query().Get("state"); state != request.State {
+		t.Fatalf("state = %q, want %q", state, request.State)
+	}
+	code := redirect.Query().Get("code")
+	if code == "" {
+		t.Fatalf("no code in %s", result.RedirectTo)
+	}
+	return code
+}
+
+func (e *oauthTestEnv) exchange(code string, verifier string) (*model.OAuthTokens, error) {
+	return e.service.Token(model.TokenRequest{
+		GrantType:    model.GrantAuthorizationCode,
+		Code:         code,
+		RedirectURI:  testRedirectURI,
+		CodeVerifier: verifier,
+		ClientID:     e.client.ClientID,
+		ClientSecret: e.client.ClientSecret,
+	})
+}
+
+func assertOAuthError(t *testing.T, err error, want string) {
+	t.Helper()
+	if err == nil || err.Error() != want {
+		t.Fatalf("error = %v, want %s", err, want)
+	}
+}
+
+func TestOAuthAuthorizationRequest(t *testing.T) {
+	e := newOAuthTestEnv(t)
+	verifier := oauth2.GenerateVerifier()
+
+	tests := []struct {
+		name   string
+		change func(*model.AuthorizationRequest)
+		want   string
+	}{
+		{"unknown client", func(r *model.AuthorizationRequest) { r.ClientID = "unknown" }, "invalid client"},
+		{"unregistered redirect uri", func(r *model.AuthorizationRequest) { r.RedirectURI = "https://evil.example.com/callback" }, "invalid redirect uri"},
+		{"implicit flow", func(r *model.AuthorizationRequest) { r.ResponseType = "token" }, "unsupported_response_type"},
+		{"missing code challenge", func(r *model.AuthorizationRequest) { r.CodeChallenge = "" }, "invalid_request"},
+		{"plain code challenge", func(r *model.AuthorizationRequest) { r.CodeChallengeMethod = "plain" }, "invalid_request"},
+		{"scope the client may not use", func(r *model.AuthorizationRequest) { r.Scope = "openid " + model.PermissionAccountsRead }, "invalid_scope"},
+		{"no scope", func(r *model.AuthorizationRequest) { r.Scope = "" }, "invalid_scope"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := e.authorizationRequest("openid", verifier)
+			tt.change(&request)
+			_, _, err := e.service.ValidateAuthorizationRequest(&request)
+			assertOAuthError(t, err, tt.want)
+		})
+	}
+
+	t.Run("single redirect uri may be omitted", func(t *testing.T) {
+		request := e.authorizationRequest("openid", verifier)
+		request.RedirectURI = ""
+		if _, _, err := e.service.ValidateAuthorizationRequest(&request); err != nil {
+			t.Fatal(err)
+		}
+		if request.RedirectURI != testRedirectURI {
+			t.Fatalf("redirect uri = %q, want the registered one", request.RedirectURI)
+		}
+	})
+
+	t.Run("denied consent", func(t *testing.T) {
+		request := e.authorizationRequest("openid", verifier)
+		result, err := e.service.DecideConsent(e.user.ID, time.Now(), model.ConsentDecision{AuthorizationRequest: request})
+		if err != nil {
+			t.Fatal(err)
+		}
+		redirect, _ := url.Parse(result.RedirectTo)
+		if redirect.Query().Get("error") != "access_denied" || redirect.Query().Get("state") != request.State || redirect.Query().Has("code") {
+			t.Fatalf("denied consent redirected to %s", result.RedirectTo)
+		}
+	})
+}
+
+func TestOAuthCodeExchange(t *testing.T) {
+	e := newOAuthTestEnv(t)
+	authTime := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+	t.Run("rejected exchanges", func(t *testing.T) {
+		verifier := oauth2.GenerateVerifier()
+		tests := []struct {
+			name   string
+			change func(*model.TokenRequest)
+			want   string
+		}{
+			{"wrong code verifier", func(r *model.TokenRequest) { r.CodeVerifier = oauth2.GenerateVerifier() }, "invalid_grant"},
+			{"different redirect uri", func(r *model.TokenRequest) { r.RedirectURI = testRedirectURI + "/other" }, "invalid_grant"},
+			{"missing code verifier", func(r *model.TokenRequest) { r.CodeVerifier = "" }, "invalid_request"},
+			{"wrong client secret", func(r *model.TokenRequest) { r.ClientSecret = "wrong" }, "invalid_client"},
+			{"unsupported grant", func(r *model.TokenRequest) { r.GrantType = "password" }, "unsupported_grant_type"},
+			{"grant the client may not use", func(r *model.TokenRequest) { r.GrantType = model.GrantClientCredentials }, "unauthorized_client"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				code := e.authorize(t, e.authorizationRequest("openid", verifier), authTime)
+				request := model.TokenRequest{
+					GrantType:    model.GrantAuthorizationCode,
+					Code:         code,
+					RedirectURI:  testRedirectURI,
+					CodeVerifier: verifier,
+					ClientID:     e.client.ClientID,
+					ClientSecret: e.client.ClientSecret,
+				}
+				tt.change(&request)
+				_, err := e.service.Token(request)
+				assertOAuthError(t, err, tt.want)
+			})
+		}
+	})
+
+	t.Run("code is single use", func(t *testing.T) {
+		verifier := oauth2.GenerateVerifier()
+		code := e.authorize(t, e.authorizationRequest("openid", verifier), authTime)
+		if _, err := e.exchange(code, verifier); err != nil {
+			t.Fatal(err)
+		}
+		_, err := e.exchange(code, verifier)
+		assertOAuthError(t, err, "invalid_grant")
+	})
+
+	t.Run("tokens", func(t *testing.T) {
+		verifier := oauth2.GenerateVerifier()
+		request := e.authorizationRequest("openid profile email offline_access", verifier)
+		tokens, err := e.exchange(e.authorize(t, request, authTime), verifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tokens.TokenType != "Bearer" || tokens.ExpiresIn <= 0 || tokens.AccessToken == "" || tokens.RefreshToken == "" {
+			t.Fatalf("incomplete token response: %+v", tokens)
+		}
+		if tokens.Scope != "openid profile email offline_access" {
+			t.Fatalf("scope = %q", tokens.Scope)
+		}
+
+		idToken := verifyIDToken(t, e, tokens.IDToken)
+		if idToken.Nonce != request.Nonce {
+			t.Fatalf("nonce = %q, want %q", idToken.Nonce, request.Nonce)
+		}
+		var claims struct {
+			AuthTime      int64  `json:"auth_time"`
+			Name          string `json:"name"`
+			Email         string `json:"email"`
+			EmailVerified bool   `json:"email_verified"`
+		}
+		if err := idToken.Claims(&claims); err != nil {
+			t.Fatal(err)
+		}
+		if claims.AuthTime != authTime.Unix() || claims.Name != e.user.Name || claims.Email != e.user.Email || !claims.EmailVerified {
+			t.Fatalf("ID token claims = %+v", claims)
+		}
+
+		accessClaims, err := e.service.jwtService.ValidateAccessToken(tokens.AccessToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		userInfo, err := e.service.UserInfo(accessClaims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if userInfo.Subject != idToken.Subject || userInfo.Email != e.user.Email {
+			t.Fatalf("userinfo = %+v, want the ID token subject %s", userInfo, idToken.Subject)
+		}
+
+		introspection, err := e.service.Introspect(e.client.ClientID, e.client.ClientSecret, tokens.AccessToken, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !introspection.Active || introspection.ClientID != e.client.ClientID || introspection.Subject != idToken.Subject {
+			t.Fatalf("introspection = %+v", introspection)
+		}
+	})
+
+	t.Run("scopes without openid get no ID token", func(t *testing.T) {
+		verifier := oauth2.GenerateVerifier()
+		tokens, err := e.exchange(e.authorize(t, e.authorizationRequest("profile", verifier), authTime), verifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tokens.IDToken != "" {
+			t.Fatal("ID token issued without the openid scope")
+		}
+	})
+}
+
+func TestOAuthRefresh(t *testing.T) {
+	e := newOAuthTestEnv(t)
+	verifier := oauth2.GenerateVerifier()
+	tokens, err := e.exchange(e.authorize(t, e.authorizationRequest("openid email offline_access", verifier), time.Now()), verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refresh := func(refreshToken string, scope string) (*model.OAuthTokens, error) {
+		return e.service.Token(model.TokenRequest{
+			GrantType:    model.GrantRefreshToken,
+			RefreshToken: refreshToken,
+			Scope:        scope,
+			ClientID:     e.client.ClientID,
+			ClientSecret: e.client.ClientSecret,
+		})
+	}
+
+	narrowed, err := refresh(tokens.RefreshToken, "openid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if narrowed.Scope != "openid" || narrowed.RefreshToken == "" || narrowed.RefreshToken == tokens.RefreshToken {
+		t.Fatalf("refresh response = %+v", narrowed)
+	}
+	idToken := verifyIDToken(t, e, narrowed.IDToken)
+	if idToken.Nonce != "" {
+		t.Fatalf("refreshed ID token carries nonce %q", idToken.Nonce)
+	}
+
+	_, err = refresh(tokens.RefreshToken, "")
+	assertOAuthError(t, err, "invalid_grant")
+
+	_, err = refresh(narrowed.RefreshToken, "openid email")
+	assertOAuthError(t, err, "invalid_scope")
+}
+
+func TestOAuthDiscovery(t *testing.T) {
+	e := newOAuthTestEnv(t)
+
+	var discovery model.OIDCConfiguration
+	getJSON(t, e.server.URL+"/.well-known/openid-configuration", &discovery)
+	if discovery.Issuer != e.server.URL {
+		t.Fatalf("issuer = %q, want %q", discovery.Issuer, e.server.URL)
+	}
+	for name, endpoint := range map[string]string{
+		"authorization": discovery.AuthorizationEndpoint,
+		"token":         discovery.TokenEndpoint,
+		"userinfo":      discovery.UserInfoEndpoint,
+		"jwks":          discovery.JWKSURI,
+	} {
+		if !strings.HasPrefix(endpoint, discovery.Issuer+"/") {
+			t.Errorf("%s endpoint %q is not below the issuer", name, endpoint)
+		}
+	}
+	if strings.Join(discovery.ResponseTypesSupported, " ") != "code" || strings.Join(discovery.CodeChallengeMethodsSupported, " ") != "S256" {
+		t.Errorf("discovery advertises response types %v and PKCE methods %v", discovery.ResponseTypesSupported, discovery.CodeChallengeMethodsSupported)
+	}
+
+	var jwks model.JSONWebKeySet
+	getJSON(t, discovery.JWKSURI, &jwks)
+	if len(jwks.Keys) != 1 {
+		t.Fatalf("JWKS has %d keys, want 1", len(jwks.Keys))
+	}
+	key := jwks.Keys[0]
+	if key.KeyType != "RSA" || key.Use != "sig" || key.Algorithm != "RS256" || key.KeyID == "" {
+		t.Fatalf("JWKS key = %+v", key)
+	}
+
+	// Every ID token names the published key.
+	verifier := oauth2.GenerateVerifier()
+	tokens, err := e.exchange(e.authorize(t, e.authorizationRequest("openid", verifier), time.Now()), verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, _, err := jwt.NewParser().ParseUnverified(tokens.IDToken, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Header["kid"] != key.KeyID || header.Header["alg"] != "RS256" {
+		t.Fatalf("ID token header = %v, want kid %s", header.Header, key.KeyID)
+	}
+}
+
+// verifyIDToken checks the token like a relying party: discovery, JWKS,
+// signature, issuer, audience and expiry.
+func verifyIDToken(t *testing.T, e *oauthTestEnv, rawIDToken string) *oidc.IDToken {
+	t.Helper()
+	if rawIDToken == "" {
+		t.Fatal("no ID token")
+	}
+	ctx := context.Background()
+	provider, err := oidc.NewProvider(ctx, e.server.URL)
+	if err != nil {
+		t.Fatalf("discovery: %v", err)
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: e.client.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		t.Fatalf("ID token rejected: %v", err)
+	}
+	if idToken.Subject != strconv.Itoa(e.user.ID) {
+		t.Fatalf("sub = %q, want %d", idToken.Subject, e.user.ID)
+	}
+	if _, err := provider.Verifier(&oidc.Config{ClientID: "another-client"}).Verify(ctx, rawIDToken); err == nil {
+		t.Fatal("ID token accepted for another audience")
+	}
+	return idToken
+}
+
+func getJSON(t *testing.T, url string, v any) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
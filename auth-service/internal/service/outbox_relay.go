@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"github.com/finance-app/finance-app/auth-service/internal/events"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/repository"
+	"time"
+)
+
+type OutboxRelayConfig struct {
+	PollInterval time.Duration
+	BatchSize    int
+	// Lease is how long a claimed batch is reserved for this relay. It has to
+	// cover publishing the whole batch.
+	Lease      time.Duration
+	MaxBackoff time.Duration
+	// Retention is how long published events are kept before deletion.
+	Retention time.Duration
+}
+
+// OutboxRelay delivers the events in the outbox to the publisher. An event is
+// only marked published after Publish returned, so a crash in between leads
+// to a second delivery rather than a lost event. Events of the same user are
+// delivered in order; events of different users are not ordered.
+type OutboxRelay struct {
+	repo      *repository.OutboxRepository
+	publisher events.EventPublisher
+	logs      *logger.Logger
+	config    OutboxRelayConfig
+}
+
+func NewOutboxRelay(repo *repository.OutboxRepository, publisher events.EventPublisher, logs *logger.Logger, config OutboxRelayConfig) *OutboxRelay {
+	return &OutboxRelay{
+		repo:      repo,
+		publisher: publisher,
+		logs:      logs,
+		config:    config,
+	}
+}
+
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		r.RunOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *OutboxRelay) RunOnce(ctx context.Context) {
+	for {
+		// A batch holds at most one event per user, so a short batch doesn't
+		// mean the outbox is drained: publishing it may have released the
+		// next event of each user.
+		batch, err := r.repo.ClaimOutboxEvents(r.config.BatchSize, r.config.Lease)
+		if err != nil || len(batch) == 0 {
+			break
+		}
+		for _, event := range batch {
+			if err := r.publisher.Publish(ctx, event); err != nil {
+				retryAt := time.Now().Add(r.backoff(event.Attempts))
+				r.logs.Error.Printf("Failed to publish outbox event ID=%d (%s), attempt %d: %v", event.ID, event.Type, event.Attempts, err)
+				if err := r.repo.RetryOutboxEvent(event.ID, err.Error(), retryAt); err != nil {
+					r.logs.Error.Printf("Failed to reschedule outbox event ID=%d: %v", event.ID, err)
+				}
+				continue
+			}
+			if err := r.repo.MarkOutboxEventPublished(event.ID); err != nil {
+				r.logs.Error.Printf("Failed to mark outbox event ID=%d as published: %v", event.ID, err)
+			}
+		}
+	}
+
+	deleted, err := r.repo.DeletePublishedOutboxEvents(time.Now().Add(-r.config.Retention))
+	if err != nil {
+		r.logs.Error.Printf("Failed to clean up outbox: %v", err)
+	} else if deleted > 0 {
+		r.logs.Info.Printf("Removed %d published outbox events", deleted)
+	}
+}
+
+// backoff doubles the delay with every failed attempt, starting at a second.
+func (r *OutboxRelay) backoff(attempts int) time.Duration {
+	if attempts > 20 {
+		return r.config.MaxBackoff
+	}
+	delay := time.Second << (attempts - 1)
+	if delay > r.config.MaxBackoff {
+		return r.config.MaxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/finance-app/finance-app/auth-service/internal/events"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/finance-app/finance-app/auth-service/internal/repository"
+	"github.com/finance-app/finance-app/auth-service/internal/testdb"
+	"sync"
+	"testing"
+	"time"
+)
+
+// failingPublisher fails the first attempt of the events it is told about and
+// passes everything else on.
+type failingPublisher struct {
+	events.EventPublisher
+	mu   sync.Mutex
+	fail map[string]bool
+}
+
+func (p *failingPublisher) Publish(ctx context.Context, event model.DomainEvent) error {
+	p.mu.Lock()
+	fail := p.fail[event.IdempotencyKey]
+	delete(p.fail, event.IdempotencyKey)
+	p.mu.Unlock()
+	if fail {
+		return errors.New("broker unavailable")
+	}
+	return p.EventPublisher.Publish(ctx, event)
+}
+
+func TestOutboxRelayKeepsUserOrder(t *testing.T) {
+	db := testdb.Open(t)
+	logs := testdb.Logger()
+	users := repository.NewUserRepository(db, logs)
+	outbox := repository.NewOutboxRepository(db, logs)
+
+	insertUser := func(email string) (int, model.DomainEvent) {
+		t.Helper()
+		event := newDomainEvent(model.EventUserRegistered, 0, map[string]string{"email": email})
+		id, err := users.InsertUser(model.User{Name: "Test User", Email: email, Status: model.UserStatusActive, CreatedAt: time.Now()}, event)
+		if err != nil {
+			t.Fatalf("InsertUser: %v", err)
+		}
+		return id, event
+	}
+	changeEmail := func(userID int, email string) model.DomainEvent {
+		t.Helper()
+		event := newDomainEvent(model.EventUserEmailChanged, userID, map[string]string{"email": email})
+		if updated, err := users.UpdateEmail(userID, email, event); err != nil || !updated {
+			t.Fatalf("UpdateEmail: %v, %v", updated, err)
+		}
+		return event
+	}
+
+	alice, aliceRegistered := insertUser("alice@example.com")
+	aliceFirstChange := changeEmail(alice, "alice@example.org")
+	aliceSecondChange := changeEmail(alice, "alice@example.net")
+	_, bobRegistered := insertUser("bob@example.com")
+
+	memory := events.NewMemoryPublisher()
+	publisher := &failingPublisher{EventPublisher: memory, fail: map[string]bool{aliceRegistered.IdempotencyKey: true}}
+	relay := NewOutboxRelay(outbox, publisher, logs, OutboxRelayConfig{
+		PollInterval: time.Second,
+		BatchSize:    10,
+		Lease:        time.Minute,
+		MaxBackoff:   10 * time.Millisecond,
+		Retention:    time.Hour,
+	})
+
+	relay.RunOnce(context.Background())
+	assertPublished(t, memory, bobRegistered)
+
+	time.Sleep(20 * time.Millisecond)
+	relay.RunOnce(context.Background())
+	assertPublished(t, memory, bobRegistered, aliceRegistered, aliceFirstChange, aliceSecondChange)
+}
+
+func TestClaimOutboxEventsHoldsBackLaterEvents(t *testing.T) {
+	db := testdb.Open(t)
+	logs := testdb.Logger()
+	users := repository.NewUserRepository(db, logs)
+	outbox := repository.NewOutboxRepository(db, logs)
+
+	registered := newDomainEvent(model.EventUserRegistered, 0, map[string]string{"email": "carol@example.com"})
+	userID, err := users.InsertUser(model.User{Name: "Test User", Email: "carol@example.com", Status: model.UserStatusActive, CreatedAt: time.Now()}, registered)
+	if err != nil {
+		t.Fatalf("InsertUser: %v", err)
+	}
+	if _, err := users.UpdateEmail(userID, "carol@example.org", newDomainEvent(model.EventUserEmailChanged, userID, map[string]string{"email": "carol@example.org"})); err != nil {
+		t.Fatalf("UpdateEmail: %v", err)
+	}
+
+	// A second relay must not pick up the later event while the first one
+	// holds the earlier.
+	first, err := outbox.ClaimOutboxEvents(10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 1 || first[0].IdempotencyKey != registered.IdempotencyKey {
+		t.Fatalf("first claim = %+v, want only the registration", first)
+	}
+	second, err := outbox.ClaimOutboxEvents(10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second) != 0 {
+		t.Fatalf("second claim = %+v, want nothing while the registration is pending", second)
+	}
+
+	if err := outbox.MarkOutboxEventPublished(first[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	third, err := outbox.ClaimOutboxEvents(10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(third) != 1 || third[0].Type != model.EventUserEmailChanged {
+		t.Fatalf("claim after publishing = %+v, want the email change", third)
+	}
+}
+
+func assertPublished(t *testing.T, publisher *events.MemoryPublisher, want ...model.DomainEvent) {
+	t.Helper()
+	got := publisher.Events()
+	if len(got) != len(want) {
+		t.Fatalf("published %d events, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].IdempotencyKey != want[i].IdempotencyKey {
+			t.Fatalf("event %d is %s, want %s", i, got[i].Type, want[i].Type)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"strings"
+	"time"
+)
+
+const maxPasskeyNameLength = 64
+
+type passkeyUser struct {
+	user        *model.User
+	handle      []byte
+	credentials []webauthn.Credential
+}
+
+func (u *passkeyUser) WebAuthnID() []byte                         { return u.handle }
+func (u *passkeyUser) WebAuthnName() string                       { return u.user.Email }
+func (u *passkeyUser) WebAuthnDisplayName() string                { return u.user.Name }
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+
+type passkeyCeremonyState struct {
+	Session webauthn.SessionData `json:"session"`
+	Name    string               `json:"name,omitempty"`
+}
+
+func (s *UserService) ListPasskeys(userID int) ([]model.Passkey, error) {
+	passkeys, err := s.passkeyRepo.GetPasskeys(userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	return passkeys, nil
+}
+
+func (s *UserService) BeginPasskeyRegistration(userID int, name string) (*model.PasskeyCeremony, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Passkey"
+	}
+	if len(name) > maxPasskeyNameLength {
+		return nil, errors.New("invalid name")
+	}
+
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+	owner, _, err := s.loadPasskeyUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	creation, session, err := s.webAuthn.BeginRegistration(owner,
+		webauthn.WithExclusions(webauthn.Credentials(owner.credentials).CredentialDescriptors()),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred))
+	if err != nil {
+		s.logs.Error.Printf("Failed to begin passkey registration for user ID=%d: %v", userID, err)
+		return nil, errors.New("failed to start ceremony")
+	}
+	return s.startCeremony(userID, model.PasskeyCeremonyRegistration, passkeyCeremonyState{Session: *session, Name: name}, creation)
+}
+
+// FinishPasskeyRegistration stores the new credential. The first passkey of an
+// account without other second factors also gets recovery codes, because
+// passkeys count as a second factor from then on.
+func (s *UserService) FinishPasskeyRegistration(userID int, request model.PasskeyRegistration) (*model.PasskeyRegistered, error) {
+	ownerID, state, err := s.finishCeremony(request.CeremonyID, model.PasskeyCeremonyRegistration)
+	if err != nil {
+		return nil, err
+	}
+	if ownerID != userID {
+		return nil, errors.New("invalid ceremony")
+	}
+
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil || user == nil {
+		return nil, errors.New("database error")
+	}
+	owner, _, err := s.loadPasskeyUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(request.Credential)
+	if err != nil {
+		return nil, errors.New("invalid passkey")
+	}
+	credential, err := s.webAuthn.CreateCredential(owner, state.Session, parsed)
+	if err != nil {
+		s.logs.Info.Printf("Passkey registration rejected for user ID=%d: %v", userID, err)
+		return nil, errors.New("invalid passkey")
+	}
+
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return nil, errors.New("invalid passkey")
+	}
+	passkey := model.Passkey{
+		UserID:       userID,
+		CredentialID: credential.ID,
+		Name:         state.Name,
+		Data:         data,
+		SignCount:    credential.Authenticator.SignCount,
+	}
+	if err := s.passkeyRepo.InsertPasskey(&passkey); err != nil {
+		return nil, errors.New("database error")
+	}
+
+	registered := &model.PasskeyRegistered{Passkey: passkey}
+	remaining, err := s.mfaRepo.CountRecoveryCodes(userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if remaining == 0 {
+		codes, hashes, err := s.generateRecoveryCodes()
+		if err != nil {
+			return nil, errors.New("failed to generate recovery codes")
+		}
+		if err := s.mfaRepo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+			return nil, errors.New("database error")
+		}
+		registered.RecoveryCodes = codes
+	}
+
+	s.notifyMFAChange(userID, "A passkey was added to your account",
+		fmt.Sprintf("The passkey %q can now be used to sign in to your account.", passkey.Name))
+	s.logs.Info.Printf("Passkey ID=%d registered for user ID=%d", passkey.ID, userID)
+	return registered, nil
+}
+
+func (s *UserService) DeletePasskey(userID int, passkeyID int) error {
+	if err := s.passkeyRepo.DeletePasskey(userID, passkeyID); err != nil {
+		if err.Error() == "passkey not found" {
+			return err
+		}
+		return errors.New("database error")
+	}
+	if err := s.dropUnusedRecoveryCodes(userID); err != nil {
+		return err
+	}
+
+	s.notifyMFAChange(userID, "A passkey was removed from your account",
+		"A passkey can no longer be used to sign in to your account.")
+	s.logs.Info.Printf("Passkey ID=%d removed for user ID=%d", passkeyID, userID)
+	return nil
+}
+
+// BeginPasskeyLogin starts a passwordless login. The browser lets the user
+// pick one of the passkeys it holds for this site, so no email is needed.
+func (s *UserService) BeginPasskeyLogin() (*model.PasskeyCeremony, error) {
+	assertion, session, err := s.webAuthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		s.logs.Error.Printf("Failed to begin passkey login: %v", err)
+		return nil, errors.New("failed to start ceremony")
+	}
+	return s.startCeremony(0, model.PasskeyCeremonyLogin, passkeyCeremonyState{Session: *session}, assertion)
+}
+
+// FinishPasskeyLogin issues the same tokens as LoginUser. A user-verified
+// passkey already combines possession and PIN or biometrics, so no further
+// factor is asked for.
+func (s *UserService) FinishPasskeyLogin(request model.PasskeyLogin) (*model.Tokens, error) {
+	_, state, err := s.finishCeremony(request.CeremonyID, model.PasskeyCeremonyLogin)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(request.Credential)
+	if err != nil {
+		return nil, errors.New("invalid passkey")
+	}
+
+	var user *model.User
+	var passkeys []model.Passkey
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID, err := s.passkeyRepo.GetUserIDByHandle(userHandle)
+		if err != nil || userID == 0 {
+			return nil, errors.New("unknown user handle")
+		}
+		user, err = s.repo.GetUserByID(userID)
+		if err != nil || user == nil {
+			return nil, errors.New("unknown user handle")
+		}
+		var owner *passkeyUser
+		owner, passkeys, err = s.loadPasskeyUser(user)
+		return owner, err
+	}
+	_, credential, err := s.webAuthn.ValidatePasskeyLogin(handler, state.Session, parsed)
+	if err != nil {
+		if user != nil {
+			s.recordLoginEvent(user.ID, request.Client, false, "invalid passkey")
+		}
+		s.logs.Info.Printf("Passkey login rejected: %v", err)
+		return nil, errors.New("invalid passkey")
+	}
+
+	if user.Status == model.UserStatusDeleted {
+		return nil, errors.New("user not found")
+	}
+	if err := s.checkLock(user); err != nil {
+		s.recordLoginEvent(user.ID, request.Client, false, err.Error())
+		return nil, err
+	}
+	if err := s.checkLoginStatus(user); err != nil {
+		s.recordLoginEvent(user.ID, request.Client, false, err.Error())
+		return nil, err
+	}
+	if err := s.usePasskey(passkeys, credential); err != nil {
+		s.recordLoginEvent(user.ID, request.Client, false, err.Error())
+		return nil, err
+	}
+
+	if user.FailedLoginAttempts > 0 {
+		if err := s.repo.ResetFailedLogins(user.ID); err != nil {
+			s.logs.Error.Printf("Failed to reset login attempts for user ID=%d: %v", user.ID, err)
+		}
+	}
+	return s.completeLogin(user, request.Client, []string{model.AMRWebAuthn})
+}
+
+// BeginPasskeyMFA starts a ceremony for a user who passed the password step
+// and chose a passkey as second factor.
+func (s *UserService) BeginPasskeyMFA(request model.PasskeyMFABegin) (*model.PasskeyCeremony, error) {
+	userID, version, _, err := s.jwtService.ValidateMFAToken(request.MFAToken)
+	if err != nil {
+		return nil, errors.New("invalid mfa token")
+	}
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if user == nil || user.TokenVersion != version {
+		return nil, errors.New("invalid mfa token")
+	}
+	return s.beginPasskeyAssertion(user)
+}
+
+// beginPasskeyAssertion starts a ceremony checked by verifyPasskeyAssertion,
+// limited to the user's own passkeys.
+func (s *UserService) beginPasskeyAssertion(user *model.User) (*model.PasskeyCeremony, error) {
+	owner, _, err := s.loadPasskeyUser(user)
+	if err != nil {
+		return nil, err
+	}
+	if len(owner.credentials) == 0 {
+		return nil, errors.New("mfa not enabled")
+	}
+
+	assertion, session, err := s.webAuthn.BeginLogin(owner)
+	if err != nil {
+		s.logs.Error.Printf("Failed to begin passkey assertion for user ID=%d: %v", user.ID, err)
+		return nil, errors.New("failed to start ceremony")
+	}
+	return s.startCeremony(user.ID, model.PasskeyCeremonyMFA, passkeyCeremonyState{Session: *session}, assertion)
+}
+
+func (s *UserService) verifyPasskeyAssertion(user *model.User, ceremonyID string, response json.RawMessage) error {
+	ownerID, state, err := s.finishCeremony(ceremonyID, model.PasskeyCeremonyMFA)
+	if err != nil {
+		if err.Error() == "invalid ceremony" {
+			return errors.New("invalid mfa code")
+		}
+		return err
+	}
+	if ownerID != user.ID {
+		return errors.New("invalid mfa code")
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return errors.New("invalid mfa code")
+	}
+	owner, passkeys, err := s.loadPasskeyUser(user)
+	if err != nil {
+		return err
+	}
+	credential, err := s.webAuthn.ValidateLogin(owner, state.Session, parsed)
+	if err != nil {
+		s.logs.Info.Printf("Passkey assertion rejected for user ID=%d: %v", user.ID, err)
+		return errors.New("invalid mfa code")
+	}
+	if err := s.usePasskey(passkeys, credential); err != nil {
+		return errors.New("invalid mfa code")
+	}
+	return nil
+}
+
+// usePasskey stores the new sign counter. A counter that did not move forward
+// means the credential was probably cloned, and the login is refused.
+func (s *UserService) usePasskey(passkeys []model.Passkey, credential *webauthn.Credential) error {
+	for _, passkey := range passkeys {
+		if !bytes.Equal(passkey.CredentialID, credential.ID) {
+			continue
+		}
+		if credential.Authenticator.CloneWarning {
+			s.logs.Error.Printf("Sign counter of passkey ID=%d went backwards, possible cloned authenticator", passkey.ID)
+			return errors.New("invalid passkey")
+		}
+		ok, err := s.passkeyRepo.UpdateSignCount(passkey.ID, credential.Authenticator.SignCount)
+		if err != nil {
+			return errors.New("database error")
+		}
+		if !ok {
+			s.logs.Error.Printf("Sign counter of passkey ID=%d was reused, possible cloned authenticator", passkey.ID)
+			return errors.New("invalid passkey")
+		}
+		return nil
+	}
+	return errors.New("invalid passkey")
+}
+
+func (s *UserService) loadPasskeyUser(user *model.User) (*passkeyUser, []model.Passkey, error) {
+	candidate := make([]byte, 32)
+	if _, err := rand.Read(candidate); err != nil {
+		return nil, nil, errors.New("failed to generate user handle")
+	}
+	handle, err := s.passkeyRepo.GetOrCreateHandle(user.ID, candidate)
+	if err != nil {
+		return nil, nil, errors.New("database error")
+	}
+	passkeys, err := s.passkeyRepo.GetPasskeys(user.ID)
+	if err != nil {
+		return nil, nil, errors.New("database error")
+	}
+
+	owner := &passkeyUser{user: user, handle: handle, credentials: make([]webauthn.Credential, 0, len(passkeys))}
+	for _, passkey := range passkeys {
+		var credential webauthn.Credential
+		if err := json.Unmarshal(passkey.Data, &credential); err != nil {
+			s.logs.Error.Printf("Failed to decode passkey ID=%d: %v", passkey.ID, err)
+			continue
+		}
+		credential.Authenticator.SignCount = passkey.SignCount
+		owner.credentials = append(owner.credentials, credential)
+	}
+	return owner, passkeys, nil
+}
+
+func (s *UserService) startCeremony(userID int, ceremony string, state passkeyCeremonyState, options any) (*model.PasskeyCeremony, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, errors.New("failed to start ceremony")
+	}
+	token := GenerateRefreshToken()
+	expiresAt := time.Now().Add(s.config.PasskeyCeremonyTTL)
+	if err := s.passkeyRepo.InsertCeremony(HashToken(token), userID, ceremony, data, expiresAt); err != nil {
+		return nil, errors.New("database error")
+	}
+	return &model.PasskeyCeremony{CeremonyID: token, Options: options}, nil
+}
+
+// finishCeremony consumes the ceremony, so every challenge can be answered
+// only once.
+func (s *UserService) finishCeremony(ceremonyID string, ceremony string) (int, *passkeyCeremonyState, error) {
+	if ceremonyID == "" {
+		return 0, nil, errors.New("invalid ceremony")
+	}
+	userID, data, err := s.passkeyRepo.ConsumeCeremony(HashToken(ceremonyID), ceremony)
+	if err != nil {
+		return 0, nil, errors.New("database error")
+	}
+	if data == nil {
+		return 0, nil, errors.New("invalid ceremony")
+	}
+	var state passkeyCeremonyState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return 0, nil, errors.New("invalid ceremony")
+	}
+	return userID, &state, nil
+}
+
+// dropUnusedRecoveryCodes removes recovery codes once the last second factor
+// is gone; they would otherwise come back to life with the next enrollment.
+func (s *UserService) dropUnusedRecoveryCodes(userID int) error {
+	methods, err := s.mfaMethods(userID)
+	if err != nil {
+		return err
+	}
+	if len(methods) > 0 {
+		return nil
+	}
+	if err := s.mfaRepo.DeleteRecoveryCodes(userID); err != nil {
+		return errors.New("database error")
+	}
+	return nil
+}
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"testing"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "http://localhost:8081"
+)
+
+// softAuthenticator plays the part of browser and authenticator: it answers
+// the options the service hands out with a "none" attestation and ES256
+// assertions, the same way a platform authenticator would.
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		t.Fatal(err)
+	}
+	return &softAuthenticator{key: key, credentialID: credentialID}
+}
+
+// browserOptions is the part of the creation and request options a browser
+// passes on to the authenticator.
+type browserOptions struct {
+	PublicKey struct {
+		Challenge string `json:"challenge"`
+		User      struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	} `json:"publicKey"`
+}
+
+func decodeOptions(t *testing.T, options any) browserOptions {
+	t.Helper()
+	data, err := json.Marshal(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded browserOptions
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func (a *softAuthenticator) clientData(t *testing.T, ceremony string, challenge string) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]any{"type": ceremony, "challenge": challenge, "origin": testOrigin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func (a *softAuthenticator) authenticatorData(flags protocol.AuthenticatorFlags, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, byte(flags))
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attested...)
+}
+
+// Register answers a registration ceremony.
+func (a *softAuthenticator) Register(t *testing.T, options any) json.RawMessage {
+	t.Helper()
+	decoded := decodeOptions(t, options)
+	handle, err := base64.RawURLEncoding.DecodeString(decoded.PublicKey.User.ID)
+	if err != nil {
+		t.Fatalf("decode user handle: %v", err)
+	}
+	a.userHandle = handle
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	attested := make([]byte, 16) // AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, publicKey...)
+
+	attestation, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authenticatorData(protocol.FlagUserPresent|protocol.FlagUserVerified|protocol.FlagAttestedCredentialData, attested),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.credential(t, map[string]any{
+		"clientDataJSON":    encodeBase64(a.clientData(t, "webauthn.create", decoded.PublicKey.Challenge)),
+		"attestationObject": encodeBase64(attestation),
+	})
+}
+
+// Assert answers an authentication ceremony and moves the sign counter on.
+func (a *softAuthenticator) Assert(t *testing.T, options any) json.RawMessage {
+	t.Helper()
+	a.signCount++
+	return a.assert(t, options)
+}
+
+func (a *softAuthenticator) assert(t *testing.T, options any) json.RawMessage {
+	t.Helper()
+	decoded := decodeOptions(t, options)
+	clientData := a.clientData(t, "webauthn.get", decoded.PublicKey.Challenge)
+	authData := a.authenticatorData(protocol.FlagUserPresent|protocol.FlagUserVerified, nil)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.credential(t, map[string]any{
+		"clientDataJSON":    encodeBase64(clientData),
+		"authenticatorData": encodeBase64(authData),
+		"signature":         encodeBase64(signature),
+		"userHandle":        encodeBase64(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) credential(t *testing.T, response map[string]any) json.RawMessage {
+	t.Helper()
+	data, err := json.Marshal(map[string]any{
+		"id":       encodeBase64(a.credentialID),
+		"rawId":    encodeBase64(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func encodeBase64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func newTestWebAuthn(t *testing.T) *webauthn.WebAuthn {
+	t.Helper()
+	webAuthn, err := webauthn.New(&webauthn.Config{
+		RPID:          testRPID,
+		RPDisplayName: "Finance App",
+		RPOrigins:     []string{testOrigin},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return webAuthn
+}
+
+func TestPasskeyCeremony(t *testing.T) {
+	s := newTestUserService(t)
+	user := createTestUser(t, s, "passkey@example.com", "correct horse battery")
+	authenticator := newSoftAuthenticator(t)
+
+	ceremony, err := s.BeginPasskeyRegistration(user.ID, "Laptop")
+	if err != nil {
+		t.Fatalf("BeginPasskeyRegistration: %v", err)
+	}
+	registered, err := s.FinishPasskeyRegistration(user.ID, model.PasskeyRegistration{
+		CeremonyID: ceremony.CeremonyID,
+		Credential: authenticator.Register(t, ceremony.Options),
+	})
+	if err != nil {
+		t.Fatalf("FinishPasskeyRegistration: %v", err)
+	}
+	if registered.Passkey.Name != "Laptop" {
+		t.Errorf("passkey name = %q, want Laptop", registered.Passkey.Name)
+	}
+	if len(registered.RecoveryCodes) == 0 {
+		t.Error("the first passkey should come with recovery codes")
+	}
+
+	t.Run("login", func(t *testing.T) {
+		ceremony, err := s.BeginPasskeyLogin()
+		if err != nil {
+			t.Fatalf("BeginPasskeyLogin: %v", err)
+		}
+		tokens, err := s.FinishPasskeyLogin(model.PasskeyLogin{
+			CeremonyID: ceremony.CeremonyID,
+			Credential: authenticator.Assert(t, ceremony.Options),
+		})
+		if err != nil {
+			t.Fatalf("FinishPasskeyLogin: %v", err)
+		}
+		claims, err := s.jwtService.ValidateAccessToken(tokens.AccessToken)
+		if err != nil {
+			t.Fatalf("ValidateAccessToken: %v", err)
+		}
+		if claims.UserID != user.ID || !claims.HasSecondFactor() {
+			t.Errorf("claims = %+v, want user %d with a second factor", claims, user.ID)
+		}
+	})
+
+	t.Run("ceremony cannot be replayed", func(t *testing.T) {
+		ceremony, err := s.BeginPasskeyLogin()
+		if err != nil {
+			t.Fatalf("BeginPasskeyLogin: %v", err)
+		}
+		credential := authenticator.Assert(t, ceremony.Options)
+		if _, err := s.FinishPasskeyLogin(model.PasskeyLogin{CeremonyID: ceremony.CeremonyID, Credential: credential}); err != nil {
+			t.Fatalf("FinishPasskeyLogin: %v", err)
+		}
+		_, err = s.FinishPasskeyLogin(model.PasskeyLogin{CeremonyID: ceremony.CeremonyID, Credential: credential})
+		if err == nil || err.Error() != "invalid ceremony" {
+			t.Errorf("replayed ceremony: err = %v, want invalid ceremony", err)
+		}
+	})
+
+	t.Run("cloned authenticator is refused", func(t *testing.T) {
+		ceremony, err := s.BeginPasskeyLogin()
+		if err != nil {
+			t.Fatalf("BeginPasskeyLogin: %v", err)
+		}
+		// Answering without moving the counter is what a copy of the key
+		// that fell behind the original would do.
+		_, err = s.FinishPasskeyLogin(model.PasskeyLogin{
+			CeremonyID: ceremony.CeremonyID,
+			Credential: authenticator.assert(t, ceremony.Options),
+		})
+		if err == nil || err.Error() != "invalid passkey" {
+			t.Errorf("stale sign counter: err = %v, want invalid passkey", err)
+		}
+	})
+
+	t.Run("wrong key is refused", func(t *testing.T) {
+		ceremony, err := s.BeginPasskeyLogin()
+		if err != nil {
+			t.Fatalf("BeginPasskeyLogin: %v", err)
+		}
+		impostor := newSoftAuthenticator(t)
+		impostor.credentialID = authenticator.credentialID
+		impostor.userHandle = authenticator.userHandle
+		impostor.signCount = authenticator.signCount + 10
+		_, err = s.FinishPasskeyLogin(model.PasskeyLogin{
+			CeremonyID: ceremony.CeremonyID,
+			Credential: impostor.Assert(t, ceremony.Options),
+		})
+		if err == nil || err.Error() != "invalid passkey" {
+			t.Errorf("foreign signature: err = %v, want invalid passkey", err)
+		}
+	})
+}
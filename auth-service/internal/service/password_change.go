@@ -0,0 +1,92 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/finance-app/finance-app/auth-service/internal/notifier"
+	"time"
+)
+
+// ChangePassword signs the user out of every session. When the caller passes
+// the refresh token of the session it is using, a fresh token pair is issued
+// for it so the current device stays logged in; otherwise nil is returned.
+func (s *UserService) ChangePassword(userID int, request model.ChangePassword) (*model.Tokens, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+
+	// The current password is as good a target for guessing as the login
+	// form, so wrong guesses count towards the same lock.
+	if err := s.checkLock(user); err != nil {
+		return nil, err
+	}
+	if !CheckPasswordHash(request.CurrentPassword, user.Password) {
+		s.recordFailedLogin(user, request.Client)
+		s.recordLoginEvent(user.ID, request.Client, false, "wrong user password")
+		return nil, errors.New("wrong user password")
+	}
+	if user.FailedLoginAttempts > 0 {
+		if err := s.repo.ResetFailedLogins(user.ID); err != nil {
+			s.logs.Error.Printf("Failed to reset login attempts for user ID=%d: %v", user.ID, err)
+		}
+	}
+	if request.CurrentPassword == request.NewPassword {
+		return nil, errors.New("weak password: must differ from the current password")
+	}
+	if err := s.config.PasswordPolicy.Validate(request.NewPassword); err != nil {
+		return nil, err
+	}
+
+	keepSession := false
+	if request.RefreshToken != "" {
+		sessionUser, err := s.repo.GetRefreshToken(request.RefreshToken)
+		if err != nil {
+			return nil, errors.New("database error")
+		}
+		keepSession = sessionUser != nil && sessionUser.ID == userID
+	}
+
+	hashedPassword, err := HashPassword(request.NewPassword)
+	if err != nil {
+		return nil, errors.New("failed to hash password")
+	}
+	if err := s.repo.UpdatePassword(userID, hashedPassword); err != nil {
+		return nil, errors.New("database error")
+	}
+	if err := s.revokeAllSessions(userID); err != nil {
+		return nil, err
+	}
+
+	s.notify(user, notifier.Event{
+		Type:       notifier.EventPasswordChanged,
+		Subject:    "Your password was changed",
+		Text:       fmt.Sprintf("The password of your account was changed at %s and all other sessions were signed out.", time.Now().Format(time.RFC1123)),
+		Client:     request.Client,
+		OccurredAt: time.Now(),
+	})
+	s.audit.UserEvent(model.AuditPasswordChanged, userID, request.Client, nil)
+	s.logs.Info.Printf("Password changed for user ID=%d", userID)
+
+	if !keepSession {
+		return nil, nil
+	}
+
+	user, err = s.repo.GetUserByID(userID)
+	if err != nil || user == nil {
+		return nil, errors.New("database error")
+	}
+	return s.issueTokens(user, request.Client, model.Authentication{Time: time.Now(), Methods: []string{model.AMRPassword}})
+}
+
+// notify is best effort: the operation that triggered it has already
+// happened, so a delivery failure is only logged.
+func (s *UserService) notify(user *model.User, event notifier.Event) {
+	if err := s.notifier.Notify(user, event); err != nil {
+		s.logs.Error.Printf("Failed to send %s notice to user ID=%d: %v", event.Type, user.ID, err)
+	}
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/finance-app/finance-app/auth-service/internal/mailer"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"time"
+)
+
+// ForgotPassword answers the same way, and just as fast, whether or not the
+// email is registered: the account is looked up and mailed in the background,
+// where failures are only logged.
+func (s *UserService) ForgotPassword(email string) {
+	go s.sendForgottenPasswordReset(email)
+}
+
+func (s *UserService) sendForgottenPasswordReset(email string) {
+	user, err := s.repo.GetUserByEmail(email)
+	if err != nil {
+		s.logs.Error.Printf("Failed to look up account for password reset: %v", err)
+		return
+	}
+	if user == nil || user.Status == model.UserStatusDeleted || user.Status == model.UserStatusDisabled {
+		s.logs.Info.Printf("Password reset requested for unknown or inactive account")
+		return
+	}
+
+	if err := s.SendPasswordReset(user); err != nil {
+		s.logs.Error.Printf("Failed to send password reset email to user ID=%d: %v", user.ID, err)
+	}
+}
+
+func (s *UserService) SendPasswordReset(user *model.User) error {
+	if err := s.tokenRepo.InvalidateTokens(user.ID, model.TokenPurposePasswordReset); err != nil {
+		return err
+	}
+
+	token := GenerateRefreshToken()
+	expiresAt := time.Now().Add(s.config.PasswordResetTTL)
+	if err := s.tokenRepo.InsertToken(user.ID, model.TokenPurposePasswordReset, HashToken(token), expiresAt); err != nil {
+		return err
+	}
+
+	return s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your account. If it was you, open the link below:\n\n%s/reset-password?token=%s\n\nThe link expires at %s. If you didn't ask for this, you can ignore this email.",
+			user.Name, s.config.AppBaseURL, token, expiresAt.Format(time.RFC1123)),
+	})
+}
+
+func (s *UserService) ResetPassword(token string, newPassword string, client model.ClientInfo) error {
+	if token == "" {
+		return errors.New("invalid reset token")
+	}
+	if err := s.config.PasswordPolicy.Validate(newPassword); err != nil {
+		return err
+	}
+
+	userID, err := s.tokenRepo.ConsumeToken(model.TokenPurposePasswordReset, HashToken(token))
+	if err != nil {
+		return errors.New("database error")
+	}
+	if userID == 0 {
+		return errors.New("invalid reset token")
+	}
+
+	hashedPassword, err := HashPassword(newPassword)
+	if err != nil {
+		return errors.New("failed to hash password")
+	}
+	if err := s.repo.UpdatePassword(userID, hashedPassword); err != nil {
+		return errors.New("database error")
+	}
+	if err := s.repo.ResetFailedLogins(userID); err != nil {
+		return errors.New("database error")
+	}
+	if err := s.revokeAllSessions(userID); err != nil {
+		return err
+	}
+
+	s.audit.UserEvent(model.AuditPasswordReset, userID, client, nil)
+	s.logs.Info.Printf("Password reset for user ID=%d", userID)
+	return nil
+}
+
+func (s *UserService) revokeAllSessions(userID int) error {
+	if err := s.repo.DeleteUserRefreshTokens(userID); err != nil {
+		return errors.New("database error")
+	}
+	if err := s.repo.IncrementTokenVersion(userID); err != nil {
+		return errors.New("database error")
+	}
+	s.tokenState.Invalidate(userID)
+	return nil
+}
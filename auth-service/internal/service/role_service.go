@@ -0,0 +1,87 @@
+package service
+
+import (
+	"errors"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/finance-app/finance-app/auth-service/internal/repository"
+)
+
+type RoleService struct {
+	roleRepo *repository.RoleRepository
+	userRepo *repository.UserRepository
+	audit    *AuditLog
+	logs     *logger.Logger
+}
+
+func NewRoleService(roleRepo *repository.RoleRepository, userRepo *repository.UserRepository, audit *AuditLog, logs *logger.Logger) *RoleService {
+	return &RoleService{
+		roleRepo: roleRepo,
+		userRepo: userRepo,
+		audit:    audit,
+		logs:     logs,
+	}
+}
+
+func (s *RoleService) ListRoles() ([]model.Role, error) {
+	roles, err := s.roleRepo.GetRoles()
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	return roles, nil
+}
+
+func (s *RoleService) GetUserRoles(userID int) ([]string, error) {
+	if err := s.ensureUserExists(userID); err != nil {
+		return nil, err
+	}
+	roles, err := s.roleRepo.GetUserRoles(userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	return roles, nil
+}
+
+func (s *RoleService) AssignRole(adminID int, userID int, role string, client model.ClientInfo) error {
+	if role == "" {
+		return errors.New("role is required")
+	}
+	if err := s.ensureUserExists(userID); err != nil {
+		return err
+	}
+	if err := s.roleRepo.AssignRole(userID, role); err != nil {
+		if err.Error() == "role not found" {
+			return err
+		}
+		return errors.New("database error")
+	}
+	s.audit.AdminEvent(model.AuditRoleAssigned, adminID, userID, client, map[string]string{"role": role})
+	s.logs.Info.Printf("Role %s assigned to user ID=%d", role, userID)
+	return nil
+}
+
+func (s *RoleService) RemoveRole(adminID int, userID int, role string, client model.ClientInfo) error {
+	if err := s.ensureUserExists(userID); err != nil {
+		return err
+	}
+	if err := s.roleRepo.RemoveRole(userID, role); err != nil {
+		if err.Error() == "role not assigned" {
+			return err
+		}
+		return errors.New("database error")
+	}
+	s.audit.AdminEvent(model.AuditRoleRemoved, adminID, userID, client, map[string]string{"role": role})
+	s.logs.Info.Printf("Role %s removed from user ID=%d", role, userID)
+	return nil
+}
+
+func (s *RoleService) ensureUserExists(userID int) error {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return errors.New("database error")
+	}
+	if user == nil {
+		return errors.New("user not found")
+	}
+	return nil
+}
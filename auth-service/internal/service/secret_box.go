@@ -0,0 +1,58 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+)
+
+// SecretBox encrypts secrets that have to be read back later, such as TOTP
+// seeds, so a database dump alone is not enough to generate codes. It also
+// keys the hashes of short secrets like recovery codes, which could otherwise
+// be brute-forced from a dump.
+type SecretBox struct {
+	aead   cipher.AEAD
+	macKey []byte
+}
+
+func NewSecretBox(key string) *SecretBox {
+	sum := sha256.Sum256([]byte(key))
+	block, _ := aes.NewCipher(sum[:])
+	aead, _ := cipher.NewGCM(block)
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte("hash"))
+	return &SecretBox{aead: aead, macKey: mac.Sum(nil)}
+}
+
+// Hash returns a keyed digest of value for storage and lookup.
+func (b *SecretBox) Hash(value string) string {
+	mac := hmac.New(sha256.New, b.macKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (b *SecretBox) Seal(plaintext string) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+func (b *SecretBox) Open(sealed string) (string, error) {
+	data, err := base64.RawStdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < b.aead.NonceSize() {
+		return "", errors.New("invalid sealed secret")
+	}
+	plaintext, err := b.aead.Open(nil, data[:b.aead.NonceSize()], data[b.aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("invalid sealed secret")
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/finance-app/finance-app/auth-service/internal/notifier"
+	"golang.org/x/oauth2"
+	"sort"
+	"strings"
+	"time"
+)
+
+func (s *UserService) SocialProviders() []string {
+	names := make([]string, 0, len(s.socialProviders))
+	for name := range s.socialProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *UserService) BeginSocialLogin(provider string) (*model.SocialAuthorization, error) {
+	return s.beginSocial(provider, nil)
+}
+
+// FinishSocialLogin signs in the user behind the identity, creating an account
+// for identities seen for the first time. An unknown identity whose email
+// belongs to an existing account is refused: the owner has to sign in and
+// link it, otherwise anyone controlling that address at the provider would
+// get into the account. A second factor is still asked for when enabled.
+func (s *UserService) FinishSocialLogin(provider string, callback model.SocialCallback) (*model.Tokens, *model.MFAChallenge, error) {
+	identity, state, err := s.finishSocial(provider, callback)
+	if err != nil {
+		return nil, nil, err
+	}
+	if state.UserID != nil {
+		return nil, nil, errors.New("invalid social state")
+	}
+
+	linked, err := s.identityRepo.GetIdentity(provider, identity.Subject)
+	if err != nil {
+		return nil, nil, errors.New("database error")
+	}
+	var user *model.User
+	if linked == nil {
+		user, err = s.provisionSocialUser(provider, identity, callback.Client)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		user, err = s.repo.GetUserByID(linked.UserID)
+		if err != nil {
+			return nil, nil, errors.New("database error")
+		}
+		if user == nil || user.Status == model.UserStatusDeleted {
+			return nil, nil, errors.New("user not found")
+		}
+		if err := s.identityRepo.TouchIdentity(linked.ID); err != nil {
+			s.logs.Error.Printf("Failed to update identity ID=%d: %v", linked.ID, err)
+		}
+	}
+
+	if err := s.checkLock(user); err != nil {
+		s.recordLoginEvent(user.ID, callback.Client, false, err.Error())
+		return nil, nil, err
+	}
+	if err := s.checkLoginStatus(user); err != nil {
+		s.recordLoginEvent(user.ID, callback.Client, false, err.Error())
+		return nil, nil, err
+	}
+
+	methods, err := s.mfaMethods(user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(methods) > 0 {
+		challenge, err := s.mfaChallenge(user, methods, model.AMRFederated)
+		if err != nil {
+			return nil, nil, err
+		}
+		s.logs.Info.Printf("Second factor required for user ID=%d after %s sign-in", user.ID, provider)
+		return nil, challenge, nil
+	}
+
+	tokens, err := s.completeLogin(user, callback.Client, []string{model.AMRFederated})
+	if err != nil {
+		return nil, nil, err
+	}
+	return tokens, nil, nil
+}
+
+func (s *UserService) BeginIdentityLink(userID int, provider string) (*model.SocialAuthorization, error) {
+	return s.beginSocial(provider, &userID)
+}
+
+func (s *UserService) LinkIdentity(userID int, provider string, callback model.SocialCallback) (*model.Identity, error) {
+	identity, state, err := s.finishSocial(provider, callback)
+	if err != nil {
+		return nil, err
+	}
+	if state.UserID == nil || *state.UserID != userID {
+		return nil, errors.New("invalid social state")
+	}
+
+	linked := model.Identity{UserID: userID, Provider: provider, Subject: identity.Subject, Email: identity.Email}
+	inserted, err := s.identityRepo.InsertIdentity(linked)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if !inserted {
+		return nil, errors.New("identity already linked")
+	}
+	stored, err := s.identityRepo.GetIdentity(provider, identity.Subject)
+	if err != nil || stored == nil {
+		return nil, errors.New("database error")
+	}
+
+	s.logs.Info.Printf("User ID=%d linked a %s identity", userID, provider)
+	s.notifyIdentityChange(userID, fmt.Sprintf("%s sign-in was linked to your account", provider),
+		fmt.Sprintf("You can now sign in with %s.", provider))
+	return stored, nil
+}
+
+func (s *UserService) ListIdentities(userID int) ([]model.Identity, error) {
+	identities, err := s.identityRepo.ListIdentities(userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	return identities, nil
+}
+
+// UnlinkIdentity refuses to remove the last way to sign in: accounts created
+// through a provider have no password until one is set by a reset.
+func (s *UserService) UnlinkIdentity(userID int, identityID int) error {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return errors.New("database error")
+	}
+	if user == nil {
+		return errors.New("user not found")
+	}
+	if user.Password == "" {
+		identities, err := s.identityRepo.CountIdentities(userID)
+		if err != nil {
+			return errors.New("database error")
+		}
+		passkeys, err := s.passkeyRepo.CountPasskeys(userID)
+		if err != nil {
+			return errors.New("database error")
+		}
+		if identities <= 1 && passkeys == 0 {
+			return errors.New("last sign-in method")
+		}
+	}
+
+	deleted, err := s.identityRepo.DeleteIdentity(userID, identityID)
+	if err != nil {
+		return errors.New("database error")
+	}
+	if !deleted {
+		return errors.New("identity not found")
+	}
+
+	s.logs.Info.Printf("User ID=%d unlinked identity ID=%d", userID, identityID)
+	s.notifyIdentityChange(userID, "A sign-in provider was unlinked from your account",
+		"A sign-in provider was removed from your account.")
+	return nil
+}
+
+func (s *UserService) beginSocial(name string, userID *int) (*model.SocialAuthorization, error) {
+	provider, ok := s.socialProviders[name]
+	if !ok {
+		return nil, errors.New("unknown provider")
+	}
+
+	state := GenerateRefreshToken()
+	loginState := model.SocialLoginState{
+		Provider:     name,
+		Nonce:        GenerateRefreshToken(),
+		CodeVerifier: oauth2.GenerateVerifier(),
+		UserID:       userID,
+		ExpiresAt:    time.Now().Add(s.config.SocialStateTTL),
+	}
+	authorizationURL, err := provider.AuthCodeURL(state, loginState.Nonce, loginState.CodeVerifier)
+	if err != nil {
+		s.logs.Error.Printf("Discovery of %s failed: %v", name, err)
+		return nil, errors.New("provider unavailable")
+	}
+	if err := s.identityRepo.InsertSocialState(HashToken(state), loginState); err != nil {
+		return nil, errors.New("database error")
+	}
+	return &model.SocialAuthorization{AuthorizationURL: authorizationURL, State: state}, nil
+}
+
+// finishSocial checks the state, which can be used once, and returns the
+// verified identity.
+func (s *UserService) finishSocial(name string, callback model.SocialCallback) (*SocialIdentity, *model.SocialLoginState, error) {
+	provider, ok := s.socialProviders[name]
+	if !ok {
+		return nil, nil, errors.New("unknown provider")
+	}
+	if callback.State == "" || callback.Code == "" {
+		return nil, nil, errors.New("invalid social state")
+	}
+	state, err := s.identityRepo.ConsumeSocialState(HashToken(callback.State), name)
+	if err != nil {
+		return nil, nil, errors.New("database error")
+	}
+	if state == nil {
+		return nil, nil, errors.New("invalid social state")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), socialProviderTimeout)
+	defer cancel()
+	identity, err := provider.Exchange(ctx, callback.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		s.logs.Info.Printf("Sign-in with %s rejected: %v", name, err)
+		return nil, nil, errors.New("social login failed")
+	}
+	return identity, state, nil
+}
+
+func (s *UserService) provisionSocialUser(provider string, identity *SocialIdentity, client model.ClientInfo) (*model.User, error) {
+	email := strings.ToLower(strings.TrimSpace(identity.Email))
+	if email == "" || !identity.EmailVerified {
+		return nil, errors.New("email not verified by provider")
+	}
+	existingUser, err := s.repo.GetUserByEmail(email)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if existingUser != nil {
+		s.logs.Info.Printf("Sign-in with %s refused: email belongs to user ID=%d", provider, existingUser.ID)
+		return nil, errors.New("account exists")
+	}
+
+	name := strings.TrimSpace(identity.Name)
+	if name == "" {
+		name, _, _ = strings.Cut(email, "@")
+	}
+	if len(name) > maxNameLength {
+		name = name[:maxNameLength]
+	}
+	user := model.User{Name: name, Email: email, Status: model.UserStatusActive}
+	event := newDomainEvent(model.EventUserRegistered, 0, map[string]string{"email": email, "name": name, "method": provider})
+	user.ID, err = s.identityRepo.InsertUserWithIdentity(user, model.Identity{Provider: provider, Subject: identity.Subject, Email: email}, event)
+	if err != nil {
+		if err.Error() == "email already in use" {
+			return nil, errors.New("account exists")
+		}
+		return nil, errors.New("database error: could not create user")
+	}
+	if err := s.roleRepo.AssignRole(user.ID, model.RoleUser); err != nil {
+		s.logs.Error.Printf("Failed to assign default role to user ID=%d: %v", user.ID, err)
+	}
+
+	s.audit.UserEvent(model.AuditUserRegistered, user.ID, client, map[string]string{"method": provider})
+	s.logs.Info.Printf("User registered through %s: ID=%d, Email=%s", provider, user.ID, user.Email)
+	created, err := s.repo.GetUserByID(user.ID)
+	if err != nil || created == nil {
+		return nil, errors.New("database error")
+	}
+	return created, nil
+}
+
+func (s *UserService) notifyIdentityChange(userID int, subject string, text string) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil || user == nil {
+		return
+	}
+	s.notify(user, notifier.Event{
+		Type:       notifier.EventIdentityChanged,
+		Subject:    subject,
+		Text:       fmt.Sprintf("%s This happened at %s.", text, time.Now().Format(time.RFC1123)),
+		OccurredAt: time.Now(),
+	})
+}
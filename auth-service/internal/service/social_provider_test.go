@@ -0,0 +1,346 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	fakeClientID     = "finance-app"
+	fakeClientSecret = "fake-client-secret"
+	fakeRedirectURL  = "http://localhost:8081/auth/social/acme/callback"
+	fakeKeyID        = "fake-key"
+)
+
+// fakeIssuer is an OpenID Connect provider that signs in whoever the test
+// asks for. The standard claims can be overridden to check what the relying
+// party verifies.
+type fakeIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu sync.Mutex
+	// signingKey signs the ID tokens; it differs from key to simulate a
+	// token that was not issued by the provider.
+	signingKey *rsa.PrivateKey
+	codes      map[string]fakeGrant
+}
+
+type fakeGrant struct {
+	challenge   string
+	redirectURI string
+	claims      jwt.MapClaims
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &fakeIssuer{key: key, signingKey: key, codes: make(map[string]fakeGrant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", issuer.discovery)
+	mux.HandleFunc("/jwks", issuer.jwks)
+	mux.HandleFunc("/token", issuer.token)
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+func (f *fakeIssuer) URL() string {
+	return f.server.URL
+}
+
+func (f *fakeIssuer) provider() *SocialProvider {
+	return NewSocialProvider(SocialProviderConfig{
+		Name:         "acme",
+		Issuer:       f.URL(),
+		ClientID:     fakeClientID,
+		ClientSecret: fakeClientSecret,
+		RedirectURL:  fakeRedirectURL,
+	})
+}
+
+// authorize plays the browser and the provider's login page: it checks the
+// authorization URL and returns the code the provider redirects back with.
+// The ID token for the code carries claims on top of the standard ones.
+func (f *fakeIssuer) authorize(t *testing.T, authorizationURL string, claims jwt.MapClaims) string {
+	t.Helper()
+	parsed, err := url.Parse(authorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if parsed.Scheme+"://"+parsed.Host+parsed.Path != f.URL()+"/authorize" {
+		t.Fatalf("authorization URL %s is not the provider's", authorizationURL)
+	}
+	if query.Get("client_id") != fakeClientID || query.Get("redirect_uri") != fakeRedirectURL || query.Get("response_type") != "code" {
+		t.Fatalf("unexpected authorization request %v", query)
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("authorization request without S256 PKCE: %v", query)
+	}
+	if query.Get("state") == "" || query.Get("nonce") == "" {
+		t.Fatalf("authorization request without state or nonce: %v", query)
+	}
+	if !slices.Contains(strings.Fields(query.Get("scope")), "openid") {
+		t.Fatalf("scope %q lacks openid", query.Get("scope"))
+	}
+
+	now := time.Now()
+	idClaims := jwt.MapClaims{
+		"iss":   f.URL(),
+		"aud":   fakeClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"nonce": query.Get("nonce"),
+	}
+	for name, value := range claims {
+		idClaims[name] = value
+	}
+
+	code := GenerateRefreshToken()
+	f.mu.Lock()
+	f.codes[code] = fakeGrant{challenge: query.Get("code_challenge"), redirectURI: query.Get("redirect_uri"), claims: idClaims}
+	f.mu.Unlock()
+	return code
+}
+
+func (f *fakeIssuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeFakeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                f.URL(),
+		"authorization_endpoint":                f.URL() + "/authorize",
+		"token_endpoint":                        f.URL() + "/token",
+		"jwks_uri":                              f.URL() + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (f *fakeIssuer) jwks(w http.ResponseWriter, r *http.Request) {
+	writeFakeJSON(w, http.StatusOK, model.JSONWebKeySet{Keys: []model.JSONWebKey{{
+		KeyType:   "RSA",
+		Use:       "sig",
+		Algorithm: "RS256",
+		KeyID:     fakeKeyID,
+		Modulus:   base64.RawURLEncoding.EncodeToString(f.key.PublicKey.N.Bytes()),
+		Exponent:  base64.RawURLEncoding.EncodeToString(big.NewInt(int64(f.key.PublicKey.E)).Bytes()),
+	}}})
+}
+
+// token redeems a code once, after checking the client and PKCE verifier.
+func (f *fakeIssuer) token(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	if clientID != fakeClientID || clientSecret != fakeClientSecret {
+		writeFakeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if r.PostFormValue("grant_type") != "authorization_code" {
+		writeFakeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	f.mu.Lock()
+	code := r.PostFormValue("code")
+	grant, found := f.codes[code]
+	delete(f.codes, code)
+	signingKey := f.signingKey
+	f.mu.Unlock()
+	if !found || grant.redirectURI != r.PostFormValue("redirect_uri") ||
+		oauth2.S256ChallengeFromVerifier(r.PostFormValue("code_verifier")) != grant.challenge {
+		writeFakeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, grant.claims)
+	token.Header["kid"] = fakeKeyID
+	idToken, err := token.SignedString(signingKey)
+	if err != nil {
+		writeFakeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeFakeJSON(w, http.StatusOK, map[string]any{
+		"access_token": "fake-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func writeFakeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func TestSocialProviderExchange(t *testing.T) {
+	identity := jwt.MapClaims{"sub": "248289761001", "email": "dana@example.com", "email_verified": true, "name": "Dana"}
+	with := func(overrides jwt.MapClaims) jwt.MapClaims {
+		claims := jwt.MapClaims{}
+		for name, value := range identity {
+			claims[name] = value
+		}
+		for name, value := range overrides {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		want   *SocialIdentity
+	}{
+		{"verified identity", identity, &SocialIdentity{Subject: "248289761001", Email: "dana@example.com", EmailVerified: true, Name: "Dana"}},
+		{"email_verified as a string", with(jwt.MapClaims{"email_verified": "true"}),
+			&SocialIdentity{Subject: "248289761001", Email: "dana@example.com", EmailVerified: true, Name: "Dana"}},
+		{"unverified email", with(jwt.MapClaims{"email_verified": false}),
+			&SocialIdentity{Subject: "248289761001", Email: "dana@example.com", Name: "Dana"}},
+		{"other nonce", with(jwt.MapClaims{"nonce": "replayed"}), nil},
+		{"other audience", with(jwt.MapClaims{"aud": "someone-else"}), nil},
+		{"other issuer", with(jwt.MapClaims{"iss": "https://evil.example.com"}), nil},
+		{"expired", with(jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer := newFakeIssuer(t)
+			provider := issuer.provider()
+			nonce, verifier := GenerateRefreshToken(), oauth2.GenerateVerifier()
+			authorizationURL, err := provider.AuthCodeURL("state", nonce, verifier)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code := issuer.authorize(t, authorizationURL, tt.claims)
+
+			got, err := provider.Exchange(context.Background(), code, verifier, nonce)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("Exchange accepted the token: %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != *tt.want {
+				t.Fatalf("identity = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("wrong code verifier", func(t *testing.T) {
+		issuer := newFakeIssuer(t)
+		provider := issuer.provider()
+		nonce := GenerateRefreshToken()
+		authorizationURL, err := provider.AuthCodeURL("state", nonce, oauth2.GenerateVerifier())
+		if err != nil {
+			t.Fatal(err)
+		}
+		code := issuer.authorize(t, authorizationURL, identity)
+		if _, err := provider.Exchange(context.Background(), code, oauth2.GenerateVerifier(), nonce); err == nil {
+			t.Fatal("Exchange succeeded with another code verifier")
+		}
+	})
+
+	t.Run("token not signed by the provider", func(t *testing.T) {
+		issuer := newFakeIssuer(t)
+		rogue, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		issuer.signingKey = rogue
+		provider := issuer.provider()
+		nonce, verifier := GenerateRefreshToken(), oauth2.GenerateVerifier()
+		authorizationURL, err := provider.AuthCodeURL("state", nonce, verifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code := issuer.authorize(t, authorizationURL, identity)
+		if _, err := provider.Exchange(context.Background(), code, verifier, nonce); err == nil {
+			t.Fatal("Exchange accepted a token signed with an unknown key")
+		}
+	})
+}
+
+func TestSocialLogin(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	s := newTestUserService(t, issuer.provider())
+	createTestUser(t, s, "erin@example.com", "Correct-Horse-1")
+
+	signIn := func(t *testing.T, claims jwt.MapClaims) (*model.Tokens, model.SocialCallback, error) {
+		t.Helper()
+		authorization, err := s.BeginSocialLogin("acme")
+		if err != nil {
+			t.Fatal(err)
+		}
+		callback := model.SocialCallback{Code: issuer.authorize(t, authorization.AuthorizationURL, claims), State: authorization.State}
+		tokens, _, err := s.FinishSocialLogin("acme", callback)
+		return tokens, callback, err
+	}
+
+	t.Run("new identity gets an account", func(t *testing.T) {
+		dana := jwt.MapClaims{"sub": "1001", "email": "Dana@Example.com", "email_verified": true, "name": "Dana"}
+		tokens, callback, err := signIn(t, dana)
+		if err != nil || tokens == nil {
+			t.Fatalf("FinishSocialLogin = %v, %v", tokens, err)
+		}
+		user, err := s.repo.GetUserByEmail("dana@example.com")
+		if err != nil || user == nil {
+			t.Fatalf("no account was created: %v", err)
+		}
+		if user.Email != "dana@example.com" || user.Name != "Dana" || user.Password != "" {
+			t.Fatalf("created user = %+v", user)
+		}
+
+		if _, _, err := s.FinishSocialLogin("acme", callback); err == nil || err.Error() != "invalid social state" {
+			t.Fatalf("replayed callback: %v, want invalid social state", err)
+		}
+
+		if tokens, _, err := signIn(t, dana); err != nil || tokens == nil {
+			t.Fatalf("second sign-in = %v, %v", tokens, err)
+		}
+		identities, err := s.ListIdentities(user.ID)
+		if err != nil || len(identities) != 1 {
+			t.Fatalf("identities = %v, %v, want one", identities, err)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		want   string
+	}{
+		{"email of an existing account", jwt.MapClaims{"sub": "1002", "email": "ERIN@example.com", "email_verified": true}, "account exists"},
+		{"unverified email", jwt.MapClaims{"sub": "1003", "email": "frank@example.com", "email_verified": false}, "email not verified by provider"},
+		{"tampered nonce", jwt.MapClaims{"sub": "1004", "email": "grace@example.com", "email_verified": true, "nonce": "replayed"}, "social login failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, _, err := signIn(t, tt.claims)
+			if err == nil || err.Error() != tt.want {
+				t.Fatalf("FinishSocialLogin = %v, %v, want %s", tokens, err, tt.want)
+			}
+		})
+	}
+}
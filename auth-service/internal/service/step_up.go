@@ -0,0 +1,98 @@
+package service
+
+import (
+	"errors"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"time"
+)
+
+// BeginPasskeyReauthentication starts the ceremony whose assertion is then
+// passed to Reauthenticate.
+func (s *UserService) BeginPasskeyReauthentication(userID int) (*model.PasskeyCeremony, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+	return s.beginPasskeyAssertion(user)
+}
+
+// Reauthenticate checks the given factors again and returns a short-lived
+// token with a fresh auth_time for routes that demand a step-up. Failures count
+// as failed logins, so a stolen access token can't be used to guess the
+// password or codes.
+func (s *UserService) Reauthenticate(userID int, request model.Reauthenticate) (*model.ElevatedToken, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+	if err := s.checkLock(user); err != nil {
+		return nil, err
+	}
+	if err := s.checkSessionStatus(user); err != nil {
+		return nil, err
+	}
+
+	amr := []string{}
+	if request.Password != "" {
+		if !CheckPasswordHash(request.Password, user.Password) {
+			s.recordFailedLogin(user, request.Client)
+			s.recordLoginEvent(user.ID, request.Client, false, "wrong user password")
+			return nil, errors.New("wrong user password")
+		}
+		amr = append(amr, model.AMRPassword)
+	}
+	if len(request.Credential) > 0 || request.Code != "" || request.RecoveryCode != "" {
+		method := model.AMROTP
+		if len(request.Credential) > 0 {
+			method = model.AMRWebAuthn
+			err = s.verifyPasskeyAssertion(user, request.CeremonyID, request.Credential)
+		} else {
+			err = s.verifySecondFactor(user.ID, request.Code, request.RecoveryCode)
+		}
+		if err != nil {
+			if err.Error() == "invalid mfa code" {
+				s.recordFailedLogin(user, request.Client)
+				s.recordLoginEvent(user.ID, request.Client, false, err.Error())
+			}
+			return nil, err
+		}
+		amr = append(amr, method)
+	}
+	if len(amr) == 0 {
+		return nil, errors.New("no authentication factor")
+	}
+	if len(amr) > 1 {
+		amr = append(amr, model.AMRMFA)
+	}
+
+	if user.FailedLoginAttempts > 0 {
+		if err := s.repo.ResetFailedLogins(user.ID); err != nil {
+			s.logs.Error.Printf("Failed to reset login attempts for user ID=%d: %v", user.ID, err)
+		}
+	}
+	now := time.Now()
+	claims, err := s.accessClaims(user, model.Authentication{Time: now, Methods: amr})
+	if err != nil {
+		return nil, err
+	}
+	claims.ExpiresAt = now.Add(s.config.StepUpTokenTTL)
+	accessToken, err := s.jwtService.GenerateAccessToken(*claims)
+	if err != nil {
+		return nil, errors.New("error in access token generation")
+	}
+
+	s.recordLoginEvent(user.ID, request.Client, true, "reauthenticated")
+	s.logs.Info.Printf("User ID=%d reauthenticated with %v", user.ID, amr)
+	return &model.ElevatedToken{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(s.config.StepUpTokenTTL.Seconds()),
+		AMR:         amr,
+	}, nil
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"errors"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/finance-app/finance-app/auth-service/internal/repository"
+	"sync"
+	"time"
+)
+
+type tokenState struct {
+	status    string
+	version   int
+	expiresAt time.Time
+}
+
+// TokenStateCache keeps a short-lived copy of each user's status and token
+// version so that access tokens of disabled users can be rejected without a
+// database round trip on every request.
+type TokenStateCache struct {
+	repo    *repository.UserRepository
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[int]tokenState
+}
+
+func NewTokenStateCache(repo *repository.UserRepository, ttl time.Duration) *TokenStateCache {
+	return &TokenStateCache{
+		repo:    repo,
+		ttl:     ttl,
+		entries: make(map[int]tokenState),
+	}
+}
+
+func (c *TokenStateCache) ValidateClaims(claims *AccessClaims) error {
+	state, err := c.get(claims.UserID)
+	if err != nil {
+		return err
+	}
+	if state.status == model.UserStatusDisabled || state.status == model.UserStatusDeleted {
+		return errors.New("account disabled")
+	}
+	if state.version != claims.TokenVersion {
+		return errors.New("token revoked")
+	}
+	return nil
+}
+
+func (c *TokenStateCache) Invalidate(userID int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, userID)
+}
+
+func (c *TokenStateCache) get(userID int) (tokenState, error) {
+	c.mu.Lock()
+	state, ok := c.entries[userID]
+	c.mu.Unlock()
+	if ok && time.Now().Before(state.expiresAt) {
+		return state, nil
+	}
+
+	user, err := c.repo.GetUserByID(userID)
+	if err != nil {
+		return tokenState{}, errors.New("database error")
+	}
+	if user == nil {
+		return tokenState{}, errors.New("user not found")
+	}
+
+	state = tokenState{status: user.Status, version: user.TokenVersion, expiresAt: time.Now().Add(c.ttl)}
+	c.mu.Lock()
+	c.entries[userID] = state
+	c.mu.Unlock()
+	return state, nil
+}
@@ -1,93 +1,269 @@
 package service
 
 import (
-	"auth-service/internal/logger"
-	"auth-service/internal/model"
-	"auth-service/internal/repository"
 	"errors"
+	"fmt"
+	"github.com/finance-app/finance-app/auth-service/internal/logger"
+	"github.com/finance-app/finance-app/auth-service/internal/mailer"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/finance-app/finance-app/auth-service/internal/notifier"
+	"github.com/finance-app/finance-app/auth-service/internal/repository"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"strings"
 	"time"
 )
 
+const (
+	// UnverifiedPolicyBlock keeps users with an unverified email from logging in.
+	UnverifiedPolicyBlock = "block"
+	// UnverifiedPolicyLimited lets them log in, but their access tokens are
+	// marked as unverified and rejected by RequireVerifiedEmail routes.
+	UnverifiedPolicyLimited = "limited"
+)
+
+const maxNameLength = 255
+
+type UserServiceConfig struct {
+	AppBaseURL                 string
+	MaxFailedLoginAttempts     int
+	AccountLockDuration        time.Duration
+	MaxAccountLockDuration     time.Duration
+	LoginAlertLookback         time.Duration
+	UnverifiedUserPolicy       string
+	EmailVerificationTTL       time.Duration
+	VerificationResendInterval time.Duration
+	PasswordResetTTL           time.Duration
+	EmailChangeTTL             time.Duration
+	EmailChangeUndoTTL         time.Duration
+	DeletionGracePeriod        time.Duration
+	ConcealExistingAccounts    bool
+	PasswordPolicy             PasswordPolicy
+	TOTPIssuer                 string
+	MFAChallengeTTL            time.Duration
+	MFAEncryptionKey           string
+	PasskeyCeremonyTTL         time.Duration
+	SocialStateTTL             time.Duration
+	MagicLinkTTL               time.Duration
+	StepUpTokenTTL             time.Duration
+}
+
 //	type UserServiceInterface interface {
 //		RegisterUser(user model.User) (*model.User, error)
 //		LoginUser(loginInfo model.Login) (*model.Tokens, error)
 //	}
 type UserService struct {
-	repo       *repository.UserRepository
-	logs       *logger.Logger
-	jwtService *JWTService
+	repo            *repository.UserRepository
+	roleRepo        *repository.RoleRepository
+	tokenRepo       *repository.UserTokenRepository
+	sessionRepo     *repository.SessionRepository
+	mfaRepo         *repository.MFARepository
+	passkeyRepo     *repository.PasskeyRepository
+	identityRepo    *repository.IdentityRepository
+	mailer          mailer.Mailer
+	notifier        notifier.Notifier
+	logs            *logger.Logger
+	jwtService      *JWTService
+	tokenState      *TokenStateCache
+	audit           *AuditLog
+	secrets         *SecretBox
+	webAuthn        *webauthn.WebAuthn
+	socialProviders map[string]*SocialProvider
+	config          UserServiceConfig
 }
 
-func NewUserService(repo *repository.UserRepository, logs *logger.Logger, jwtService *JWTService) *UserService {
+func NewUserService(repo *repository.UserRepository, roleRepo *repository.RoleRepository, tokenRepo *repository.UserTokenRepository,
+	sessionRepo *repository.SessionRepository, mfaRepo *repository.MFARepository, passkeyRepo *repository.PasskeyRepository,
+	identityRepo *repository.IdentityRepository, mailer mailer.Mailer, notifier notifier.Notifier, logs *logger.Logger, jwtService *JWTService,
+	tokenState *TokenStateCache, audit *AuditLog, webAuthn *webauthn.WebAuthn, socialProviders []*SocialProvider, config UserServiceConfig) *UserService {
+	providers := make(map[string]*SocialProvider, len(socialProviders))
+	for _, provider := range socialProviders {
+		providers[provider.Name()] = provider
+	}
 	return &UserService{
-		repo:       repo,
-		logs:       logs,
-		jwtService: jwtService,
+		repo:            repo,
+		roleRepo:        roleRepo,
+		tokenRepo:       tokenRepo,
+		sessionRepo:     sessionRepo,
+		mfaRepo:         mfaRepo,
+		passkeyRepo:     passkeyRepo,
+		identityRepo:    identityRepo,
+		mailer:          mailer,
+		notifier:        notifier,
+		logs:            logs,
+		jwtService:      jwtService,
+		tokenState:      tokenState,
+		audit:           audit,
+		secrets:         NewSecretBox(config.MFAEncryptionKey),
+		webAuthn:        webAuthn,
+		socialProviders: providers,
+		config:          config,
 	}
 }
 
-func (s *UserService) RegisterUser(user model.User) (*model.User, error) {
+// RegisterUser validates the password before looking at the email, so a weak
+// password gets the same answer whether or not the address is taken. With
+// ConcealExistingAccounts the owner of a taken address is emailed instead, and
+// nil is returned without an error.
+func (s *UserService) RegisterUser(user model.User, client model.ClientInfo) (*model.User, error) {
+	if err := s.config.PasswordPolicy.Validate(user.Password); err != nil {
+		return nil, err
+	}
+
 	existingUser, err := s.repo.GetUserByEmail(user.Email)
 	if err != nil {
 		s.logs.Error.Printf("Database error: %v", err)
 		return nil, errors.New("database error")
 	}
 
-	if existingUser != nil {
-		s.logs.Info.Printf("User with email %s already exists", user.Email)
-		return nil, errors.New("user already exists")
-	}
-
 	hashedPassword, err := HashPassword(user.Password)
 	if err != nil {
 		return nil, errors.New("failed to hash password")
 	}
+
+	if existingUser != nil {
+		s.logs.Info.Printf("User with email %s already exists", user.Email)
+		if !s.config.ConcealExistingAccounts {
+			return nil, errors.New("user already exists")
+		}
+		s.sendExistingAccountNotice(existingUser)
+		return nil, nil
+	}
 	user.Password = hashedPassword
+	user.Status = model.UserStatusPending
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
 
-	id, err := s.repo.InsertUser(user)
+	event := newDomainEvent(model.EventUserRegistered, 0, map[string]string{"email": user.Email, "name": user.Name, "method": "password"})
+	id, err := s.repo.InsertUser(user, event)
 	if err != nil {
+		if err.Error() == "email already in use" {
+			s.logs.Info.Printf("User with email %s already exists", user.Email)
+			if !s.config.ConcealExistingAccounts {
+				return nil, errors.New("user already exists")
+			}
+			return nil, nil
+		}
 		s.logs.Error.Printf("Database error: could not create user: %v", err)
 		return nil, errors.New("database error: could not create user")
 	}
 	user.ID = id
+
+	if err := s.roleRepo.AssignRole(user.ID, model.RoleUser); err != nil {
+		s.logs.Error.Printf("Failed to assign default role to user ID=%d: %v", user.ID, err)
+	}
+	if err := s.sendVerificationEmail(&user); err != nil {
+		s.logs.Error.Printf("Failed to send verification email to user ID=%d: %v", user.ID, err)
+	}
+	s.audit.UserEvent(model.AuditUserRegistered, user.ID, client, map[string]string{"method": "password"})
 	s.logs.Info.Printf("User registered successfully: ID=%d, Email=%s", user.ID, user.Email)
 	return &user, nil
 }
 
-func (s *UserService) LoginUser(loginInfo model.Login) (*model.Tokens, error) {
+func (s *UserService) ConcealsExistingAccounts() bool {
+	return s.config.ConcealExistingAccounts
+}
+
+func (s *UserService) sendExistingAccountNotice(user *model.User) {
+	err := s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Someone tried to register with your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nSomebody tried to create a new account with this email address, but you already have one.\nIf it was you, sign in instead or reset your password here:\n\n%s/forgot-password\n\nIf it wasn't you, you can ignore this message.",
+			user.Name, s.config.AppBaseURL),
+	})
+	if err != nil {
+		s.logs.Error.Printf("Failed to send existing account notice to user ID=%d: %v", user.ID, err)
+	}
+}
+
+// LoginUser returns tokens, or a challenge when the account has a second
+// factor. In that case failed attempts are only reset once the second factor
+// passed too, so knowing the password doesn't give unlimited code guesses.
+//
+// Until the password is verified, unknown, deleted and locked accounts fail
+// exactly like a wrong password: same error, one bcrypt comparison each, and
+// the bookkeeping writes only real accounts have are done in the background
+// so they don't show in the response time. A locked account fails even with
+// the right password; answering differently would confirm the guess.
+func (s *UserService) LoginUser(loginInfo model.Login) (*model.Tokens, *model.MFAChallenge, error) {
 	existingUser, err := s.repo.GetUserByEmail(loginInfo.Email)
 	if err != nil {
-		return nil, errors.New("database error")
+		return nil, nil, errors.New("database error")
 	}
 
-	if existingUser == nil {
-		s.logs.Info.Printf("Failed login attempt: email not found (%s)", loginInfo.Email)
-		return nil, errors.New("user not found")
+	if existingUser == nil || existingUser.Status == model.UserStatusDeleted {
+		SimulatePasswordCheck(loginInfo.Password)
+		go s.recordUnknownLogin(loginInfo.Email, existingUser, loginInfo.Client)
+		return nil, nil, errors.New("wrong user password")
 	}
 
-	if !CheckPasswordHash(loginInfo.Password, existingUser.Password) {
-		return nil, errors.New("wrong user password")
+	passwordMatches := CheckPasswordHash(loginInfo.Password, existingUser.Password)
+	if isLocked(existingUser) {
+		go s.recordLoginEvent(existingUser.ID, loginInfo.Client, false, "account locked")
+		return nil, nil, errors.New("wrong user password")
+	}
+	if !passwordMatches {
+		go func(user model.User) {
+			s.recordFailedLogin(&user, loginInfo.Client)
+			s.recordLoginEvent(user.ID, loginInfo.Client, false, "wrong user password")
+		}(*existingUser)
+		return nil, nil, errors.New("wrong user password")
+	}
+	if err := s.checkLock(existingUser); err != nil {
+		return nil, nil, err
 	}
 
-	accessToken, err := s.jwtService.GenerateAccessToken(existingUser.ID)
+	methods, err := s.mfaMethods(existingUser.ID)
 	if err != nil {
-		return nil, errors.New("error in access token generation")
+		return nil, nil, err
 	}
 
-	refreshToken := GenerateRefreshToken()
+	if existingUser.FailedLoginAttempts > 0 && len(methods) == 0 {
+		if err := s.repo.ResetFailedLogins(existingUser.ID); err != nil {
+			s.logs.Error.Printf("Failed to reset login attempts for user ID=%d: %v", existingUser.ID, err)
+		}
+	}
 
-	if err := s.repo.InsertRefreshToken(existingUser, refreshToken); err != nil {
-		return nil, errors.New("database error: could not insert token")
+	if err := s.checkLoginStatus(existingUser); err != nil {
+		s.logs.Info.Printf("Login rejected for user ID=%d: %v", existingUser.ID, err)
+		s.recordLoginEvent(existingUser.ID, loginInfo.Client, false, err.Error())
+		return nil, nil, err
 	}
 
-	s.logs.Info.Printf("User logged in: ID=%d, Email=%s", existingUser.ID, existingUser.Email)
+	if len(methods) > 0 {
+		challenge, err := s.mfaChallenge(existingUser, methods, model.AMRPassword)
+		if err != nil {
+			return nil, nil, err
+		}
+		s.logs.Info.Printf("Second factor required for user ID=%d", existingUser.ID)
+		return nil, challenge, nil
+	}
 
-	return &model.Tokens{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+	tokens, err := s.completeLogin(existingUser, loginInfo.Client, []string{model.AMRPassword})
+	if err != nil {
+		return nil, nil, err
+	}
+	return tokens, nil, nil
 }
 
-func (s *UserService) RefreshAccessToken(refreshToken string) (*model.Tokens, error) {
+// completeLogin issues tokens once every factor has been checked. amr lists
+// the methods the user passed.
+func (s *UserService) completeLogin(user *model.User, client model.ClientInfo, amr []string) (*model.Tokens, error) {
+	changes := s.detectClientChanges(user.ID, client)
+	tokens, err := s.issueTokens(user, client, model.Authentication{Time: time.Now(), Methods: amr})
+	if err != nil {
+		return nil, err
+	}
+	s.recordLoginEvent(user.ID, client, true, "")
+	if len(changes) > 0 {
+		s.notifyNewLogin(user, client, changes)
+	}
+
+	s.logs.Info.Printf("User logged in: ID=%d, Email=%s", user.ID, user.Email)
+
+	return tokens, nil
+}
+
+func (s *UserService) RefreshAccessToken(refreshToken string, client model.ClientInfo) (*model.Tokens, error) {
 	user, err := s.repo.GetRefreshToken(refreshToken)
 	if err != nil {
 		return nil, errors.New("database error")
@@ -98,15 +274,17 @@ func (s *UserService) RefreshAccessToken(refreshToken string) (*model.Tokens, er
 		return nil, errors.New("refresh token not found")
 	}
 
-	accessToken, err := s.jwtService.GenerateAccessToken(user.ID)
-	if err != nil {
-		return nil, errors.New("error in access token generation")
+	if err := s.checkSessionStatus(user); err != nil {
+		return nil, err
+	}
+	auth, err := s.repo.GetRefreshTokenAuthentication(refreshToken)
+	if err != nil || auth == nil {
+		return nil, errors.New("database error")
 	}
 
-	newRefreshToken := GenerateRefreshToken()
-	err = s.repo.InsertRefreshToken(user, newRefreshToken)
+	tokens, err := s.issueTokens(user, client, *auth)
 	if err != nil {
-		return nil, errors.New("database error: could not insert refresh token")
+		return nil, err
 	}
 
 	err = s.repo.DeleteRefreshToken(refreshToken)
@@ -114,37 +292,133 @@ func (s *UserService) RefreshAccessToken(refreshToken string) (*model.Tokens, er
 		s.logs.Error.Printf("Failed to delete old refresh token: %v", err)
 	}
 
-	return &model.Tokens{
-		AccessToken:  accessToken,
-		RefreshToken: newRefreshToken,
-	}, nil
+	s.audit.UserEvent(model.AuditTokenRefreshed, user.ID, client, nil)
+	return tokens, nil
+}
+
+// Logout ends the session behind the refresh token. Access tokens already
+// issued for it stay valid until they expire. Unknown tokens are ignored, so
+// logging out twice is not an error.
+func (s *UserService) Logout(refreshToken string, client model.ClientInfo) error {
+	user, err := s.repo.GetRefreshToken(refreshToken)
+	if err != nil {
+		return errors.New("database error")
+	}
+	if user == nil {
+		return nil
+	}
+	if err := s.repo.DeleteRefreshToken(refreshToken); err != nil {
+		return errors.New("database error")
+	}
+	s.audit.UserEvent(model.AuditLogout, user.ID, client, nil)
+	s.logs.Info.Printf("User logged out: ID=%d", user.ID)
+	return nil
 }
 
 func (s *UserService) GetUserByID(userID int) (*model.User, error) {
 	return s.repo.GetUserByID(userID)
 }
 
-func (s *UserService) UpdateCurrentUser(userID int, userName string, userEmail string) (*model.UserInfo, error) {
+// UpdateCurrentUser applies a partial update of the profile. A new email
+// address has to go through RequestEmailChange so that both addresses are
+// involved. If expectedUpdatedAt is set and the profile changed in the
+// meantime, nothing is written.
+func (s *UserService) UpdateCurrentUser(userID int, update model.UserUpdate, expectedUpdatedAt *time.Time, client model.ClientInfo) (*model.User, error) {
 	existingUser, err := s.repo.GetUserByID(userID)
 	if err != nil {
 		return nil, errors.New("database error")
 	}
+	if existingUser == nil {
+		return nil, errors.New("user not found")
+	}
+
+	if update.Email != nil {
+		email, err := normalizeEmail(*update.Email)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.EqualFold(email, existingUser.Email) {
+			return nil, errors.New("email change requires confirmation")
+		}
+	}
 
-	if existingUser != nil && existingUser.ID != userID {
-		return nil, errors.New("email already in use")
+	if update.Name != nil {
+		name := strings.TrimSpace(*update.Name)
+		if name == "" || len(name) > maxNameLength {
+			return nil, errors.New("invalid name")
+		}
+		update.Name = &name
 	}
 
-	updateUserInfo, err := s.repo.UpdateUser(userID, userName, userEmail)
+	if expectedUpdatedAt != nil && !expectedUpdatedAt.Equal(existingUser.UpdatedAt) {
+		return nil, errors.New("precondition failed")
+	}
+	if update.Name == nil {
+		return existingUser, nil
+	}
+
+	updatedUser, err := s.repo.UpdateUser(userID, update, expectedUpdatedAt)
 	if err != nil {
 		return nil, errors.New("database error: could not update user")
 	}
-	return updateUserInfo, nil
+	if updatedUser == nil {
+		return nil, errors.New("precondition failed")
+	}
+	s.audit.UserEvent(model.AuditProfileUpdated, userID, client, map[string]string{"fields": "name"})
+	s.logs.Info.Printf("Profile updated for user ID=%d", userID)
+	return updatedUser, nil
 }
 
-func (s *UserService) DeleteCurrentUser(userID int) error {
-	err := s.repo.DeleteCurrentUser(userID)
+func (s *UserService) issueTokens(user *model.User, client model.ClientInfo, auth model.Authentication) (*model.Tokens, error) {
+	claims, err := s.accessClaims(user, auth)
 	if err != nil {
-		return errors.New("database error: could not delete user")
+		return nil, err
+	}
+	accessToken, err := s.jwtService.GenerateAccessToken(*claims)
+	if err != nil {
+		return nil, errors.New("error in access token generation")
+	}
+
+	refreshToken := GenerateRefreshToken()
+	if err := s.repo.InsertRefreshToken(user, refreshToken, client, auth); err != nil {
+		return nil, errors.New("database error: could not insert refresh token")
+	}
+
+	return &model.Tokens{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+// accessClaims reads the roles and permissions the user holds right now.
+func (s *UserService) accessClaims(user *model.User, auth model.Authentication) (*AccessClaims, error) {
+	roles, err := s.roleRepo.GetUserRoles(user.ID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	permissions, err := s.roleRepo.GetUserPermissions(user.ID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	return &AccessClaims{
+		UserID:        user.ID,
+		TokenVersion:  user.TokenVersion,
+		EmailVerified: user.EmailVerifiedAt != nil,
+		Roles:         roles,
+		Permissions:   permissions,
+		AuthTime:      auth.Time,
+		AMR:           auth.Methods,
+	}, nil
+}
+
+func (s *UserService) recordLoginEvent(userID int, client model.ClientInfo, success bool, reason string) {
+	if err := s.sessionRepo.InsertLoginEvent(userID, client, success, reason); err != nil {
+		s.logs.Error.Printf("Failed to record login event for user ID=%d: %v", userID, err)
+	}
+	var details map[string]string
+	if reason != "" {
+		details = map[string]string{"reason": reason}
+	}
+	if success {
+		s.audit.UserEvent(model.AuditLoginSucceeded, userID, client, details)
+	} else {
+		s.audit.AnonymousEvent(model.AuditLoginFailed, userID, client, details)
 	}
-	return nil
 }
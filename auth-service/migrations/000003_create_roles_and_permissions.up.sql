@@ -0,0 +1,54 @@
+CREATE TABLE roles(
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP
+);
+
+CREATE TABLE permissions(
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(128) NOT NULL UNIQUE,
+    created_at TIMESTAMP
+);
+
+CREATE TABLE role_permissions(
+    role_id INT NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    permission_id INT NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE user_roles(
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role_id INT NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    created_at TIMESTAMP,
+    PRIMARY KEY (user_id, role_id)
+);
+
+INSERT INTO roles (name, created_at) VALUES
+    ('admin', NOW()),
+    ('support', NOW()),
+    ('user', NOW());
+
+INSERT INTO permissions (name, created_at) VALUES
+    ('users:read', NOW()),
+    ('users:write', NOW()),
+    ('roles:write', NOW()),
+    ('accounts:read', NOW()),
+    ('accounts:write', NOW()),
+    ('transactions:read', NOW()),
+    ('transactions:write', NOW());
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r CROSS JOIN permissions p WHERE r.name = 'admin';
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r INNER JOIN permissions p
+    ON p.name IN ('users:read', 'accounts:read', 'transactions:read')
+WHERE r.name = 'support';
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r INNER JOIN permissions p
+    ON p.name IN ('accounts:read', 'accounts:write', 'transactions:read', 'transactions:write')
+WHERE r.name = 'user';
+
+INSERT INTO user_roles (user_id, role_id, created_at)
+SELECT u.id, r.id, NOW() FROM users u CROSS JOIN roles r WHERE r.name = 'user';
\ No newline at end of file
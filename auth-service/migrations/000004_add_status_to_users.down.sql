@@ -0,0 +1,4 @@
+DROP INDEX idx_users_created_at;
+DROP INDEX idx_users_status;
+
+ALTER TABLE users DROP COLUMN status;
\ No newline at end of file
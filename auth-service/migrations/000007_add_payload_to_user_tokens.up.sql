@@ -0,0 +1 @@
+ALTER TABLE user_tokens ADD COLUMN payload TEXT;
\ No newline at end of file
@@ -0,0 +1,4 @@
+DROP INDEX idx_users_deletion_scheduled_at;
+
+ALTER TABLE users DROP COLUMN anonymized_at;
+ALTER TABLE users DROP COLUMN deletion_scheduled_at;
\ No newline at end of file
@@ -0,0 +1,5 @@
+DROP TABLE export_jobs;
+DROP TABLE login_history;
+
+ALTER TABLE refresh_tokens DROP COLUMN user_agent;
+ALTER TABLE refresh_tokens DROP COLUMN ip;
\ No newline at end of file
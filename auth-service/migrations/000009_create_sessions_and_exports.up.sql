@@ -0,0 +1,29 @@
+ALTER TABLE refresh_tokens ADD COLUMN ip VARCHAR(64);
+ALTER TABLE refresh_tokens ADD COLUMN user_agent TEXT;
+
+CREATE TABLE login_history(
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    ip VARCHAR(64),
+    user_agent TEXT,
+    success BOOLEAN NOT NULL,
+    reason VARCHAR(64),
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_login_history_user_id ON login_history(user_id, created_at);
+
+CREATE TABLE export_jobs(
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(16) NOT NULL,
+    format VARCHAR(8) NOT NULL,
+    file_path TEXT,
+    download_token_hash VARCHAR(64) UNIQUE,
+    error TEXT,
+    expires_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    completed_at TIMESTAMP
+);
+
+CREATE INDEX idx_export_jobs_status ON export_jobs(status);
\ No newline at end of file
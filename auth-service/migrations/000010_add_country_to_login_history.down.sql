@@ -0,0 +1,3 @@
+DROP INDEX idx_login_history_user_success;
+
+ALTER TABLE login_history DROP COLUMN country;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE login_history ADD COLUMN country VARCHAR(2);
+
+CREATE INDEX idx_login_history_user_success ON login_history(user_id, success, created_at);
\ No newline at end of file
@@ -0,0 +1,4 @@
+DROP TABLE webauthn_sessions;
+DROP TABLE webauthn_credentials;
+
+ALTER TABLE users DROP COLUMN webauthn_handle;
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE refresh_tokens DROP COLUMN auth_time;
+
+ALTER TABLE oauth_authorization_codes DROP COLUMN auth_time;
+ALTER TABLE oauth_authorization_codes DROP COLUMN nonce;
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE oauth_authorization_codes ADD COLUMN nonce TEXT;
+ALTER TABLE oauth_authorization_codes ADD COLUMN auth_time TIMESTAMP;
+
+ALTER TABLE refresh_tokens ADD COLUMN auth_time TIMESTAMP;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP INDEX idx_oauth_clients_service_name;
\ No newline at end of file
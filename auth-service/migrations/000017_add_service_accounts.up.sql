@@ -0,0 +1 @@
+CREATE UNIQUE INDEX idx_oauth_clients_service_name ON oauth_clients(name) WHERE type = 'service' AND revoked_at IS NULL;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE refresh_tokens ADD COLUMN amr TEXT[] NOT NULL DEFAULT '{}';
\ No newline at end of file
@@ -0,0 +1,39 @@
+CREATE TABLE audit_events(
+    id BIGSERIAL PRIMARY KEY,
+    type VARCHAR(64) NOT NULL,
+    actor_type VARCHAR(16) NOT NULL,
+    actor_id INT,
+    target_id INT,
+    ip VARCHAR(64),
+    user_agent TEXT,
+    ip_hash VARCHAR(64),
+    user_agent_hash VARCHAR(64),
+    request_id TEXT,
+    details JSONB,
+    prev_hash VARCHAR(64) NOT NULL,
+    hash VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_audit_events_target_id ON audit_events(target_id, created_at);
+CREATE INDEX idx_audit_events_actor_id ON audit_events(actor_id, created_at);
+CREATE INDEX idx_audit_events_type ON audit_events(type, created_at);
+
+CREATE FUNCTION reject_audit_event_change() RETURNS TRIGGER AS $$
+BEGIN
+    -- The client details are outside the hash chain so they can be erased
+    -- with the account. Nothing else may change.
+    IF TG_OP = 'UPDATE' THEN
+        IF NEW.ip IS NULL AND NEW.user_agent IS NULL
+            AND to_jsonb(NEW) - 'ip' - 'user_agent' = to_jsonb(OLD) - 'ip' - 'user_agent' THEN
+            RETURN NEW;
+        END IF;
+    END IF;
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION reject_audit_event_change();
+CREATE TRIGGER audit_events_no_truncate BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION reject_audit_event_change();
\ No newline at end of file
@@ -0,0 +1,16 @@
+CREATE TABLE outbox(
+    id BIGSERIAL PRIMARY KEY,
+    idempotency_key VARCHAR(36) NOT NULL UNIQUE,
+    type VARCHAR(64) NOT NULL,
+    user_id INT NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    available_at TIMESTAMP NOT NULL,
+    published_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_outbox_pending ON outbox(available_at) WHERE published_at IS NULL;
+CREATE INDEX idx_outbox_pending_user ON outbox(user_id, id) WHERE published_at IS NULL;
+CREATE INDEX idx_outbox_published_at ON outbox(published_at);
\ No newline at end of file
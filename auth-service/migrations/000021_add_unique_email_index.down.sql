@@ -0,0 +1 @@
+DROP INDEX idx_users_email_lower;
\ No newline at end of file
@@ -0,0 +1 @@
+CREATE UNIQUE INDEX idx_users_email_lower ON users(LOWER(email));
\ No newline at end of file
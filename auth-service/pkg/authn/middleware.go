@@ -0,0 +1,118 @@
+package authn
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+type contextKey struct{}
+
+// FromContext returns the principal stored by Authenticate.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(contextKey{}).(*Principal)
+	return principal, ok
+}
+
+// Authenticate requires a valid Bearer token and stores its principal in the
+// request context.
+func (v *Verifier) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer`)
+			sendError(w, http.StatusUnauthorized, "Missing or invalid Authorization header")
+			return
+		}
+		principal, err := v.Verify(r.Context(), token)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			sendError(w, http.StatusUnauthorized, "Invalid token")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, principal)))
+	})
+}
+
+// RequireUser must be mounted after Authenticate and turns away service
+// accounts.
+func RequireUser(next http.Handler) http.Handler {
+	return require(func(p *Principal) bool { return !p.IsService() }, "A user token is required")(next)
+}
+
+// RequireService must be mounted after Authenticate. With no names any service
+// account is let through; otherwise only the listed ones.
+func RequireService(services ...string) func(http.Handler) http.Handler {
+	return require(func(p *Principal) bool {
+		return p.IsService() && (len(services) == 0 || slices.Contains(services, p.Service))
+	}, "This endpoint is for internal services only")
+}
+
+// RequireScope must be mounted after Authenticate. For users the scope is one
+// of their permissions, for service accounts one of their granted scopes.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return require(func(p *Principal) bool { return p.HasScope(scope) }, "Insufficient permissions")
+}
+
+// RequireStepUp must be mounted after Authenticate on sensitive user routes,
+// such as initiating a payout. Users who authenticated longer than maxAge ago,
+// or without a second factor when one is demanded, get the RFC 9470
+// insufficient_user_authentication error. They can get an elevated token from
+// auth-service's /auth/reauthenticate and retry.
+func RequireStepUp(maxAge time.Duration, secondFactor bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := FromContext(r.Context())
+			if !ok {
+				sendError(w, http.StatusUnauthorized, "Not authenticated")
+				return
+			}
+			if !principal.IsService() && principal.AuthenticatedWithin(maxAge) && (!secondFactor || principal.HasSecondFactor()) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			description := "Recent authentication is required"
+			if secondFactor {
+				description = "Recent authentication with a second factor is required"
+			}
+			seconds := int(maxAge.Seconds())
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_user_authentication", error_description="%s", max_age=%d`, description, seconds))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]any{
+				"error":                  "insufficient_user_authentication",
+				"error_description":      description,
+				"max_age":                seconds,
+				"second_factor_required": secondFactor,
+			})
+		})
+	}
+}
+
+func require(allowed func(*Principal) bool, message string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := FromContext(r.Context())
+			if !ok {
+				sendError(w, http.StatusUnauthorized, "Not authenticated")
+				return
+			}
+			if !allowed(principal) {
+				sendError(w, http.StatusForbidden, message)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func sendError(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,151 @@
+// Package authn verifies access tokens issued by auth-service so that other
+// finance services can authenticate both users and service accounts without
+// calling auth-service on every request.
+//
+// Tokens are checked offline against the keys auth-service publishes at
+// /.well-known/jwks.json, which are fetched once and again only when a token
+// names an unknown key. A user who signs out everywhere or is disabled keeps
+// access until the token expires, 30 minutes at most; services that need an
+// up-to-date answer should use the introspection endpoint instead.
+package authn
+
+import (
+	"context"
+	"errors"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/golang-jwt/jwt/v5"
+	"slices"
+	"strings"
+	"time"
+)
+
+// accessTokenType is the typ header of access tokens (RFC 9068). ID tokens
+// are signed with the same keys but don't have it.
+const accessTokenType = "at+jwt"
+
+var signingMethods = []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg()}
+
+// Principal is the caller behind a verified token: either a user, possibly
+// acting through an OAuth client, or a service account.
+type Principal struct {
+	UserID        int
+	EmailVerified bool
+	Roles         []string
+	Scopes        []string
+	// ClientID is the OAuth client the token was issued to, if any.
+	ClientID string
+	// Service is the service account name; it is empty for user tokens.
+	Service string
+	// AuthTime and AMR tell when and how the user last authenticated. They
+	// are empty for service accounts and API keys.
+	AuthTime  time.Time
+	AMR       []string
+	ExpiresAt time.Time
+}
+
+func (p *Principal) IsService() bool {
+	return p.Service != ""
+}
+
+func (p *Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// AuthenticatedWithin reports whether the user authenticated no longer than
+// maxAge ago.
+func (p *Principal) AuthenticatedWithin(maxAge time.Duration) bool {
+	return !p.AuthTime.IsZero() && time.Since(p.AuthTime) <= maxAge
+}
+
+// HasSecondFactor reports whether a one-time code or passkey was part of the
+// authentication.
+func (p *Principal) HasSecondFactor() bool {
+	return slices.ContainsFunc(p.AMR, func(method string) bool {
+		return method == "otp" || method == "webauthn" || method == "mfa"
+	})
+}
+
+type Verifier struct {
+	keys      oidc.KeySet
+	validator *jwt.Validator
+}
+
+// NewVerifier accepts tokens signed with one of keys, issued by issuer (the
+// OIDC_ISSUER of auth-service) for audience (its ACCESS_TOKEN_AUDIENCE).
+func NewVerifier(keys oidc.KeySet, issuer string, audience string) *Verifier {
+	return &Verifier{
+		keys:      keys,
+		validator: jwt.NewValidator(jwt.WithIssuer(issuer), jwt.WithAudience(audience), jwt.WithExpirationRequired()),
+	}
+}
+
+// NewRemoteVerifier fetches the keys from the issuer's JWKS endpoint.
+func NewRemoteVerifier(issuer string, audience string) *Verifier {
+	keys := oidc.NewRemoteKeySet(context.Background(), strings.TrimSuffix(issuer, "/")+"/.well-known/jwks.json")
+	return NewVerifier(keys, issuer, audience)
+}
+
+// Verify accepts user access tokens and service account tokens. Tokens of
+// OAuth clients acting for nobody but themselves are rejected, as they do not
+// identify a finance service.
+func (v *Verifier) Verify(ctx context.Context, tokenString string) (*Principal, error) {
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil || !slices.Contains(signingMethods, token.Method.Alg()) || token.Header["typ"] != accessTokenType {
+		return nil, errors.New("invalid token")
+	}
+	if _, err := v.keys.VerifySignature(ctx, tokenString); err != nil {
+		return nil, errors.New("invalid token")
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	if err := v.validator.Validate(claims); err != nil {
+		return nil, errors.New("invalid token")
+	}
+
+	principal := &Principal{Roles: []string{}, Scopes: []string{}, AMR: []string{}}
+	if scope, ok := claims["scope"].(string); ok && scope != "" {
+		principal.Scopes = strings.Fields(scope)
+	}
+	if clientID, ok := claims["client_id"].(string); ok {
+		principal.ClientID = clientID
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		principal.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+
+	if userID, ok := claims["user_id"].(float64); ok {
+		principal.UserID = int(userID)
+		if verified, ok := claims["email_verified"].(bool); ok {
+			principal.EmailVerified = verified
+		}
+		if roles, ok := claims["roles"].([]interface{}); ok {
+			for _, role := range roles {
+				if name, ok := role.(string); ok {
+					principal.Roles = append(principal.Roles, name)
+				}
+			}
+		}
+		if authTime, ok := claims["auth_time"].(float64); ok {
+			principal.AuthTime = time.Unix(int64(authTime), 0)
+		}
+		if methods, ok := claims["amr"].([]interface{}); ok {
+			for _, method := range methods {
+				if name, ok := method.(string); ok {
+					principal.AMR = append(principal.AMR, name)
+				}
+			}
+		}
+		return principal, nil
+	}
+
+	service, _ := claims["service"].(string)
+	azp, _ := claims["azp"].(string)
+	if service == "" || azp == "" || azp != principal.ClientID {
+		return nil, errors.New("invalid token")
+	}
+	principal.Service = service
+	return principal, nil
+}
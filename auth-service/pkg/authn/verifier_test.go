@@ -0,0 +1,152 @@
+package authn
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/finance-app/finance-app/auth-service/internal/model"
+	"github.com/finance-app/finance-app/auth-service/internal/service"
+	"github.com/golang-jwt/jwt/v5"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestIssuer serves the JWKS of a fresh signer the way auth-service does.
+func newTestIssuer(t *testing.T) (*httptest.Server, *service.IDTokenSigner) {
+	t.Helper()
+	var signer *service.IDTokenSigner
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/jwks.json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(signer.JWKS())
+	}))
+	t.Cleanup(server.Close)
+
+	var err error
+	signer, err = service.NewIDTokenSigner(nil, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, signer
+}
+
+func TestVerify(t *testing.T) {
+	server, signer := newTestIssuer(t)
+	tokens := service.NewJWTService("test-jwt-secret", signer, "finance-api")
+	verifier := NewRemoteVerifier(server.URL, "finance-api")
+	ctx := context.Background()
+
+	t.Run("user token", func(t *testing.T) {
+		token, err := tokens.GenerateAccessToken(service.AccessClaims{
+			UserID:        7,
+			EmailVerified: true,
+			Roles:         []string{"user"},
+			Permissions:   []string{"transactions:read"},
+			AuthTime:      time.Now(),
+			AMR:           []string{model.AMRPassword, model.AMROTP},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		principal, err := verifier.Verify(ctx, token)
+		if err != nil {
+			t.Fatalf("Verify: %v", err)
+		}
+		if principal.UserID != 7 || principal.IsService() || !principal.HasRole("user") || !principal.HasScope("transactions:read") {
+			t.Fatalf("principal = %+v", principal)
+		}
+		if !principal.AuthenticatedWithin(time.Minute) || !principal.HasSecondFactor() {
+			t.Fatalf("authentication details lost: %+v", principal)
+		}
+	})
+
+	t.Run("service token", func(t *testing.T) {
+		token, err := tokens.GenerateServiceAccessToken("client-1", "payments", []string{"users:read"}, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		principal, err := verifier.Verify(ctx, token)
+		if err != nil {
+			t.Fatalf("Verify: %v", err)
+		}
+		if principal.Service != "payments" || principal.ClientID != "client-1" || !principal.HasScope("users:read") {
+			t.Fatalf("principal = %+v", principal)
+		}
+	})
+
+	t.Run("client token", func(t *testing.T) {
+		token, err := tokens.GenerateClientAccessToken("client-1", []string{"users:read"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := verifier.Verify(ctx, token); err == nil {
+			t.Fatal("a token that names no user or service was accepted")
+		}
+	})
+
+	t.Run("ID token", func(t *testing.T) {
+		token, err := signer.Sign(service.IDTokenClaims{UserID: 7, ClientID: "finance-api"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := verifier.Verify(ctx, token); err == nil {
+			t.Fatal("an ID token was accepted as an access token")
+		}
+	})
+
+	t.Run("other audience", func(t *testing.T) {
+		token, err := service.NewJWTService("test-jwt-secret", signer, "another-api").GenerateAccessToken(service.AccessClaims{UserID: 7})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := verifier.Verify(ctx, token); err == nil {
+			t.Fatal("a token for another audience was accepted")
+		}
+	})
+
+	t.Run("unpublished key", func(t *testing.T) {
+		other, err := service.NewIDTokenSigner(nil, server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := service.NewJWTService("test-jwt-secret", other, "finance-api").GenerateAccessToken(service.AccessClaims{UserID: 7})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := verifier.Verify(ctx, token); err == nil {
+			t.Fatal("a token signed with an unpublished key was accepted")
+		}
+	})
+
+	t.Run("other issuer", func(t *testing.T) {
+		token, err := tokens.GenerateAccessToken(service.AccessClaims{UserID: 7})
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys := &oidc.StaticKeySet{PublicKeys: []crypto.PublicKey{signer.PublicKey()}}
+		if _, err := NewVerifier(keys, "http://other.test", "finance-api").Verify(ctx, token); err == nil {
+			t.Fatal("a token from another issuer was accepted")
+		}
+	})
+
+	t.Run("shared secret", func(t *testing.T) {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
+			"iss":     server.URL,
+			"aud":     "finance-api",
+			"user_id": 7,
+			"exp":     time.Now().Add(time.Minute).Unix(),
+		}).SignedString([]byte("test-jwt-secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := verifier.Verify(ctx, token); err == nil {
+			t.Fatal("an HS512 token was accepted")
+		}
+	})
+}